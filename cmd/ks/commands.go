@@ -2,12 +2,19 @@ package ks
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/yliu7949/KouShare-dl/internal/color"
+	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/proxy"
+	"github.com/yliu7949/KouShare-dl/internal/timecode"
 	"github.com/yliu7949/KouShare-dl/live"
 	"github.com/yliu7949/KouShare-dl/slide"
 	"github.com/yliu7949/KouShare-dl/user"
@@ -28,13 +35,16 @@ func InfoCmd() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 			if len(args[0]) == 6 {
 				l.RoomID = args[0]
+				l.Password = videoPassword
 				l.ShowLiveInfo()
 			} else {
 				v.Vid = args[0]
+				v.Password = videoPassword
 				v.ShowVideoInfo()
 			}
 		},
 	}
+	cmdInfo.Flags().StringVar(&videoPassword, "password", "", "指定视频或直播间的密码（不指定时在需要密码时提示输入）")
 
 	return cmdInfo
 }
@@ -42,10 +52,14 @@ func InfoCmd() *cobra.Command {
 var quality string
 var isSeries bool
 var vidPrefix bool
+var withSlides bool
+var videoPassword string
+var nameTemplate string
 
 // SaveCmd 保存指定vid的视频
 func SaveCmd() *cobra.Command {
 	var v video.Video
+	var from, to string
 	var cmdSave = &cobra.Command{
 		Use:   "save [vid]",
 		Short: "保存指定vid的视频",
@@ -58,7 +72,19 @@ func SaveCmd() *cobra.Command {
 			}
 			v.SaveDir = path
 			v.VidPrefix = vidPrefix
+			v.NameTemplate = nameTemplate
+			v.WithSlides = withSlides
+			v.Password = videoPassword
+			var err error
+			if v.From, v.To, err = parseClipRange(from, to); err != nil {
+				fmt.Println(err)
+				return
+			}
 			if isSeries {
+				if v.From > 0 || v.To > 0 {
+					fmt.Println("下载专题视频时不支持截取片段。")
+					return
+				}
 				v.DownloadSeriesVideos(quality)
 			} else {
 				v.DownloadSingleVideo(quality)
@@ -70,6 +96,11 @@ func SaveCmd() *cobra.Command {
 	cmdSave.PersistentFlags().BoolVarP(&isSeries, "series", "s", false, "指定是否下载专题视频")
 	cmdSave.PersistentFlags().StringVarP(&quality, "quality", "q", `high`, "指定下载视频的清晰度（high、standard或low）")
 	cmdSave.PersistentFlags().BoolVarP(&vidPrefix, "vidPrefix", "v", false, "指定是否使用vid作为保存视频文件名的前缀")
+	cmdSave.PersistentFlags().StringVar(&nameTemplate, "name-template", "", "指定保存视频文件的文件名模板，可使用{vid}、{title}、{quality}、{speaker}、{date}和{series}")
+	cmdSave.PersistentFlags().BoolVar(&withSlides, "with-slides", false, "指定是否同时下载视频对应的课件，课件与视频保存在同一文件夹中且文件名相同")
+	cmdSave.PersistentFlags().StringVar(&videoPassword, "password", "", "指定视频的密码（不指定时在需要密码时提示输入）")
+	cmdSave.Flags().StringVar(&from, "from", "", `指定截取视频的开始时间（如"01:10:00"），仅下载该范围内的数据`)
+	cmdSave.Flags().StringVar(&to, "to", "", `指定截取视频的结束时间（如"01:32:00"），默认为视频结尾`)
 	cmdSave.AddCommand(SaveBatchCmd())
 
 	return cmdSave
@@ -92,6 +123,9 @@ func SaveBatchCmd() *cobra.Command {
 			b.Quality = quality
 			b.IsSeries = isSeries
 			b.VidPrefix = vidPrefix
+			b.NameTemplate = nameTemplate
+			b.WithSlides = withSlides
+			b.Password = videoPassword
 			b.DownloadMultiVideos()
 		},
 	}
@@ -99,14 +133,81 @@ func SaveBatchCmd() *cobra.Command {
 	return cmdSaveBatch
 }
 
+// MineCmd 列出并下载当前账户已购买或收藏的视频
+func MineCmd() *cobra.Command {
+	var m video.Mine
+	var download bool
+	var cmdMine = &cobra.Command{
+		Use:   "mine",
+		Short: "列出并下载已购买或收藏的视频",
+		Long:  `列出当前登录账户已购买或收藏的视频及其观看权限的过期时间，使用 --download 参数下载全部视频.`,
+	}
+	cmdMine.PersistentFlags().BoolVar(&download, "download", false, "指定是否下载列出的全部视频（观看权限先过期的视频先下载）")
+	cmdMine.PersistentFlags().StringVarP(&path, "path", "p", `.`, "指定保存视频的路径")
+	cmdMine.PersistentFlags().StringVarP(&quality, "quality", "q", `high`, "指定下载视频的清晰度（high、standard或low）")
+	cmdMine.PersistentFlags().BoolVarP(&vidPrefix, "vidPrefix", "v", false, "指定是否使用vid作为保存视频文件名的前缀")
+	cmdMine.PersistentFlags().StringVar(&nameTemplate, "name-template", "", "指定保存视频文件的文件名模板，可使用{vid}、{title}、{quality}、{speaker}、{date}和{series}")
+	cmdMine.PersistentFlags().BoolVar(&withSlides, "with-slides", false, "指定是否同时下载视频对应的课件，课件与视频保存在同一文件夹中且文件名相同")
+	cmdMine.AddCommand(mineListCmd(&m, &download, "purchased", "列出已购买的视频", user.Purchased),
+		mineListCmd(&m, &download, "favorites", "列出收藏的视频", user.Favorites))
+
+	return cmdMine
+}
+
+// mineListCmd 返回mine命令的子命令，fetch用于获取视频列表
+func mineListCmd(m *video.Mine, download *bool, use, short string, fetch func() ([]user.Item, error)) *cobra.Command {
+	return &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  short + `及其观看权限的过期时间，需要先登录.`,
+		Args:  cobra.MinimumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			items, err := fetch()
+			if err != nil {
+				fmt.Println("获取视频列表失败：", err)
+				return
+			}
+			m.Items = items
+			m.ShowItems()
+			if !*download || len(items) == 0 {
+				return
+			}
+			if path[len(path)-1:] != `\` && path[len(path)-1:] != "/" {
+				path = path + "/"
+			}
+			m.SaveDir = path
+			m.Quality = quality
+			m.VidPrefix = vidPrefix
+			m.NameTemplate = nameTemplate
+			m.WithSlides = withSlides
+			fmt.Println()
+			m.DownloadItems()
+		},
+	}
+}
+
 // RecordCmd 录制指定直播间ID的直播
 func RecordCmd() *cobra.Command {
 	var l live.Live
-	var liveTime string //开播时间，格式应为"2006-01-02 15:04:05"
+	var liveTime string //开播时间，格式见 --at 参数的说明
 	var autoMerge bool
 	var replay bool
 	var password string
 	var videoID string
+	var backfill bool
+	var backfillTimeout time.Duration
+	var followReplay bool
+	var followTimeout time.Duration
+	var liveQuality string
+	var backup bool
+	var serveAddr string
+	var timeZone string
+	var lead time.Duration
+	var part int
+	var allParts bool
+	var maxHeight int64
+	var jobs int
+	var from, to string
 
 	var cmdRecord = &cobra.Command{
 		Use:   "record [roomID]",
@@ -115,12 +216,42 @@ func RecordCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			l.RoomID = args[0]
+			if liveQuality != "high" && liveQuality != "standard" {
+				fmt.Println("清晰度参数错误，应为 high 或 standard。")
+				return
+			}
 			if path[len(path)-1:] != `\` && path[len(path)-1:] != "/" {
 				path = path + "/"
 			}
 			l.SaveDir = path
 			l.Password = password
 			l.VideoID = videoID
+			l.Quality = liveQuality
+			l.Backup = backup
+			l.ServeAddr = serveAddr
+			l.TimeZone = timeZone
+			l.Lead = lead
+			l.Part = part
+			l.AllParts = allParts
+			l.MaxHeight = maxHeight
+			l.Jobs = jobs
+			if part < 0 || maxHeight < 0 {
+				fmt.Println("--part 和 --max-height 参数不能为负数。")
+				return
+			}
+			var err error
+			if l.From, l.To, err = parseClipRange(from, to); err != nil {
+				fmt.Println(err)
+				return
+			}
+			if !replay && (l.From > 0 || l.To > 0) {
+				fmt.Println("--from 和 --to 参数仅在下载回放（--replay）时可用。")
+				return
+			}
+			l.Backfill = backfill
+			l.BackfillTimeout = backfillTimeout
+			l.FollowReplay = followReplay
+			l.FollowTimeout = followTimeout
 			if !replay {
 				l.WaitAndRecordTheLive(liveTime, autoMerge)
 			} else {
@@ -130,15 +261,62 @@ func RecordCmd() *cobra.Command {
 		Aliases: []string{"live"},
 	}
 	cmdRecord.Flags().StringVarP(&path, "path", "p", `.`, "指定保存视频的路径")
-	cmdRecord.Flags().StringVarP(&liveTime, "at", "@", "", `开播时间，格式为"2006-01-02 15:04:05"`)
+	cmdRecord.Flags().StringVarP(&liveTime, "at", "@", "", `开播时间，格式为"2006-01-02 15:04:05"、RFC3339（如"2023-07-15T18:30:00+08:00"）或相对时间（如"+2h30m"）`)
+	cmdRecord.Flags().StringVar(&timeZone, "tz", "", "指定解析开播时间时使用的时区（如Asia/Shanghai），默认为本地时区")
+	cmdRecord.Flags().DurationVar(&lead, "lead", 0, "指定提前多久开始轮询直播状态（如5m）")
 	cmdRecord.Flags().BoolVarP(&autoMerge, "autoMerge", "a", false, "指定是否自动合并下载的视频片段文件")
 	cmdRecord.Flags().BoolVarP(&replay, "replay", "r", false, "指定是否下载直播间快速回放视频")
-	cmdRecord.Flags().StringVar(&password, "password", "", "指定直播间密码")
-	cmdRecord.Flags().StringVar(&videoID, "videoId", "", "指定回放对应的 videoId（新接口可能需要，示例：--videoId 197212）")
+	cmdRecord.Flags().StringVar(&password, "password", "", "指定直播间密码（不指定时在需要密码时提示输入）")
+	cmdRecord.Flags().StringVar(&videoID, "videoId", "", "指定回放对应的 videoId（默认自动获取，示例：--videoId 197212）")
+	cmdRecord.Flags().IntVar(&part, "part", 0, "指定下载第几段回放（可使用ks replay list查看），默认为第一段")
+	cmdRecord.Flags().BoolVar(&allParts, "all-parts", false, "指定是否下载直播间的全部回放")
+	cmdRecord.Flags().Int64Var(&maxHeight, "max-height", 0, "指定下载回放的最高清晰度（视频高度，如720），默认为最高清晰度")
+	cmdRecord.Flags().IntVarP(&jobs, "jobs", "j", 4, "指定并发下载快速回放片段的数量")
+	cmdRecord.Flags().StringVar(&from, "from", "", `指定截取回放的开始时间（如"01:10:00"），仅下载该范围内的片段`)
+	cmdRecord.Flags().StringVar(&to, "to", "", `指定截取回放的结束时间（如"01:32:00"），默认为回放结尾`)
+	cmdRecord.Flags().StringVarP(&liveQuality, "quality", "q", "high", "指定录制直播的清晰度（high或standard）")
+	cmdRecord.Flags().BoolVar(&backup, "backup", false, "指定是否同时录制两种清晰度，并用另一清晰度填补录制中的缺口")
+	cmdRecord.Flags().StringVar(&serveAddr, "serve", "", "指定本地回看服务的监听地址（如:8080），录制时可通过HLS播放器从头观看已录制的内容")
+	cmdRecord.Flags().BoolVar(&backfill, "backfill", false, "指定是否在直播结束后从回放中回填录制缺口")
+	cmdRecord.Flags().DurationVar(&backfillTimeout, "backfill-timeout", 2*time.Hour, "指定回填时等待回放上线的最长时间")
+	cmdRecord.Flags().BoolVar(&followReplay, "follow-replay", false, "指定是否在直播结束后等待并自动下载正式回放或快速回放视频")
+	cmdRecord.Flags().DurationVar(&followTimeout, "follow-timeout", 24*time.Hour, "指定等待回放上线的最长时间")
 
 	return cmdRecord
 }
 
+// ReplayCmd 查看直播间的回放
+func ReplayCmd() *cobra.Command {
+	var cmdReplay = &cobra.Command{
+		Use:   "replay",
+		Short: "查看直播间的回放",
+		Long:  `查看直播间的回放，下载回放请使用“ks record [roomID] --replay”命令.`,
+	}
+	cmdReplay.AddCommand(ReplayListCmd())
+
+	return cmdReplay
+}
+
+// ReplayListCmd 列出直播间的全部回放及其清晰度，是replay命令的子命令
+func ReplayListCmd() *cobra.Command {
+	var l live.Live
+	var videoID string
+	var cmdReplayList = &cobra.Command{
+		Use:   "list [roomID]",
+		Short: "列出直播间的全部回放及其清晰度",
+		Long:  `列出直播间的全部回放（如上午场、下午场）及每段回放可选的清晰度.`,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			l.RoomID = args[0]
+			l.VideoID = videoID
+			l.ListReplays()
+		},
+	}
+	cmdReplayList.Flags().StringVar(&videoID, "videoId", "", "指定回放对应的 videoId（默认自动获取）")
+
+	return cmdReplayList
+}
+
 // MergeCmd 合并下载的视频片段文件
 func MergeCmd() *cobra.Command {
 	var dstFileName string
@@ -168,6 +346,7 @@ func MergeCmd() *cobra.Command {
 func SlideCmd() *cobra.Command {
 	var s slide.Slide
 	var isSeries bool
+	var optimize bool
 	var qpdfBinPath string
 	var cmdSlide = &cobra.Command{
 		Use:   "slide [vid]",
@@ -180,12 +359,15 @@ func SlideCmd() *cobra.Command {
 				path = path + "/"
 			}
 			s.SaveDir = path
-			if qpdfBinPath != "" {
-				if qpdfBinPath[len(qpdfBinPath)-1:] != `\` && qpdfBinPath[len(qpdfBinPath)-1:] != "/" {
-					qpdfBinPath = qpdfBinPath + "/"
-				}
+			s.Optimize = optimize || qpdfBinPath != "" //兼容旧版本的 --qpdf-bin 参数
+			if s.Combine && !isSeries {
+				fmt.Println("--combine 参数仅在下载整个专题的课件（-s）时可用。")
+				return
+			}
+			if s.TOC && !s.Combine {
+				fmt.Println("--toc 参数仅在合并课件（--combine）时可用。")
+				return
 			}
-			s.QpdfPath = qpdfBinPath
 			if isSeries {
 				s.DownloadSeriesSlides()
 			} else {
@@ -195,25 +377,66 @@ func SlideCmd() *cobra.Command {
 	}
 	cmdSlide.Flags().StringVarP(&path, "path", "p", `.`, "指定保存课件的路径")
 	cmdSlide.Flags().BoolVarP(&isSeries, "series", "s", false, "指定是否下载整个专题的所有课件")
+	cmdSlide.Flags().BoolVar(&optimize, "optimize", false, "指定是否去除课件中的水印")
+	cmdSlide.Flags().BoolVar(&s.Combine, "combine", false, "指定是否将专题的所有课件合并为一个带书签的pdf文件")
+	cmdSlide.Flags().BoolVar(&s.TOC, "toc", false, "指定是否在合并后的pdf文件开头生成目录页")
+	cmdSlide.Flags().BoolVar(&s.Extract, "extract", false, "指定是否解压zip格式的课件")
+	cmdSlide.Flags().BoolVar(&s.Text, "text", false, "指定是否提取pdf课件中的文字，保存为同名的txt文件")
 	cmdSlide.Flags().StringVar(&qpdfBinPath, "qpdf-bin", "", "指定qpdf的bin文件夹所在的路径")
+	_ = cmdSlide.Flags().MarkDeprecated("qpdf-bin", "去除水印已不再依赖qpdf，请使用 --optimize")
 
 	return cmdSlide
 }
 
+// GrepCmd 在已下载的课件中搜索文字
+func GrepCmd() *cobra.Command {
+	var cmdGrep = &cobra.Command{
+		Use:   "grep <query> [dir]",
+		Short: "在已下载的课件中搜索文字",
+		Long:  `在指定文件夹（默认为当前文件夹）及其子文件夹中的pdf课件中搜索文字，同时匹配视频标题和讲者，输出匹配的报告、vid和页码. 尚未提取文字的课件会先提取文字并保存为同名的txt文件.`,
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			dir := "."
+			if len(args) == 2 {
+				dir = args[1]
+			}
+			slide.Search(args[0], dir)
+		},
+	}
+
+	return cmdGrep
+}
+
 // LoginCmd 通过短信验证码获取“蔻享学术”登录凭证
 func LoginCmd() *cobra.Command {
 	var u user.User
+	var cookiesFile string
 	var cmdLogin = &cobra.Command{
 		Use:   "login [phone number]",
 		Short: "通过短信验证码获取“蔻享学术”登录凭证",
-		Long:  `[phone number]参数为手机号码（格式15012345678），输入短信验证码以登录“蔻享学术”平台并将登录凭证保存至本地.登录后一周内免再次登录.`,
-		Args:  cobra.MinimumNArgs(1),
+		Long: `[phone number]参数为手机号码（格式15012345678），输入短信验证码以登录“蔻享学术”平台并将登录凭证保存至本地.登录后一周内免再次登录.
+使用 --cookies 参数时无需手机号码，从浏览器导出的cookie文件中导入登录凭证.`,
+		Args: cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			if cookiesFile != "" {
+				if err := u.ImportCookies(cookiesFile); err != nil {
+					fmt.Println("导入cookie失败：", err)
+				}
+				return
+			}
+			if len(args) == 0 {
+				fmt.Println("请指定手机号码，或使用 --cookies 参数导入浏览器的cookie文件。")
+				return
+			}
 			re := regexp.MustCompile(`1[3-9]\d{9}`)
 			if !re.MatchString(args[0]) {
 				fmt.Println("手机号码格式不正确")
 				return
 			}
+			if u.CodeFile != "" && u.CodeCmd != "" {
+				fmt.Println("--code-from-file 和 --code-cmd 参数只能指定其中一个。")
+				return
+			}
 			u.PhoneNumber = args[0]
 			if err := u.Login(); err != nil {
 				fmt.Println("登录失败：", err)
@@ -222,6 +445,11 @@ func LoginCmd() *cobra.Command {
 		},
 	}
 
+	cmdLogin.Flags().StringVar(&u.CodeFile, "code-from-file", "", "指定从文件读取短信验证码（等待文件在发送验证码后被写入）")
+	cmdLogin.Flags().BoolVar(&u.Encrypt, "encrypt", false, "指定是否使用口令加密保存登录凭证（可用环境变量 KOUSHARE_PASSPHRASE 指定口令）")
+	cmdLogin.Flags().StringVar(&cookiesFile, "cookies", "", "指定浏览器导出的Netscape格式的cookie文件（cookies.txt），从中导入登录凭证")
+	cmdLogin.Flags().StringVar(&u.CodeCmd, "code-cmd", "", "指定获取短信验证码的命令（命令可通过环境变量KOUSHARE_PHONE获取手机号码）")
+
 	return cmdLogin
 }
 
@@ -241,6 +469,319 @@ func LogoutCmd() *cobra.Command {
 	return cmdLogout
 }
 
+// WhoamiCmd 向服务器验证登录凭证并输出当前登录的账户信息
+func WhoamiCmd() *cobra.Command {
+	var cmdWhoami = &cobra.Command{
+		Use:   "whoami",
+		Short: "验证登录凭证并输出当前登录的账户",
+		Long:  `向“蔻享学术”服务器验证当前账户配置的登录凭证，并输出账户名称、手机号码（部分隐藏）和登录凭证的过期时间.`,
+		Args:  cobra.MinimumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			user.Whoami()
+		},
+	}
+
+	return cmdWhoami
+}
+
+// ProfilesCmd 管理账户配置
+func ProfilesCmd() *cobra.Command {
+	var cmdProfiles = &cobra.Command{
+		Use:   "profiles",
+		Short: "管理账户配置",
+		Long:  `管理账户配置.每个账户配置单独保存登录凭证，使用“ks --profile [name] login [phone number]”登录新的账户配置.`,
+	}
+	cmdProfiles.AddCommand(ProfilesListCmd())
+
+	return cmdProfiles
+}
+
+// ProfilesListCmd 列出全部账户配置及其登录状态，是profiles命令的子命令
+func ProfilesListCmd() *cobra.Command {
+	var cmdProfilesList = &cobra.Command{
+		Use:   "list",
+		Short: "列出全部账户配置及其登录状态",
+		Long:  `列出全部账户配置及其登录状态，当前使用的账户配置以“*”标出.`,
+		Args:  cobra.MinimumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, p := range user.Profiles() {
+				mark := " "
+				name := p.Name
+				if p.Current {
+					mark = "*"
+					name = color.Emphasize(name)
+				}
+				state := "未登录"
+				switch {
+				case p.LoginState == -1:
+					state = "凭证文件损坏"
+				case p.Encrypted:
+					state = "已登录（已加密）"
+				case p.LoginState == 1 && !p.Expires.IsZero() && p.Expires.Before(time.Now()):
+					state = "已登录（凭证可能已过期）"
+				case p.LoginState == 1 && !p.Expires.IsZero():
+					state = "已登录（有效期至 " + p.Expires.Format("2006-01-02") + "）"
+				case p.LoginState == 1:
+					state = "已登录"
+				}
+				fmt.Printf("%s %s\t%s\n", mark, name, state)
+			}
+		},
+	}
+
+	return cmdProfilesList
+}
+
+// ConfigCmd 查看和修改配置文件
+func ConfigCmd() *cobra.Command {
+	var cmdConfig = &cobra.Command{
+		Use:   "config",
+		Short: "查看和修改配置文件",
+		Long: `查看和修改配置文件（config.yaml），配置文件中的值用作未在命令行中指定的参数的默认值.
+优先级：命令行参数 > 环境变量 > 配置文件 > 默认值.`,
+	}
+	cmdConfig.AddCommand(ConfigGetCmd(), ConfigSetCmd(), ConfigUnsetCmd(), ConfigListCmd(), ConfigPathCmd())
+
+	return cmdConfig
+}
+
+// ConfigGetCmd 输出配置项的值，是config命令的子命令
+func ConfigGetCmd() *cobra.Command {
+	var cmdConfigGet = &cobra.Command{
+		Use:   "get [key]",
+		Short: "输出配置项的值",
+		Long:  `输出配置项的值，环境变量优先于配置文件.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, ok := config.LookupSetting(args[0]); !ok {
+				fmt.Printf("配置项 %s 不存在，可用的配置项：%s\n", args[0], settingKeys())
+				return
+			}
+			file, err := config.LoadFile()
+			if err != nil {
+				fmt.Println("读取配置文件失败：", err)
+				return
+			}
+			if value, _ := config.Lookup(args[0], file); value != "" {
+				fmt.Println(value)
+			}
+		},
+	}
+
+	return cmdConfigGet
+}
+
+// ConfigSetCmd 修改配置文件中的配置项，是config命令的子命令
+func ConfigSetCmd() *cobra.Command {
+	var cmdConfigSet = &cobra.Command{
+		Use:   "set [key] [value]",
+		Short: "修改配置文件中的配置项",
+		Long:  `修改配置文件中的配置项，配置文件不存在时会自动创建.`,
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			key, value := args[0], strings.TrimSpace(args[1])
+			if _, ok := config.LookupSetting(key); !ok {
+				fmt.Printf("配置项 %s 不存在，可用的配置项：%s\n", key, settingKeys())
+				return
+			}
+			if err := checkSetting(key, value); err != nil {
+				fmt.Println(err)
+				return
+			}
+			updateConfigFile(func(file map[string]string) { file[key] = value })
+			fmt.Printf("已设置 %s = %s\n", key, value)
+		},
+	}
+
+	return cmdConfigSet
+}
+
+// ConfigUnsetCmd 删除配置文件中的配置项，是config命令的子命令
+func ConfigUnsetCmd() *cobra.Command {
+	var cmdConfigUnset = &cobra.Command{
+		Use:   "unset [key]",
+		Short: "删除配置文件中的配置项",
+		Long:  `删除配置文件中的配置项，恢复使用默认值.`,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if _, ok := config.LookupSetting(args[0]); !ok {
+				fmt.Printf("配置项 %s 不存在，可用的配置项：%s\n", args[0], settingKeys())
+				return
+			}
+			updateConfigFile(func(file map[string]string) { delete(file, args[0]) })
+			fmt.Printf("已删除 %s\n", args[0])
+		},
+	}
+
+	return cmdConfigUnset
+}
+
+// ConfigListCmd 列出全部配置项及其值和来源，是config命令的子命令
+func ConfigListCmd() *cobra.Command {
+	var cmdConfigList = &cobra.Command{
+		Use:   "list",
+		Short: "列出全部配置项",
+		Long:  `列出全部配置项及其值和来源（环境变量或配置文件）.`,
+		Args:  cobra.MinimumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			file, err := config.LoadFile()
+			if err != nil {
+				fmt.Println("读取配置文件失败：", err)
+				return
+			}
+			for _, s := range config.Settings {
+				value, source := config.Lookup(s.Key, file)
+				if value == "" {
+					fmt.Printf("%-14s（未设置）\t%s\n", s.Key, s.Usage)
+				} else {
+					fmt.Printf("%-14s%s\t来自%s\n", s.Key, color.Emphasize(value), source)
+				}
+			}
+		},
+	}
+
+	return cmdConfigList
+}
+
+// ConfigPathCmd 输出配置文件的路径，是config命令的子命令
+func ConfigPathCmd() *cobra.Command {
+	var cmdConfigPath = &cobra.Command{
+		Use:   "path",
+		Short: "输出配置文件的路径",
+		Long:  `输出配置文件的路径，配置文件位于配置文件夹中，可使用 --config-dir 参数或环境变量 KOUSHARE_CONFIG_DIR 指定配置文件夹.`,
+		Args:  cobra.MinimumNArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Println(config.ConfigFile())
+		},
+	}
+
+	return cmdConfigPath
+}
+
+// ApplyConfig 将环境变量和配置文件中的值用于未在命令行中指定的参数，并检查各参数的值，有无效的值时返回false。
+// 优先级：命令行参数 > 环境变量 > 配置文件 > 默认值。
+func ApplyConfig(cmd *cobra.Command) bool {
+	if cmd.HasParent() && cmd.Parent().Name() == "config" { //config命令用于修改配置，不使用也不检查配置
+		return true
+	}
+	file, err := config.LoadFile()
+	if err != nil {
+		fmt.Printf("读取配置文件 %s 失败：%v\n", config.ConfigFile(), err)
+	}
+	for _, s := range config.Settings {
+		name := s.Key
+		if sf, ok := settingFlags[s.Key]; ok {
+			if !contains(sf.commands, topCommand(cmd).Name()) {
+				continue
+			}
+			name = sf.flag
+		}
+		f := cmd.Flags().Lookup(name)
+		if f == nil {
+			continue
+		}
+		source := "参数 --" + name
+		if !f.Changed {
+			var value string
+			if value, source = config.Lookup(s.Key, file); value == "" {
+				continue
+			}
+			source += " 中的 " + s.Key
+			if err = checkSetting(s.Key, value); err == nil {
+				err = f.Value.Set(value)
+			}
+		} else {
+			err = checkSetting(s.Key, f.Value.String())
+		}
+		if err != nil {
+			fmt.Printf("%s 无效：%v\n", source, err)
+			return false
+		}
+	}
+	return true
+}
+
+// settingFlags 为仅用于部分命令的配置项对应的参数名，以及使用这些配置项的命令。
+// path仅用于下载命令，clean等命令会删除文件，只使用命令行中指定的路径。
+var settingFlags = map[string]struct {
+	flag     string
+	commands []string
+}{
+	"video-quality": {"quality", []string{"save", "mine"}},
+	"live-quality":  {"quality", []string{"record"}},
+	"path":          {"path", []string{"save", "mine", "record", "slide"}},
+}
+
+// topCommand 返回cmd所属的ks的子命令，如ks mine purchased所属的mine
+func topCommand(cmd *cobra.Command) *cobra.Command {
+	for cmd.HasParent() && cmd.Parent().HasParent() {
+		cmd = cmd.Parent()
+	}
+	return cmd
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSetting 检查配置项的值是否有效，值为空时不做检查
+func checkSetting(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	switch key {
+	case "video-quality":
+		if value != "high" && value != "standard" && value != "low" {
+			return fmt.Errorf("清晰度只能为high、standard或low")
+		}
+	case "live-quality":
+		if value != "high" && value != "standard" {
+			return fmt.Errorf("清晰度只能为high或standard")
+		}
+	case "proxy":
+		if u, err := url.Parse(value); err != nil || u.Host == "" {
+			return fmt.Errorf("代理服务地址格式错误：%s", value)
+		}
+	case "retries":
+		if n, err := strconv.Atoi(value); err != nil || n < 0 {
+			return fmt.Errorf("重试次数应为非负整数")
+		}
+	case "rate-limit":
+		if _, err := proxy.ParseRate(value); err != nil {
+			return err
+		}
+	case "name-template":
+		return video.CheckNameTemplate(value)
+	}
+	return nil
+}
+
+// updateConfigFile 读取配置文件，使用update修改后写回
+func updateConfigFile(update func(file map[string]string)) {
+	file, err := config.LoadFile()
+	if err != nil {
+		fmt.Println("读取配置文件失败：", err)
+		return
+	}
+	update(file)
+	if err = config.SaveFile(file); err != nil {
+		fmt.Println("保存配置文件失败：", err)
+	}
+}
+
+func settingKeys() string {
+	keys := make([]string, len(config.Settings))
+	for i, s := range config.Settings {
+		keys[i] = s.Key
+	}
+	return strings.Join(keys, "、")
+}
+
 // CleanCmd 清理指定目录下的所有临时文件
 func CleanCmd() *cobra.Command {
 	var quiet bool
@@ -277,3 +818,18 @@ func CleanCmd() *cobra.Command {
 	cmdClean.Flags().BoolVarP(&quiet, "quiet", "q", false, "指定是否不输出清理过程中的信息")
 	return cmdClean
 }
+
+// parseClipRange 解析 --from 和 --to 参数，均未指定时返回0
+func parseClipRange(from, to string) (start, end time.Duration, err error) {
+	if from != "" {
+		if start, err = timecode.Parse(from); err != nil {
+			return 0, 0, fmt.Errorf("--from 参数错误：%v", err)
+		}
+	}
+	if to != "" {
+		if end, err = timecode.Parse(to); err != nil {
+			return 0, 0, fmt.Errorf("--to 参数错误：%v", err)
+		}
+	}
+	return start, end, timecode.CheckRange(start, end)
+}
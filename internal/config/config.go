@@ -1,6 +1,7 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strings"
 )
@@ -21,6 +22,10 @@ func init() {
 	if v := strings.TrimSpace(os.Getenv("KOUSHARE_LOGIN_BASE")); v != "" {
 		SetLoginBaseURL(v)
 	}
+	SetConfigDir(os.Getenv("KOUSHARE_CONFIG_DIR"))
+	if err := SetProfile(os.Getenv("KOUSHARE_PROFILE")); err != nil {
+		fmt.Println("环境变量 KOUSHARE_PROFILE 无效：", err)
+	}
 }
 
 func normalizeBaseURL(value string) string {
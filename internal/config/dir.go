@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// configDir 为通过 --config-dir 参数或环境变量 KOUSHARE_CONFIG_DIR 指定的配置文件夹
+var configDir string
+
+// ConfigDir 返回保存登录凭证等文件的文件夹。未指定时为用户配置文件夹下的koushare-dl文件夹，
+// 如 Linux 上的 ~/.config/koushare-dl、macOS 上的 ~/Library/Application Support/koushare-dl 和 Windows 上的 %AppData%\koushare-dl。
+func ConfigDir() string {
+	if configDir != "" {
+		return configDir
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "koushare-dl")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".koushare-dl")
+	}
+	return ".koushare-dl"
+}
+
+// SetConfigDir 指定配置文件夹，value为空时不做修改
+func SetConfigDir(value string) {
+	if v := strings.TrimSpace(value); v != "" {
+		configDir = v
+	}
+}
+
+// DefaultProfile 为默认账户配置的名字
+const DefaultProfile = "default"
+
+// profile 为通过 --profile 参数或环境变量 KOUSHARE_PROFILE 选择的账户配置
+var profile = DefaultProfile
+
+var profileNameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Profile 返回当前使用的账户配置的名字
+func Profile() string {
+	return profile
+}
+
+// SetProfile 选择账户配置，value为空时不做修改。名字只能包含字母、数字、“_”、“.”和“-”。
+func SetProfile(value string) error {
+	v := strings.TrimSpace(value)
+	if v == "" {
+		return nil
+	}
+	if !profileNameRegexp.MatchString(v) {
+		return fmt.Errorf("账户配置名\"%s\"无效，只能包含字母、数字、“_”、“.”和“-”", v)
+	}
+	profile = v
+	return nil
+}
+
+// ProfileDir 返回账户配置name的文件夹：默认账户配置使用配置文件夹本身，其它账户配置使用其中的profiles/<name>文件夹
+func ProfileDir(name string) string {
+	if name == DefaultProfile {
+		return ConfigDir()
+	}
+	return filepath.Join(ConfigDir(), "profiles", name)
+}
+
+// ProfileNames 返回已创建的账户配置（不含默认账户配置）
+func ProfileNames() []string {
+	entries, err := os.ReadDir(filepath.Join(ConfigDir(), "profiles"))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && profileNameRegexp.MatchString(e.Name()) && e.Name() != DefaultProfile {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
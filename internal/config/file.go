@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Setting 为配置文件中可以设置的一项，除video-quality和live-quality外Key与对应的命令行参数同名
+type Setting struct {
+	Key   string
+	Env   string // 对应的环境变量，优先于配置文件
+	Usage string
+}
+
+// Settings 为配置文件中可以设置的全部项
+var Settings = []Setting{
+	{"path", "KOUSHARE_PATH", "保存视频、课件和录制文件的路径"},
+	{"video-quality", "KOUSHARE_VIDEO_QUALITY", "下载视频的清晰度（high、standard或low）"},
+	{"live-quality", "KOUSHARE_LIVE_QUALITY", "录制直播的清晰度（high或standard）"},
+	{"proxy", "KOUSHARE_PROXY", "使用的http/https/socks5代理服务地址"},
+	{"ca-cert", "KOUSHARE_CA_CERT", "额外信任的CA证书文件（PEM格式）"},
+	{"api-base", "KOUSHARE_API_BASE", "蔻享 API Base"},
+	{"web-base", "KOUSHARE_WEB_BASE", "蔻享 Web Base"},
+	{"login-base", "KOUSHARE_LOGIN_BASE", "蔻享登录 API Base"},
+	{"retries", "KOUSHARE_RETRIES", "网络请求失败时的重试次数"},
+	{"rate-limit", "KOUSHARE_RATE_LIMIT", "下载速度上限（如2M表示2MB/s），0表示不限速"},
+	{"name-template", "KOUSHARE_NAME_TEMPLATE", "保存视频文件的文件名模板（如{vid}_{title}_{quality}）"},
+}
+
+// configFileName 为配置文件的文件名
+const configFileName = "config.yaml"
+
+// configFileHeader 为写入配置文件时添加的说明
+const configFileHeader = "# KouShare-dl 配置文件，可使用“ks config set <key> <value>”修改。\n# 优先级：命令行参数 > 环境变量 > 配置文件 > 默认值。\n"
+
+// LookupSetting 返回名为key的配置项
+func LookupSetting(key string) (Setting, bool) {
+	for _, s := range Settings {
+		if s.Key == key {
+			return s, true
+		}
+	}
+	return Setting{}, false
+}
+
+// ConfigFile 返回配置文件的路径，位于配置文件夹中，如 Linux 上的 ~/.config/koushare-dl/config.yaml
+func ConfigFile() string {
+	return filepath.Join(ConfigDir(), configFileName)
+}
+
+// LoadFile 读取配置文件，文件不存在时返回空的map
+func LoadFile() (map[string]string, error) {
+	values := make(map[string]string)
+	data, err := os.ReadFile(ConfigFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("配置文件格式错误：%w", err)
+	}
+	if values == nil { //文件为空
+		values = make(map[string]string)
+	}
+	return values, nil
+}
+
+// SaveFile 将values写入配置文件，值为空的项不会被写入
+func SaveFile(values map[string]string) error {
+	keys := make([]string, 0, len(values))
+	for key, value := range values {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var b bytes.Buffer
+	b.WriteString(configFileHeader)
+	for _, key := range keys {
+		node := yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: key},
+			{Kind: yaml.ScalarNode, Value: values[key], Tag: "!!str"},
+		}}
+		line, err := yaml.Marshal(&node)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+	}
+	if err := os.MkdirAll(ConfigDir(), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(ConfigFile(), b.Bytes(), 0600)
+}
+
+// Lookup 返回配置项key的值及其来源（环境变量名或配置文件），均未设置时返回空字符串
+func Lookup(key string, file map[string]string) (value, source string) {
+	if s, ok := LookupSetting(key); ok && s.Env != "" {
+		if v := strings.TrimSpace(os.Getenv(s.Env)); v != "" {
+			return v, "环境变量 " + s.Env
+		}
+	}
+	if v := file[key]; v != "" {
+		return v, "配置文件"
+	}
+	return "", ""
+}
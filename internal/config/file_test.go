@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestConfigFile(t *testing.T) {
+	SetConfigDir(t.TempDir())
+	t.Setenv("KOUSHARE_VIDEO_QUALITY", "")
+
+	values, err := LoadFile()
+	if err != nil || len(values) != 0 {
+		t.Fatalf("LoadFile() = %v, %v; want an empty map", values, err)
+	}
+	values["video-quality"] = "low"
+	values["name-template"] = "{vid}: {title}"
+	values["path"] = ""
+	if err = SaveFile(values); err != nil {
+		t.Fatal(err)
+	}
+	if values, err = LoadFile(); err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values["video-quality"] != "low" || values["name-template"] != "{vid}: {title}" {
+		t.Errorf("LoadFile() = %v", values)
+	}
+
+	if v, source := Lookup("video-quality", values); v != "low" || source != "配置文件" {
+		t.Errorf("Lookup() = %q, %q", v, source)
+	}
+	t.Setenv("KOUSHARE_VIDEO_QUALITY", "standard")
+	if v, source := Lookup("video-quality", values); v != "standard" || source != "环境变量 KOUSHARE_VIDEO_QUALITY" {
+		t.Errorf("Lookup() = %q, %q; the environment variable should take precedence", v, source)
+	}
+	if v, _ := Lookup("path", values); v != "" {
+		t.Errorf("Lookup(path) = %q, want empty", v)
+	}
+}
@@ -0,0 +1,144 @@
+package pdf
+
+import (
+	"unicode/utf16"
+)
+
+// cmap 为字体的ToUnicode映射，将字符编码转换为Unicode文字
+type cmap struct {
+	codespaces []codespace
+	chars      map[string]string // 以编码的原始字节为键
+	ranges     []bfrange
+}
+
+// codespace 为一段编码空间，用于确定每个字符编码的字节数
+type codespace struct {
+	low, high []byte
+}
+
+// bfrange 将编码范围[low, high]映射为连续的文字，或逐个映射为dst中的文字
+type bfrange struct {
+	low, high []byte
+	start     []uint16 // dst为空时，low对应的UTF-16编码，后续编码依次递增最后一个码元
+	dst       []string
+}
+
+// parseCMap 解析ToUnicode流中的codespacerange、bfchar和bfrange
+func parseCMap(data []byte) *cmap {
+	ops, _ := ParseContent(data) // 出错时使用已解析的部分
+	m := &cmap{chars: make(map[string]string)}
+	for _, op := range ops {
+		switch op.Operator {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(op.Operands); i += 2 {
+				low, ok1 := op.Operands[i].(String)
+				high, ok2 := op.Operands[i+1].(String)
+				if ok1 && ok2 && len(low) == len(high) && len(low) > 0 {
+					m.codespaces = append(m.codespaces, codespace{low, high})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(op.Operands); i += 2 {
+				src, ok1 := op.Operands[i].(String)
+				dst, ok2 := op.Operands[i+1].(String)
+				if ok1 && ok2 {
+					m.chars[string(src)] = decodeUTF16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(op.Operands); i += 3 {
+				low, ok1 := op.Operands[i].(String)
+				high, ok2 := op.Operands[i+1].(String)
+				if !ok1 || !ok2 || len(low) != len(high) {
+					continue
+				}
+				r := bfrange{low: low, high: high}
+				switch dst := op.Operands[i+2].(type) {
+				case String:
+					r.start = utf16Units(dst)
+				case Array:
+					for _, e := range dst {
+						s, _ := e.(String)
+						r.dst = append(r.dst, decodeUTF16BE(s))
+					}
+				default:
+					continue
+				}
+				m.ranges = append(m.ranges, r)
+			}
+		}
+	}
+	return m
+}
+
+// codeLength 返回s开头的字符编码的字节数，无法确定时返回0
+func (m *cmap) codeLength(s []byte) int {
+	for _, cs := range m.codespaces {
+		n := len(cs.low)
+		if n > len(s) {
+			continue
+		}
+		in := true
+		for i := 0; i < n; i++ {
+			if s[i] < cs.low[i] || s[i] > cs.high[i] {
+				in = false
+				break
+			}
+		}
+		if in {
+			return n
+		}
+	}
+	return 0
+}
+
+// lookup 返回编码code对应的文字
+func (m *cmap) lookup(code []byte) (string, bool) {
+	if s, ok := m.chars[string(code)]; ok {
+		return s, true
+	}
+	for _, r := range m.ranges {
+		if len(code) != len(r.low) || string(code) < string(r.low) || string(code) > string(r.high) {
+			continue
+		}
+		offset := int(codeValue(code) - codeValue(r.low))
+		if r.dst != nil {
+			if offset < len(r.dst) {
+				return r.dst[offset], true
+			}
+			continue
+		}
+		if len(r.start) == 0 {
+			continue
+		}
+		units := append([]uint16(nil), r.start...)
+		units[len(units)-1] += uint16(offset)
+		return string(utf16.Decode(units)), true
+	}
+	return "", false
+}
+
+func codeValue(code []byte) uint32 {
+	var v uint32
+	for _, c := range code {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+func utf16Units(s String) []uint16 {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return units
+}
+
+// decodeUTF16BE 解码UTF-16BE编码的文字，忽略开头的BOM
+func decodeUTF16BE(s String) string {
+	units := utf16Units(s)
+	if len(units) > 0 && units[0] == 0xfeff {
+		units = units[1:]
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+)
+
+// Operation 表示内容流中的一条指令，如"/F1 12 Tf"的Operator为"Tf"，Operands为[/F1 12]。
+// 内嵌图像（BI ... ID ... EI）的Operator为"BI"，Operands为图像字典和原始图像数据。
+type Operation struct {
+	Operator string
+	Operands []Object
+}
+
+// ParseContent 解析内容流
+func ParseContent(data []byte) ([]Operation, error) {
+	p := &parser{data: data}
+	var ops []Operation
+	var operands []Object
+	for {
+		p.skipSpace()
+		if p.eof() {
+			break
+		}
+		o, err := p.object(false)
+		if err != nil {
+			return nil, err
+		}
+		kw, ok := o.(Keyword)
+		if !ok || kw == "{" || kw == "}" {
+			operands = append(operands, o)
+			continue
+		}
+		if kw == "BI" {
+			img, err := p.inlineImage()
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, img)
+			operands = nil
+			continue
+		}
+		ops = append(ops, Operation{Operator: string(kw), Operands: operands})
+		operands = nil
+	}
+	return ops, nil
+}
+
+// inlineImage 解析BI之后的图像字典和ID与EI之间的图像数据
+func (p *parser) inlineImage() (Operation, error) {
+	dict := make(Dict)
+	for {
+		o, err := p.object(false)
+		if err != nil {
+			return Operation{}, err
+		}
+		if o == Keyword("ID") {
+			break
+		}
+		key, ok := o.(Name)
+		if !ok {
+			return Operation{}, errors.New("pdf: 内嵌图像的字典无效")
+		}
+		if dict[key], err = p.object(false); err != nil {
+			return Operation{}, err
+		}
+	}
+	p.pos++ // ID后的单个空白字符
+	start := p.pos
+	for i := start; i+2 <= len(p.data); i++ {
+		// EI前后均应为空白字符
+		if p.data[i] == 'E' && p.data[i+1] == 'I' && i > start && isWhitespace(p.data[i-1]) &&
+			(i+2 == len(p.data) || isWhitespace(p.data[i+2]) || isDelimiter(p.data[i+2])) {
+			p.pos = i + 2
+			return Operation{Operator: "BI", Operands: []Object{dict, String(p.data[start : i-1])}}, nil
+		}
+	}
+	return Operation{}, errors.New("pdf: 内嵌图像缺少 EI")
+}
+
+// FormatContent 将指令序列化为内容流
+func FormatContent(ops []Operation) []byte {
+	var b []byte
+	for _, op := range ops {
+		if op.Operator == "BI" && len(op.Operands) == 2 {
+			b = append(b, "BI"...)
+			dict, _ := op.Operands[0].(Dict)
+			for k, v := range dict {
+				b = append(b, ' ')
+				b = appendName(b, k)
+				b = append(b, ' ')
+				b = appendObject(b, v, nil)
+			}
+			data, _ := op.Operands[1].(String)
+			b = append(b, " ID "...)
+			b = append(b, data...)
+			b = append(b, "\nEI\n"...)
+			continue
+		}
+		for _, o := range op.Operands {
+			b = appendObject(b, o, nil)
+			b = append(b, ' ')
+		}
+		b = append(b, op.Operator...)
+		b = append(b, '\n')
+	}
+	return bytes.TrimSuffix(b, []byte("\n"))
+}
@@ -0,0 +1,187 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+// Decode 按/Filter解码流数据，仅支持内容流和交叉引用流中常见的几种编码
+func (s *Stream) Decode() ([]byte, error) {
+	var filters, params Array
+	switch f := s.Dict["Filter"].(type) {
+	case Name:
+		filters = Array{f}
+		params = Array{s.Dict["DecodeParms"]}
+	case Array:
+		filters = f
+		params, _ = s.Dict["DecodeParms"].(Array)
+	}
+
+	data := s.Data
+	for i, f := range filters {
+		var param Dict
+		if i < len(params) {
+			param, _ = params[i].(Dict)
+		}
+		var err error
+		switch f {
+		case Name("FlateDecode"), Name("Fl"):
+			if data, err = inflate(data); err == nil {
+				data, err = unpredict(data, param)
+			}
+		case Name("ASCIIHexDecode"), Name("AHx"):
+			data, err = decodeASCIIHex(data)
+		case Name("ASCII85Decode"), Name("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			return nil, fmt.Errorf("pdf: 不支持的编码 %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// SetData 使用FlateDecode编码data并替换流的内容
+func (s *Stream) SetData(data []byte) {
+	var b bytes.Buffer
+	w, _ := zlib.NewWriterLevel(&b, zlib.BestCompression)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	s.Data = b.Bytes()
+	s.Dict["Filter"] = Name("FlateDecode")
+	delete(s.Dict, "DecodeParms")
+	delete(s.Dict, "DL")
+}
+
+// NewStream 创建一个使用FlateDecode编码的流对象
+func NewStream(dict Dict, data []byte) *Stream {
+	if dict == nil {
+		dict = make(Dict)
+	}
+	s := &Stream{Dict: dict}
+	s.SetData(data)
+	return s
+}
+
+// inflate 解压zlib数据。部分文件的数据末尾损坏，此时返回已解压的内容。
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("pdf: 解压流失败：%v", err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("pdf: 解压流失败：%v", err)
+	}
+	return out, nil
+}
+
+// unpredict 还原FlateDecode的PNG预测器
+func unpredict(data []byte, param Dict) ([]byte, error) {
+	predictor, _ := Int(param["Predictor"])
+	if predictor <= 1 {
+		return data, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("pdf: 不支持的预测器 %d", predictor)
+	}
+	colors, bpc, columns := 1, 8, 1
+	if v, ok := Int(param["Colors"]); ok && v > 0 {
+		colors = v
+	}
+	if v, ok := Int(param["BitsPerComponent"]); ok && v > 0 {
+		bpc = v
+	}
+	if v, ok := Int(param["Columns"]); ok && v > 0 {
+		columns = v
+	}
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (columns*colors*bpc + 7) / 8
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for len(data) > 0 {
+		n := rowLen + 1
+		if n > len(data) {
+			n = len(data)
+		}
+		kind, row := data[0], append([]byte(nil), data[1:n]...)
+		data = data[n:]
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("pdf: 无效的PNG预测类型 %d", kind)
+			}
+		}
+		out = append(out, row...)
+		copy(prev, row)
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, len(digits)/2)
+	_, err := hex.Decode(out, digits)
+	return out, err
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	return out[:n], err
+}
@@ -0,0 +1,148 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// font 将字符串中的字符编码转换为文字
+type font struct {
+	toUnicode *cmap
+	composite bool      // Type0字体，字符编码通常为2字节
+	utf16     bool      // Type0字体使用UCS2或UTF16编码（如UniGB-UTF16-H），编码即为UTF-16BE
+	encoding  [256]rune // 简单字体的编码表，0表示无法转换
+}
+
+// loadFont 读取字体字典
+func (d *Document) loadFont(o Object) *font {
+	f := &font{encoding: winAnsiEncoding}
+	dict, ok := d.Resolve(o).(Dict)
+	if !ok {
+		return f
+	}
+	if s, ok := d.Resolve(dict["ToUnicode"]).(*Stream); ok {
+		if data, err := s.Decode(); err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+	if dict.Name("Subtype") == "Type0" {
+		f.composite = true
+		enc := string(dict.Name("Encoding"))
+		f.utf16 = strings.Contains(enc, "UCS2") || strings.Contains(enc, "UTF16")
+		return f
+	}
+
+	switch enc := d.Resolve(dict["Encoding"]).(type) {
+	case Name:
+		f.setBaseEncoding(enc)
+	case Dict:
+		f.setBaseEncoding(enc.Name("BaseEncoding"))
+		differences, _ := d.Resolve(enc["Differences"]).(Array)
+		code := 0
+		for _, e := range differences {
+			switch v := e.(type) {
+			case int64:
+				code = int(v)
+			case Name:
+				if code >= 0 && code < 256 {
+					f.encoding[code] = glyphRune(string(v))
+				}
+				code++
+			}
+		}
+	}
+	return f
+}
+
+func (f *font) setBaseEncoding(name Name) {
+	switch name {
+	case "MacRomanEncoding", "StandardEncoding":
+		// 仅ASCII部分与WinAnsiEncoding一致，其余字符较少出现在课件中
+		for i := 128; i < 256; i++ {
+			f.encoding[i] = 0
+		}
+	}
+}
+
+// decode 将字符串转换为文字
+func (f *font) decode(s String) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		n := 1
+		if f.toUnicode != nil {
+			n = f.toUnicode.codeLength(s[i:])
+		}
+		if n == 0 {
+			n = 1
+			if f.composite {
+				n = 2
+			}
+		}
+		if i+n > len(s) {
+			break
+		}
+		code := s[i : i+n]
+		i += n
+		if f.toUnicode != nil {
+			if text, ok := f.toUnicode.lookup(code); ok {
+				b.WriteString(text)
+				continue
+			}
+		}
+		switch {
+		case f.utf16:
+			b.WriteString(decodeUTF16BE(code))
+		case !f.composite && n == 1:
+			if r := f.encoding[code[0]]; r != 0 {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// winAnsiEncoding 为WinAnsiEncoding编码表：0x80~0x9F为Windows-1252中的标点符号，其余与Latin-1相同
+var winAnsiEncoding = func() [256]rune {
+	var enc [256]rune
+	for i := 32; i < 256; i++ {
+		enc[i] = rune(i)
+	}
+	for i, r := range []rune("€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ") {
+		enc[0x80+i] = r
+	}
+	enc[127] = 0
+	return enc
+}()
+
+// glyphNames 为Differences中常见的字形名
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$', "percent": '%',
+	"ampersand": '&', "quotesingle": '\'', "quoteright": '’', "quoteleft": '‘', "parenleft": '(', "parenright": ')',
+	"asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-', "minus": '−', "period": '.', "slash": '/',
+	"zero": '0', "one": '1', "two": '2', "three": '3', "four": '4', "five": '5', "six": '6', "seven": '7',
+	"eight": '8', "nine": '9', "colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\', "bracketright": ']', "asciicircum": '^',
+	"underscore": '_', "grave": '`', "braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"bullet": '•', "endash": '–', "emdash": '—', "quotedblleft": '“', "quotedblright": '”', "ellipsis": '…',
+	"degree": '°', "plusminus": '±', "multiply": '×', "divide": '÷', "mu": 'μ', "fi": 'ﬁ', "fl": 'ﬂ',
+	"alpha": 'α', "beta": 'β', "gamma": 'γ', "delta": 'δ', "epsilon": 'ε', "theta": 'θ', "lambda": 'λ',
+	"pi": 'π', "sigma": 'σ', "tau": 'τ', "phi": 'φ', "omega": 'ω', "Delta": 'Δ', "Omega": 'Ω',
+}
+
+// glyphRune 将字形名转换为文字，如"A"、"comma"和"uni4E2D"
+func glyphRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 {
+		return rune(name[0])
+	}
+	for _, prefix := range []string{"uni", "u"} {
+		if strings.HasPrefix(name, prefix) && len(name) >= len(prefix)+4 {
+			if v, err := strconv.ParseUint(name[len(prefix):len(prefix)+4], 16, 32); err == nil {
+				return rune(v)
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,294 @@
+package pdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// maxDepth 限制数组和字典的嵌套深度，防止损坏的文件造成栈溢出
+const maxDepth = 256
+
+var errUnexpectedEOF = errors.New("pdf: 文件意外结束")
+
+// parser 从data中的pos处开始解析PDF对象
+type parser struct {
+	data []byte
+	pos  int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.data)
+}
+
+// skipSpace 跳过空白字符和注释
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '%' {
+			for p.pos < len(p.data) && p.data[p.pos] != '\r' && p.data[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if !isWhitespace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// regular 读取由常规字符组成的一段文本
+func (p *parser) regular() []byte {
+	start := p.pos
+	for p.pos < len(p.data) && !isWhitespace(p.data[p.pos]) && !isDelimiter(p.data[p.pos]) {
+		p.pos++
+	}
+	return p.data[start:p.pos]
+}
+
+// keyword 读取下一个关键字，不是关键字时不移动位置并返回空字符串
+func (p *parser) keyword() string {
+	p.skipSpace()
+	start := p.pos
+	if w := p.regular(); len(w) != 0 && (w[0] < '0' || w[0] > '9') && w[0] != '+' && w[0] != '-' && w[0] != '.' {
+		return string(w)
+	}
+	p.pos = start
+	return ""
+}
+
+// integer 读取一个非负整数，失败时不移动位置
+func (p *parser) integer() (int64, bool) {
+	p.skipSpace()
+	start := p.pos
+	w := p.regular()
+	v, err := strconv.ParseInt(string(w), 10, 64)
+	if err != nil || len(w) == 0 || w[0] == '+' || w[0] == '-' {
+		p.pos = start
+		return 0, false
+	}
+	return v, true
+}
+
+// object 解析下一个对象。refs为true时将"n g R"解析为间接引用（内容流中没有间接引用）。
+func (p *parser) object(refs bool) (Object, error) {
+	return p.parse(refs, 0)
+}
+
+func (p *parser) parse(refs bool, depth int) (Object, error) {
+	if depth > maxDepth {
+		return nil, errors.New("pdf: 对象嵌套过深")
+	}
+	p.skipSpace()
+	if p.eof() {
+		return nil, errUnexpectedEOF
+	}
+	switch c := p.data[p.pos]; c {
+	case '/':
+		p.pos++
+		return p.name(), nil
+	case '(':
+		p.pos++
+		return p.literalString()
+	case '<':
+		if p.pos+1 < len(p.data) && p.data[p.pos+1] == '<' {
+			p.pos += 2
+			return p.dict(refs, depth)
+		}
+		p.pos++
+		return p.hexString()
+	case '[':
+		p.pos++
+		var a Array
+		for {
+			p.skipSpace()
+			if p.eof() {
+				return nil, errUnexpectedEOF
+			}
+			if p.data[p.pos] == ']' {
+				p.pos++
+				return a, nil
+			}
+			o, err := p.parse(refs, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, o)
+		}
+	case ']', '>', ')', '{', '}':
+		p.pos++
+		if c == '{' || c == '}' { // 仅出现在PostScript函数中，作为关键字返回
+			return Keyword(c), nil
+		}
+		return nil, fmt.Errorf("pdf: 位置 %d 处出现意外的字符 %q", p.pos-1, c)
+	}
+
+	start := p.pos
+	w := p.regular()
+	if len(w) == 0 {
+		p.pos++
+		return nil, fmt.Errorf("pdf: 位置 %d 处出现无效的字符", start)
+	}
+	if c := w[0]; (c >= '0' && c <= '9') || c == '+' || c == '-' || c == '.' {
+		if bytes.IndexByte(w, '.') < 0 {
+			if v, err := strconv.ParseInt(string(w), 10, 64); err == nil {
+				if refs && v >= 0 {
+					save := p.pos
+					if gen, ok := p.integer(); ok && p.keyword() == "R" {
+						return Ref{int(v), int(gen)}, nil
+					}
+					p.pos = save
+				}
+				return v, nil
+			}
+		}
+		if v, err := strconv.ParseFloat(string(w), 64); err == nil {
+			return v, nil
+		}
+		return int64(0), nil // 与多数阅读器一致，将无法识别的数字视为0
+	}
+	switch string(w) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return Keyword(w), nil
+}
+
+func (p *parser) name() Name {
+	w := p.regular()
+	if bytes.IndexByte(w, '#') < 0 {
+		return Name(w)
+	}
+	var b []byte
+	for i := 0; i < len(w); i++ {
+		if w[i] == '#' && i+2 < len(w) {
+			if v, err := strconv.ParseUint(string(w[i+1:i+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, w[i])
+	}
+	return Name(b)
+}
+
+func (p *parser) literalString() (Object, error) {
+	var b []byte
+	depth := 1
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return String(b), nil
+			}
+		case '\r': // 字符串中的行尾统一视为\n
+			if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+				p.pos++
+			}
+			c = '\n'
+		case '\\':
+			if p.pos >= len(p.data) {
+				return nil, errUnexpectedEOF
+			}
+			c = p.data[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.data) && p.data[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.data[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return nil, errUnexpectedEOF
+}
+
+func (p *parser) hexString() (Object, error) {
+	end := bytes.IndexByte(p.data[p.pos:], '>')
+	if end < 0 {
+		return nil, errUnexpectedEOF
+	}
+	digits := make([]byte, 0, end+1)
+	for _, c := range p.data[p.pos : p.pos+end] {
+		if !isWhitespace(c) {
+			digits = append(digits, c)
+		}
+	}
+	p.pos += end + 1
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	if _, err := hex.Decode(b, digits); err != nil {
+		return nil, fmt.Errorf("pdf: 无效的十六进制字符串：%v", err)
+	}
+	return String(b), nil
+}
+
+func (p *parser) dict(refs bool, depth int) (Object, error) {
+	d := make(Dict)
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, errUnexpectedEOF
+		}
+		if p.data[p.pos] == '>' {
+			if p.pos+1 < len(p.data) && p.data[p.pos+1] == '>' {
+				p.pos += 2
+				return d, nil
+			}
+			return nil, fmt.Errorf("pdf: 位置 %d 处的字典未正确结束", p.pos)
+		}
+		if p.data[p.pos] != '/' {
+			// 跳过损坏的键，尽量读出字典的其余部分
+			if _, err := p.parse(refs, depth+1); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		p.pos++
+		key := p.name()
+		v, err := p.parse(refs, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil { // 值为null的键等同于不存在
+			d[key] = v
+		}
+	}
+}
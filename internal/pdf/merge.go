@@ -0,0 +1,181 @@
+package pdf
+
+import (
+	"errors"
+	"unicode/utf16"
+)
+
+// Merger 将多个PDF文件的页面依次合并为一个文件，并可以为合并后的页面添加书签
+type Merger struct {
+	doc      *Document
+	pages    Ref
+	kids     Array
+	outlines []outlineItem
+}
+
+type outlineItem struct {
+	title string
+	page  Ref
+}
+
+// NewMerger 创建一个空的Merger
+func NewMerger() *Merger {
+	m := &Merger{doc: New()}
+	m.pages = m.doc.Add(nil) // 页面树的根节点在写出时生成
+	return m
+}
+
+// PageCount 返回已合并的页数
+func (m *Merger) PageCount() int {
+	return len(m.kids)
+}
+
+// Add 向合并结果中添加一个间接对象，如插入页面所需的字体
+func (m *Merger) Add(o Object) Ref {
+	return m.doc.Add(o)
+}
+
+// InsertPage 在第at页（从0开始）之前插入一个页面，已添加的书签仍指向原来的页面
+func (m *Merger) InsertPage(at int, page Dict) {
+	page["Type"] = Name("Page")
+	page["Parent"] = m.pages
+	m.kids = append(m.kids[:at], append(Array{m.doc.Add(page)}, m.kids[at:]...)...)
+}
+
+// PageRef 返回第i页（从0开始）的引用，可用于链接等需要指向页面的场合
+func (m *Merger) PageRef(i int) Ref {
+	return m.kids[i].(Ref)
+}
+
+// Append 将src的全部页面添加到末尾，返回其中第一页的页码（从0开始）
+func (m *Merger) Append(src *Document) (int, error) {
+	pages, err := src.Pages()
+	if err != nil {
+		return 0, err
+	}
+	if len(pages) == 0 {
+		return 0, errors.New("pdf: 文件中没有页面")
+	}
+
+	// 预先为所有页面分配新的对象号，使注释、链接等指向原文件页面的引用指向合并后的页面，而不会复制原文件的页面树
+	mapping := make(map[int]Ref)
+	newRefs := make([]Ref, len(pages))
+	for i, p := range pages {
+		newRefs[i] = m.doc.Add(nil)
+		if p.Ref.Num != 0 {
+			mapping[p.Ref.Num] = newRefs[i]
+		}
+	}
+	first := len(m.kids)
+	for i, p := range pages {
+		page := make(Dict, len(p.Dict))
+		for k, v := range p.Dict {
+			if k == "Parent" {
+				continue
+			}
+			page[k] = m.doc.importObject(src, v, mapping)
+		}
+		page["Parent"] = m.pages
+		m.doc.Set(newRefs[i], page)
+		m.kids = append(m.kids, newRefs[i])
+	}
+	return first, nil
+}
+
+// importObject 将src中的对象o连同其引用的全部对象复制到d中，mapping记录已复制对象的新引用
+func (d *Document) importObject(src *Document, o Object, mapping map[int]Ref) Object {
+	switch v := o.(type) {
+	case Ref:
+		if r, ok := mapping[v.Num]; ok {
+			return r
+		}
+		r := d.Add(nil)
+		mapping[v.Num] = r
+		obj, _ := src.Object(v.Num)
+		d.Set(r, d.importObject(src, obj, mapping))
+		return r
+	case Array:
+		a := make(Array, len(v))
+		for i, e := range v {
+			a[i] = d.importObject(src, e, mapping)
+		}
+		return a
+	case Dict:
+		dict := make(Dict, len(v))
+		for k, e := range v {
+			dict[k] = d.importObject(src, e, mapping)
+		}
+		return dict
+	case *Stream:
+		return &Stream{Dict: d.importObject(src, v.Dict, mapping).(Dict), Data: v.Data}
+	}
+	return o
+}
+
+// AddOutline 添加一个指向第page页（从0开始）的顶层书签
+func (m *Merger) AddOutline(title string, page int) {
+	m.outlines = append(m.outlines, outlineItem{title, m.PageRef(page)})
+}
+
+// finish 生成页面树、书签和文档目录
+func (m *Merger) finish() {
+	m.doc.Set(m.pages, Dict{"Type": Name("Pages"), "Kids": m.kids, "Count": int64(len(m.kids))})
+	catalog := Dict{"Type": Name("Catalog"), "Pages": m.pages}
+
+	if len(m.outlines) != 0 {
+		root := m.doc.Add(nil)
+		items := make([]Ref, len(m.outlines))
+		for i := range items {
+			items[i] = m.doc.Add(nil)
+		}
+		for i, item := range m.outlines {
+			dict := Dict{
+				"Title":  TextString(item.title),
+				"Parent": root,
+				"Dest":   Array{item.page, Name("Fit")},
+			}
+			if i > 0 {
+				dict["Prev"] = items[i-1]
+			}
+			if i+1 < len(items) {
+				dict["Next"] = items[i+1]
+			}
+			m.doc.Set(items[i], dict)
+		}
+		m.doc.Set(root, Dict{"Type": Name("Outlines"), "First": items[0], "Last": items[len(items)-1], "Count": int64(len(items))})
+		catalog["Outlines"] = root
+		catalog["PageMode"] = Name("UseOutlines") // 打开文件时显示书签栏
+	}
+	m.doc.Trailer["Root"] = m.doc.Add(catalog)
+}
+
+// WriteFile 将合并结果写入fileName
+func (m *Merger) WriteFile(fileName string) error {
+	m.finish()
+	return m.doc.WriteFile(fileName)
+}
+
+// TextString 将s编码为PDF文本字符串：仅含ASCII字符时原样保存，否则使用带BOM的UTF-16BE编码
+func TextString(s string) String {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+	return append(String{0xfe, 0xff}, UTF16BE(s)...)
+}
+
+// UTF16BE 将s编码为UTF-16BE（不含BOM），用于以UniGB-UTF16-H等编码显示文字
+func UTF16BE(s string) String {
+	units := utf16.Encode([]rune(s))
+	b := make(String, 0, 2*len(units))
+	for _, u := range units {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return b
+}
@@ -0,0 +1,170 @@
+// Package pdf 实现了读写PDF文件所需的最小功能：解析对象、交叉引用表（含交叉引用流、对象流和增量更新），
+// 修改对象后重新生成完整的PDF文件，以及解析页面内容流。
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Object 表示一个PDF对象，可能的类型为：
+// nil（null）、bool、int64、float64、String、Name、Array、Dict、*Stream、Ref，
+// 以及仅在内容流中出现的Keyword（操作符）
+type Object interface{}
+
+// Name 表示名字对象，不含开头的"/"
+type Name string
+
+// String 表示字符串对象，字面量形式和十六进制形式均解析为原始字节
+type String []byte
+
+// Keyword 表示内容流中的操作符等关键字
+type Keyword string
+
+// Array 表示数组对象
+type Array []Object
+
+// Dict 表示字典对象
+type Dict map[Name]Object
+
+// Ref 表示间接对象的引用
+type Ref struct {
+	Num, Gen int
+}
+
+// Stream 表示流对象，Data为按Dict中/Filter编码后的数据
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Name 返回字典中key对应的名字，不是名字时返回空字符串
+func (d Dict) Name(key Name) Name {
+	n, _ := d[key].(Name)
+	return n
+}
+
+// Int 将整数或实数对象转换为int，其他类型返回false
+func Int(o Object) (int, bool) {
+	switch v := o.(type) {
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	}
+	return 0, false
+}
+
+// Float 将整数或实数对象转换为float64，其他类型返回false
+func Float(o Object) (float64, bool) {
+	switch v := o.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// appendObject 将对象序列化后追加到b，ref不为nil时用于替换间接引用的对象号
+func appendObject(b []byte, o Object, ref func(Ref) Ref) []byte {
+	switch v := o.(type) {
+	case nil:
+		return append(b, "null"...)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case int:
+		return strconv.AppendInt(b, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case float64:
+		return strconv.AppendFloat(b, v, 'f', -1, 64)
+	case Name:
+		return appendName(b, v)
+	case String:
+		return appendString(b, v)
+	case Keyword:
+		return append(b, v...)
+	case Array:
+		b = append(b, '[')
+		for i, e := range v {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+			b = appendObject(b, e, ref)
+		}
+		return append(b, ']')
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		b = append(b, "<<"...)
+		for _, k := range keys {
+			b = appendName(b, Name(k))
+			b = append(b, ' ')
+			b = appendObject(b, v[Name(k)], ref)
+		}
+		return append(b, ">>"...)
+	case *Stream:
+		dict := make(Dict, len(v.Dict)+1)
+		for k, e := range v.Dict {
+			dict[k] = e
+		}
+		dict["Length"] = int64(len(v.Data))
+		b = appendObject(b, dict, ref)
+		b = append(b, "\nstream\n"...)
+		b = append(b, v.Data...)
+		return append(b, "\nendstream"...)
+	case Ref:
+		if ref != nil {
+			v = ref(v)
+		}
+		return append(b, fmt.Sprintf("%d %d R", v.Num, v.Gen)...)
+	}
+	panic(fmt.Sprintf("pdf: 无法序列化 %T 类型的对象", o))
+}
+
+func appendName(b []byte, n Name) []byte {
+	b = append(b, '/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < 0x21 || c > 0x7e || c == '#' || isDelimiter(c) {
+			b = append(b, fmt.Sprintf("#%02X", c)...)
+		} else {
+			b = append(b, c)
+		}
+	}
+	return b
+}
+
+func appendString(b []byte, s String) []byte {
+	b = append(b, '(')
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			b = append(b, '\\', c)
+		case '\r':
+			b = append(b, `\r`...)
+		default:
+			b = append(b, c)
+		}
+	}
+	return append(b, ')')
+}
+
+// Format 返回对象序列化后的文本，主要用于调试和测试
+func Format(o Object) string {
+	return string(appendObject(nil, o, nil))
+}
+
+func isWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
@@ -0,0 +1,80 @@
+package pdf
+
+import "errors"
+
+// Page 表示文件中的一页
+type Page struct {
+	Ref  Ref
+	Dict Dict
+}
+
+// inheritable 为可以从页面树的上级节点继承的属性
+var inheritable = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// Pages 按顺序返回文件中的所有页面。从上级节点继承的属性会被复制到页面字典中，
+// 因此返回的页面字典可以脱离原来的页面树单独使用。
+func (d *Document) Pages() ([]Page, error) {
+	catalog, ok := d.Resolve(d.Trailer["Root"]).(Dict)
+	if !ok {
+		return nil, errors.New("pdf: 无效的文档目录")
+	}
+	var pages []Page
+	visited := make(map[int]bool)
+	var walk func(node Object, inherited Dict) error
+	walk = func(node Object, inherited Dict) error {
+		ref, _ := node.(Ref)
+		if ref.Num != 0 {
+			if visited[ref.Num] {
+				return errors.New("pdf: 页面树中存在循环引用")
+			}
+			visited[ref.Num] = true
+		}
+		dict, ok := d.Resolve(node).(Dict)
+		if !ok {
+			return nil // 跳过损坏的节点
+		}
+
+		attrs := make(Dict, len(inheritable))
+		for _, k := range inheritable {
+			if v, ok := dict[k]; ok {
+				attrs[k] = v
+			} else if v, ok := inherited[k]; ok {
+				attrs[k] = v
+			}
+		}
+		kids, isNode := d.Resolve(dict["Kids"]).(Array)
+		if dict.Name("Type") == "Page" || (!isNode && dict.Name("Type") != "Pages") {
+			for k, v := range attrs {
+				dict[k] = v
+			}
+			pages = append(pages, Page{Ref: ref, Dict: dict})
+			return nil
+		}
+		for _, kid := range kids {
+			if err := walk(kid, attrs); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(catalog["Pages"], nil); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
+
+// Contents 返回页面的全部内容流。/Contents可以是单个流，也可以是流的数组。
+func (d *Document) Contents(p Page) []*Stream {
+	var streams []*Stream
+	switch v := d.Resolve(p.Dict["Contents"]).(type) {
+	case *Stream:
+		streams = append(streams, v)
+	case Array:
+		for _, e := range v {
+			if s, ok := d.Resolve(e).(*Stream); ok {
+				streams = append(streams, s)
+			}
+		}
+	}
+	return streams
+}
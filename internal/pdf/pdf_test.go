@@ -0,0 +1,356 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testObjects 为一个两页的文件：两页共用同一个水印内容流，MediaBox和Resources从页面树的根节点继承
+var testObjects = map[int]string{
+	1: "<< /Type /Catalog /Pages 2 0 R >>",
+	2: "<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /MediaBox [0 0 612 792] /Resources << /Font << /F1 7 0 R >> >> >>",
+	3: "<< /Type /Page /Parent 2 0 R /Contents [5 0 R 6 0 R] >>",
+	4: "<< /Type /Page /Parent 2 0 R /Contents [8 0 R 6 0 R] /Rotate 90 >>",
+	5: streamObject("BT /F1 12 Tf (Hello) Tj ET"),
+	6: streamObject("q BT /F1 48 Tf 1 0 0 1 100 100 Tm (WATERMARK) Tj ET Q"),
+	7: "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	8: streamObject("BT /F1 12 Tf (World) Tj ET"),
+}
+
+func streamObject(content string) string {
+	return fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content)
+}
+
+// buildPDF 生成使用普通交叉引用表的文件
+func buildPDF(objects map[int]string, trailer string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := writeObjects(&b, objects)
+	writeXrefTable(&b, offsets, trailer)
+	return b.Bytes()
+}
+
+func writeObjects(b *bytes.Buffer, objects map[int]string) map[int]int {
+	offsets := make(map[int]int)
+	for num := 1; num <= 64; num++ {
+		if o, ok := objects[num]; ok {
+			offsets[num] = b.Len()
+			fmt.Fprintf(b, "%d 0 obj\n%s\nendobj\n", num, o)
+		}
+	}
+	return offsets
+}
+
+func writeXrefTable(b *bytes.Buffer, offsets map[int]int, trailer string) {
+	start := b.Len()
+	b.WriteString("xref\n0 1\n0000000000 65535 f \n")
+	for num := 1; num <= 64; num++ {
+		if off, ok := offsets[num]; ok {
+			fmt.Fprintf(b, "%d 1\n%010d 00000 n \n", num, off)
+		}
+	}
+	fmt.Fprintf(b, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer, start)
+}
+
+func deflate(data []byte) []byte {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	_, _ = w.Write(data)
+	_ = w.Close()
+	return b.Bytes()
+}
+
+// checkXref 确认文件的交叉引用可以直接读取，而不是经扫描重建后才能打开
+func checkXref(t *testing.T, data []byte) {
+	t.Helper()
+	d := New()
+	d.data = data
+	if err := d.readXrefChain(); err != nil {
+		t.Fatalf("readXrefChain: %v", err)
+	}
+}
+
+func checkTestDocument(t *testing.T, doc *Document, firstText string) {
+	t.Helper()
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages, want 2", len(pages))
+	}
+	if got := Format(pages[0].Dict["MediaBox"]); got != "[0 0 612 792]" {
+		t.Errorf("inherited MediaBox = %s", got)
+	}
+	if _, ok := doc.Resolve(pages[1].Dict["Resources"]).(Dict); !ok {
+		t.Error("page 2 did not inherit Resources")
+	}
+	if rotate, _ := Int(pages[1].Dict["Rotate"]); rotate != 90 {
+		t.Errorf("page 2 Rotate = %d", rotate)
+	}
+	contents := doc.Contents(pages[0])
+	if len(contents) != 2 {
+		t.Fatalf("page 1 has %d content streams, want 2", len(contents))
+	}
+	data, err := contents[0].Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), firstText) {
+		t.Errorf("page 1 content = %q, want it to contain %q", data, firstText)
+	}
+	if doc.Contents(pages[1])[1] != contents[1] {
+		t.Error("the shared watermark stream should be the same object on both pages")
+	}
+}
+
+func TestOpenXrefTable(t *testing.T) {
+	data := buildPDF(testObjects, "<< /Size 9 /Root 1 0 R >>")
+	checkXref(t, data)
+	doc, err := Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestDocument(t, doc, "(Hello)")
+}
+
+func TestOpenIncrementalUpdate(t *testing.T) {
+	var b bytes.Buffer
+	b.Write(buildPDF(testObjects, "<< /Size 9 /Root 1 0 R >>"))
+	prev := bytes.LastIndex(b.Bytes(), []byte("\nxref\n")) + 1
+	// 增量更新替换了第一页的内容流
+	offsets := writeObjects(&b, map[int]string{5: streamObject("BT /F1 12 Tf (Updated) Tj ET")})
+	writeXrefTable(&b, offsets, fmt.Sprintf("<< /Size 9 /Root 1 0 R /Prev %d >>", prev))
+
+	checkXref(t, b.Bytes())
+	doc, err := Open(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestDocument(t, doc, "(Updated)")
+}
+
+func TestOpenObjectAndXrefStreams(t *testing.T) {
+	// 对象1~4和7保存在对象流9中，交叉引用流10使用PNG预测器
+	var header, body bytes.Buffer
+	inStream := []int{1, 2, 3, 4, 7}
+	for _, num := range inStream {
+		fmt.Fprintf(&header, "%d %d ", num, body.Len())
+		body.WriteString(testObjects[num] + "\n")
+	}
+	objStm := append(header.Bytes(), body.Bytes()...)
+	objects := map[int]string{
+		5: testObjects[5],
+		6: testObjects[6],
+		8: testObjects[8],
+		9: fmt.Sprintf("<< /Type /ObjStm /N %d /First %d /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+			len(inStream), header.Len(), len(deflate(objStm)), deflate(objStm)),
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n")
+	offsets := writeObjects(&b, objects)
+	xrefOffset := b.Len()
+
+	var rows, prev []byte
+	row := make([]byte, 7)
+	for num := 0; num <= 10; num++ {
+		for i := range row {
+			row[i] = 0
+		}
+		switch {
+		case num == 10:
+			row[0] = 1
+			binary.BigEndian.PutUint32(row[1:], uint32(xrefOffset))
+		case offsets[num] != 0:
+			row[0] = 1
+			binary.BigEndian.PutUint32(row[1:], uint32(offsets[num]))
+		default:
+			for i, n := range inStream {
+				if n == num {
+					row[0] = 2
+					binary.BigEndian.PutUint32(row[1:], 9)
+					binary.BigEndian.PutUint16(row[5:], uint16(i))
+				}
+			}
+		}
+		// PNG Up预测器：每行之前为类型字节2，数据为与上一行的差
+		rows = append(rows, 2)
+		for i := range row {
+			var up byte
+			if prev != nil {
+				up = prev[i]
+			}
+			rows = append(rows, row[i]-up)
+		}
+		prev = append(prev[:0], row...)
+	}
+	data := deflate(rows)
+	fmt.Fprintf(&b, "10 0 obj\n<< /Type /XRef /Size 11 /W [1 4 2] /Root 1 0 R /Filter /FlateDecode "+
+		"/DecodeParms << /Predictor 12 /Columns 7 >> /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(data), data)
+	fmt.Fprintf(&b, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+
+	checkXref(t, b.Bytes())
+	doc, err := Open(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestDocument(t, doc, "(Hello)")
+}
+
+func TestOpenReconstruct(t *testing.T) {
+	data := buildPDF(testObjects, "<< /Size 9 /Root 1 0 R >>")
+	// 破坏startxref的位置，使交叉引用表无法使用
+	i := bytes.LastIndex(data, []byte("startxref\n"))
+	data = append(data[:i:i], "startxref\n12345\n%%EOF\n"...)
+	doc, err := Open(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTestDocument(t, doc, "(Hello)")
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	doc, err := Open(buildPDF(testObjects, "<< /Size 9 /Root 1 0 R >>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, _ := doc.Pages()
+	doc.Contents(pages[0])[0].SetData([]byte("BT /F1 12 Tf (Rewritten) Tj ET"))
+
+	var b bytes.Buffer
+	if err = doc.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkXref(t, b.Bytes())
+	checkTestDocument(t, reopened, "(Rewritten)")
+}
+
+func TestEncrypted(t *testing.T) {
+	_, err := Open(buildPDF(testObjects, "<< /Size 9 /Root 1 0 R /Encrypt << /Filter /Standard >> >>"))
+	if err != ErrEncrypted {
+		t.Errorf("Open = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestParseContent(t *testing.T) {
+	content := "q 1 0 0 1 72.5 -3 cm /Im1 Do BT /F1 12 Tf (a \\(b\\) c) Tj [<48 65> -120 (llo)] TJ ET\n" +
+		"BI /W 2 /H 1 /BPC 8 /CS /G ID \x00\xff\nEI Q"
+	ops, err := ParseContent([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var operators []string
+	for _, op := range ops {
+		operators = append(operators, op.Operator)
+	}
+	if got := strings.Join(operators, " "); got != "q cm Do BT Tf Tj TJ ET BI Q" {
+		t.Fatalf("operators = %s", got)
+	}
+	if got := Format(Array(ops[1].Operands)); got != "[1 0 0 1 72.5 -3]" {
+		t.Errorf("cm operands = %s", got)
+	}
+	if got := string(ops[5].Operands[0].(String)); got != "a (b) c" {
+		t.Errorf("Tj operand = %q", got)
+	}
+	if got := string(ops[8].Operands[1].(String)); got != "\x00\xff" {
+		t.Errorf("inline image data = %q", got)
+	}
+
+	again, err := ParseContent(FormatContent(ops))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(ops) || Format(Array(again[6].Operands)) != Format(Array(ops[6].Operands)) {
+		t.Errorf("FormatContent did not round-trip: %q", FormatContent(ops))
+	}
+}
+
+func TestMerger(t *testing.T) {
+	m := NewMerger()
+	for i := 0; i < 2; i++ {
+		doc, err := Open(buildPDF(testObjects, "<< /Size 9 /Root 1 0 R >>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, err := m.Append(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.AddOutline(fmt.Sprintf("第%d讲", i+1), first)
+	}
+	m.InsertPage(0, Dict{"MediaBox": Array{int64(0), int64(0), int64(595), int64(842)}})
+	if m.PageCount() != 5 {
+		t.Fatalf("PageCount = %d, want 5", m.PageCount())
+	}
+	m.finish()
+
+	var b bytes.Buffer
+	if err := m.doc.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	checkXref(t, b.Bytes())
+	merged, err := Open(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := merged.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 5 {
+		t.Fatalf("got %d pages, want 5", len(pages))
+	}
+	if merged.Contents(pages[2])[1] != merged.Contents(pages[1])[1] {
+		t.Error("the watermark stream shared within one file should still be shared")
+	}
+
+	catalog := merged.Resolve(merged.Trailer["Root"]).(Dict)
+	outlines := merged.Resolve(catalog["Outlines"]).(Dict)
+	second := merged.Resolve(merged.Resolve(outlines["First"]).(Dict)["Next"]).(Dict)
+	if got := string(second["Title"].(String)); got != string(TextString("第2讲")) {
+		t.Errorf("second outline title = %q", got)
+	}
+	dest := merged.Resolve(second["Dest"]).(Array)
+	if dest[0] != pages[3].Ref {
+		t.Errorf("second outline points to %v, want page 4 %v", dest[0], pages[3].Ref)
+	}
+}
+
+func TestText(t *testing.T) {
+	toUnicode := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"1 begincodespacerange <0000> <FFFF> endcodespacerange\n" +
+		"2 beginbfchar <0001> <76F8> <0002> <56FE> endbfchar\n" +
+		"1 beginbfrange <0010> <0012> <0041> endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end"
+	objects := map[int]string{
+		1: "<< /Type /Catalog /Pages 2 0 R >>",
+		2: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		3: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents [4 0 R 9 0 R] " +
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> /XObject << /Fm0 8 0 R >> >> >>",
+		4: streamObject("BT /F1 24 Tf 72 700 Td (Phase) Tj 80 0 Td (diagram) Tj 0 -30 Td [(Wor) -20 (ld) -400 (peace)] TJ ET " +
+			"BT /F2 12 Tf 1 0 0 1 72 600 Tm <00010002> Tj <00100011 0012> Tj ET /Fm0 Do"),
+		5: "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding << /Differences [65 /uni4E2D /endash] >> >>",
+		6: "<< /Type /Font /Subtype /Type0 /BaseFont /Song /Encoding /Identity-H /ToUnicode 7 0 R >>",
+		7: streamObject(toUnicode),
+		8: "<< /Type /XObject /Subtype /Form /BBox [0 0 100 100] /Length 31 >>\nstream\nBT /F1 10 Tf 0 0 Td (AB) Tj ET\nendstream",
+		9: streamObject("BT /F1 0 Tf 1 0 0 1 100 100 Tm (KouShare) Tj ET"),
+	}
+	doc, err := Open(buildPDF(objects, "<< /Size 10 /Root 1 0 R >>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, _ := doc.Pages()
+	want := "Phase diagram\nWorld peace\n相图ABC\n中–"
+	if got := doc.Text(pages[0]); got != want {
+		t.Errorf("Text = %q, want %q", got, want)
+	}
+}
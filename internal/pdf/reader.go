@@ -0,0 +1,488 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+)
+
+// ErrEncrypted 表示文件已加密，本包不支持解密
+var ErrEncrypted = errors.New("pdf: 不支持加密的PDF文件")
+
+// xrefEntry 为交叉引用表中的一项。typ为1时对象位于文件的offset处；typ为2时对象位于对象流stream中的第index个位置。
+type xrefEntry struct {
+	typ    byte
+	offset int64
+	gen    int
+	stream int
+	index  int
+}
+
+// objectStream 为解码后的对象流
+type objectStream struct {
+	data    []byte
+	offsets []int // 各对象在data中的位置
+}
+
+// Document 表示一个PDF文件。对象在首次访问时才被解析，修改后的对象保存在缓存中，调用Write时写出。
+type Document struct {
+	Trailer Dict
+
+	version string
+	data    []byte
+	xref    map[int]xrefEntry
+	objects map[int]Object
+	streams map[int]*objectStream
+	loading map[int]bool // 正在解析的对象，用于发现循环引用
+	maxNum  int
+}
+
+// New 创建一个空白的PDF文件
+func New() *Document {
+	return &Document{
+		Trailer: make(Dict),
+		version: "1.7",
+		xref:    make(map[int]xrefEntry),
+		objects: make(map[int]Object),
+		streams: make(map[int]*objectStream),
+		loading: make(map[int]bool),
+	}
+}
+
+// ReadFile 读取并解析PDF文件
+func ReadFile(fileName string) (*Document, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return Open(data)
+}
+
+var headerRe = regexp.MustCompile(`%PDF-(\d\.\d)`)
+
+// Open 解析内存中的PDF文件。交叉引用表损坏时会扫描整个文件重建。
+func Open(data []byte) (*Document, error) {
+	d := New()
+	d.data = data
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	m := headerRe.FindSubmatch(head)
+	if m == nil {
+		return nil, errors.New("pdf: 不是PDF文件")
+	}
+	d.version = string(m[1])
+
+	if err := d.readXrefChain(); err != nil || d.Trailer["Root"] == nil {
+		d.xref = make(map[int]xrefEntry)
+		d.Trailer = make(Dict)
+		if err := d.reconstruct(); err != nil {
+			return nil, err
+		}
+	}
+	if d.Trailer["Encrypt"] != nil {
+		return nil, ErrEncrypted
+	}
+	for num := range d.xref {
+		if num > d.maxNum {
+			d.maxNum = num
+		}
+	}
+	return d, nil
+}
+
+// readXrefChain 从startxref开始，沿/Prev读取全部交叉引用表。较新的表先被读取，因此其中的项优先。
+func (d *Document) readXrefChain() error {
+	i := bytes.LastIndex(d.data, []byte("startxref"))
+	if i < 0 {
+		return errors.New("pdf: 未找到 startxref")
+	}
+	p := &parser{data: d.data, pos: i + len("startxref")}
+	off, ok := p.integer()
+	if !ok {
+		return errors.New("pdf: 无效的 startxref")
+	}
+
+	visited := make(map[int64]bool)
+	for {
+		if off <= 0 || off >= int64(len(d.data)) || visited[off] {
+			return errors.New("pdf: 无效的交叉引用表位置")
+		}
+		visited[off] = true
+		trailer, err := d.readXref(off)
+		if err != nil {
+			return err
+		}
+		if xrefStm, ok := Int(trailer["XRefStm"]); ok { // 混合引用文件中，交叉引用流补充了表中没有的对象
+			if _, err := d.readXref(int64(xrefStm)); err != nil {
+				return err
+			}
+		}
+		for k, v := range trailer {
+			if _, ok := d.Trailer[k]; !ok {
+				d.Trailer[k] = v
+			}
+		}
+		prev, ok := Int(trailer["Prev"])
+		if !ok {
+			break
+		}
+		off = int64(prev)
+	}
+	for _, k := range []Name{"Prev", "XRefStm", "Type", "W", "Index", "Filter", "DecodeParms", "Length"} {
+		delete(d.Trailer, k)
+	}
+	return nil
+}
+
+func (d *Document) setEntry(num int, e xrefEntry) {
+	if _, ok := d.xref[num]; !ok && num > 0 {
+		d.xref[num] = e
+	}
+}
+
+// readXref 读取off处的交叉引用表或交叉引用流，返回其trailer字典
+func (d *Document) readXref(off int64) (Dict, error) {
+	p := &parser{data: d.data, pos: int(off)}
+	if p.keyword() != "xref" {
+		return d.readXrefStream(off)
+	}
+	for {
+		start, ok := p.integer()
+		if !ok {
+			break
+		}
+		count, ok := p.integer()
+		if !ok {
+			return nil, errors.New("pdf: 交叉引用表损坏")
+		}
+		for i := int64(0); i < count; i++ {
+			offset, ok1 := p.integer()
+			gen, ok2 := p.integer()
+			kind := p.keyword()
+			if !ok1 || !ok2 || (kind != "n" && kind != "f") {
+				return nil, errors.New("pdf: 交叉引用表损坏")
+			}
+			if kind == "n" {
+				d.setEntry(int(start+i), xrefEntry{typ: 1, offset: offset, gen: int(gen)})
+			} else {
+				d.setEntry(int(start+i), xrefEntry{})
+			}
+		}
+	}
+	if p.keyword() != "trailer" {
+		return nil, errors.New("pdf: 未找到 trailer")
+	}
+	o, err := p.object(true)
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := o.(Dict)
+	if !ok {
+		return nil, errors.New("pdf: 无效的 trailer")
+	}
+	return trailer, nil
+}
+
+func (d *Document) readXrefStream(off int64) (Dict, error) {
+	_, o, err := d.parseIndirect(off)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := o.(*Stream)
+	if !ok || s.Dict.Name("Type") != "XRef" {
+		return nil, errors.New("pdf: 无效的交叉引用流")
+	}
+	data, err := s.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	var w [3]int
+	widths, _ := s.Dict["W"].(Array)
+	if len(widths) != 3 {
+		return nil, errors.New("pdf: 交叉引用流缺少 /W")
+	}
+	for i := range w {
+		if w[i], _ = Int(widths[i]); w[i] < 0 || w[i] > 8 {
+			return nil, errors.New("pdf: 交叉引用流的 /W 无效")
+		}
+	}
+	index, _ := s.Dict["Index"].(Array)
+	if index == nil {
+		size, _ := Int(s.Dict["Size"])
+		index = Array{int64(0), int64(size)}
+	}
+
+	field := func(b []byte, def int64) int64 {
+		if len(b) == 0 {
+			return def
+		}
+		var v int64
+		for _, c := range b {
+			v = v<<8 | int64(c)
+		}
+		return v
+	}
+	rowLen := w[0] + w[1] + w[2]
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := Int(index[i])
+		count, _ := Int(index[i+1])
+		for j := 0; j < count; j++ {
+			if len(data) < rowLen || rowLen == 0 {
+				return s.Dict, nil
+			}
+			row := data[:rowLen]
+			data = data[rowLen:]
+			kind := field(row[:w[0]], 1)
+			f2, f3 := field(row[w[0]:w[0]+w[1]], 0), field(row[w[0]+w[1]:], 0)
+			switch kind {
+			case 1:
+				d.setEntry(start+j, xrefEntry{typ: 1, offset: f2, gen: int(f3)})
+			case 2:
+				d.setEntry(start+j, xrefEntry{typ: 2, stream: int(f2), index: int(f3)})
+			default:
+				d.setEntry(start+j, xrefEntry{})
+			}
+		}
+	}
+	return s.Dict, nil
+}
+
+// parseIndirect 解析off处的"n g obj ... endobj"
+func (d *Document) parseIndirect(off int64) (Ref, Object, error) {
+	if off < 0 || off >= int64(len(d.data)) {
+		return Ref{}, nil, fmt.Errorf("pdf: 对象位置 %d 超出文件范围", off)
+	}
+	p := &parser{data: d.data, pos: int(off)}
+	num, ok1 := p.integer()
+	gen, ok2 := p.integer()
+	if !ok1 || !ok2 || p.keyword() != "obj" {
+		return Ref{}, nil, fmt.Errorf("pdf: 位置 %d 处不是对象", off)
+	}
+	o, err := p.object(true)
+	if err != nil {
+		return Ref{}, nil, err
+	}
+	ref := Ref{int(num), int(gen)}
+	dict, ok := o.(Dict)
+	if !ok {
+		return ref, o, nil
+	}
+	save := p.pos
+	if p.keyword() != "stream" {
+		p.pos = save
+		return ref, o, nil
+	}
+	// stream关键字后为\r\n或\n
+	if p.pos < len(d.data) && d.data[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(d.data) && d.data[p.pos] == '\n' {
+		p.pos++
+	}
+	start := p.pos
+	length := -1
+	if l, ok := Int(dict["Length"]); ok {
+		length = l
+	} else if r, ok := dict["Length"].(Ref); ok && !d.loading[r.Num] {
+		length, _ = Int(d.Resolve(r))
+	}
+	// 长度有误时，以endstream的位置为准
+	end := start + length
+	if length < 0 || end > len(d.data) || !bytes.HasPrefix(bytes.TrimLeft(d.data[end:], "\r\n \t"), []byte("endstream")) {
+		i := bytes.Index(d.data[start:], []byte("endstream"))
+		if i < 0 {
+			return ref, nil, errors.New("pdf: 未找到 endstream")
+		}
+		end = start + i
+		if end > start && d.data[end-1] == '\n' {
+			end--
+		}
+		if end > start && d.data[end-1] == '\r' {
+			end--
+		}
+	}
+	return ref, &Stream{Dict: dict, Data: d.data[start:end]}, nil
+}
+
+// Object 返回编号为num的对象，对象不存在时返回nil
+func (d *Document) Object(num int) (Object, error) {
+	if o, ok := d.objects[num]; ok {
+		return o, nil
+	}
+	e, ok := d.xref[num]
+	if !ok || e.typ == 0 {
+		return nil, nil
+	}
+	if d.loading[num] {
+		return nil, fmt.Errorf("pdf: 对象 %d 存在循环引用", num)
+	}
+	d.loading[num] = true
+	defer delete(d.loading, num)
+
+	var o Object
+	var err error
+	switch e.typ {
+	case 1:
+		var ref Ref
+		if ref, o, err = d.parseIndirect(e.offset); err == nil && ref.Num != num {
+			err = fmt.Errorf("pdf: 交叉引用表中对象 %d 的位置有误", num)
+		}
+	case 2:
+		o, err = d.objectFromStream(e.stream, e.index)
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.objects[num] = o
+	return o, nil
+}
+
+func (d *Document) objectFromStream(num, index int) (Object, error) {
+	stm, ok := d.streams[num]
+	if !ok {
+		o, err := d.Object(num)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := o.(*Stream)
+		if !ok || s.Dict.Name("Type") != "ObjStm" {
+			return nil, fmt.Errorf("pdf: 对象 %d 不是对象流", num)
+		}
+		data, err := s.Decode()
+		if err != nil {
+			return nil, err
+		}
+		n, _ := Int(s.Dict["N"])
+		first, _ := Int(s.Dict["First"])
+		if first < 0 || first > len(data) {
+			return nil, fmt.Errorf("pdf: 对象流 %d 的 /First 无效", num)
+		}
+		stm = &objectStream{data: data}
+		p := &parser{data: data[:first]}
+		for i := 0; i < n; i++ {
+			_, ok1 := p.integer()
+			off, ok2 := p.integer()
+			if !ok1 || !ok2 {
+				break
+			}
+			stm.offsets = append(stm.offsets, first+int(off))
+		}
+		d.streams[num] = stm
+	}
+	if index < 0 || index >= len(stm.offsets) || stm.offsets[index] > len(stm.data) {
+		return nil, fmt.Errorf("pdf: 对象流 %d 中没有第 %d 个对象", num, index)
+	}
+	p := &parser{data: stm.data, pos: stm.offsets[index]}
+	return p.object(true)
+}
+
+// Resolve 解析间接引用，返回其指向的对象；o不是间接引用时原样返回。对象损坏时返回nil。
+func (d *Document) Resolve(o Object) Object {
+	for i := 0; i < 32; i++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o
+		}
+		o, _ = d.Object(ref.Num)
+	}
+	return nil
+}
+
+// Set 替换编号为ref.Num的对象
+func (d *Document) Set(ref Ref, o Object) {
+	d.objects[ref.Num] = o
+	if ref.Num > d.maxNum {
+		d.maxNum = ref.Num
+	}
+}
+
+// Add 添加一个新的间接对象并返回其引用
+func (d *Document) Add(o Object) Ref {
+	d.maxNum++
+	d.objects[d.maxNum] = o
+	return Ref{Num: d.maxNum}
+}
+
+var objRe = regexp.MustCompile(`(?m)(\d+)[ \t\r\n\f]+(\d+)[ \t\r\n\f]+obj\b`)
+
+// reconstruct 在交叉引用表损坏时扫描整个文件，根据"n g obj"重建交叉引用表
+func (d *Document) reconstruct() error {
+	for _, m := range objRe.FindAllSubmatchIndex(d.data, -1) {
+		if m[0] > 0 && !isWhitespace(d.data[m[0]-1]) && !isDelimiter(d.data[m[0]-1]) {
+			continue
+		}
+		num, _ := strconv.Atoi(string(d.data[m[2]:m[3]]))
+		gen, _ := strconv.Atoi(string(d.data[m[4]:m[5]]))
+		d.xref[num] = xrefEntry{typ: 1, offset: int64(m[0]), gen: gen} // 文件后部的对象是增量更新的结果，覆盖前面的同号对象
+	}
+
+	var objStms []int
+	for num := range d.xref {
+		o, err := d.Object(num)
+		if err != nil {
+			delete(d.objects, num)
+			continue
+		}
+		switch v := o.(type) {
+		case *Stream:
+			if v.Dict.Name("Type") == "ObjStm" {
+				objStms = append(objStms, num)
+			}
+		case Dict:
+			if v.Name("Type") == "Catalog" {
+				d.Trailer["Root"] = Ref{Num: num, Gen: d.xref[num].gen}
+			}
+		}
+	}
+	for _, num := range objStms {
+		s := d.objects[num].(*Stream)
+		n, _ := Int(s.Dict["N"])
+		data, err := s.Decode()
+		if err != nil {
+			continue
+		}
+		first, _ := Int(s.Dict["First"])
+		if first > len(data) {
+			continue
+		}
+		p := &parser{data: data[:first]}
+		for i := 0; i < n; i++ {
+			objNum, ok := p.integer()
+			if _, ok2 := p.integer(); !ok || !ok2 {
+				break
+			}
+			if _, exists := d.xref[int(objNum)]; !exists {
+				d.xref[int(objNum)] = xrefEntry{typ: 2, stream: num, index: i}
+				if o, err := d.Object(int(objNum)); err == nil {
+					if dict, ok := o.(Dict); ok && dict.Name("Type") == "Catalog" && d.Trailer["Root"] == nil {
+						d.Trailer["Root"] = Ref{Num: int(objNum)}
+					}
+				}
+			}
+		}
+	}
+
+	// 沿用文件中最后一个trailer的Info和ID
+	if i := bytes.LastIndex(d.data, []byte("trailer")); i >= 0 {
+		p := &parser{data: d.data, pos: i + len("trailer")}
+		if o, err := p.object(true); err == nil {
+			if t, ok := o.(Dict); ok {
+				for _, k := range []Name{"Info", "ID", "Encrypt", "Root"} {
+					if v, ok := t[k]; ok && (k != "Root" || d.Trailer["Root"] == nil) {
+						d.Trailer[k] = v
+					}
+				}
+			}
+		}
+	}
+	if d.Trailer["Root"] == nil {
+		return errors.New("pdf: 文件损坏，未找到文档目录")
+	}
+	return nil
+}
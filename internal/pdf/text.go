@@ -0,0 +1,190 @@
+package pdf
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFormDepth 限制表单XObject的嵌套层数
+const maxFormDepth = 8
+
+// Text 提取页面中的文字。文字按其在内容流中出现的顺序输出，根据文字位置的变化推断换行和空格；
+// 字号为0的文字（如已隐藏的水印）不可见，会被忽略。
+func (d *Document) Text(p Page) string {
+	t := &textExtractor{d: d, fonts: make(map[Ref]*font)}
+	var data []byte
+	for _, s := range d.Contents(p) {
+		if b, err := s.Decode(); err == nil {
+			data = append(append(data, b...), '\n')
+		}
+	}
+	t.run(data, d.Resolve(p.Dict["Resources"]), 0)
+	return strings.TrimSpace(t.b.String())
+}
+
+// textExtractor 记录解释内容流时的文字状态
+type textExtractor struct {
+	d       *Document
+	fonts   map[Ref]*font
+	b       strings.Builder
+	font    *font
+	size    float64
+	x, y    float64 // 当前行的起点
+	leading float64 // 行距（TL）
+	lastY   float64 // 上一段文字所在行的纵坐标
+	moved   bool    // 上一段文字之后位置是否发生了变化
+	newLine bool    // 上一段文字之后是否换行（T*、'、"）
+	shown   bool    // 是否已输出文字
+}
+
+func (t *textExtractor) run(data []byte, resources Object, depth int) {
+	ops, _ := ParseContent(data) // 内容流损坏时使用已解析的部分
+	res, _ := resources.(Dict)
+	fonts, _ := t.d.Resolve(res["Font"]).(Dict)
+	for _, op := range ops {
+		args := op.Operands
+		switch op.Operator {
+		case "BT":
+			t.x, t.y = 0, 0
+			t.moved = true
+		case "Tf":
+			if len(args) == 2 {
+				name, _ := args[0].(Name)
+				t.font = t.loadFont(fonts[name])
+				t.size, _ = Float(args[1])
+			}
+		case "TL":
+			if len(args) == 1 {
+				t.leading, _ = Float(args[0])
+			}
+		case "Td", "TD":
+			if len(args) == 2 {
+				tx, _ := Float(args[0])
+				ty, _ := Float(args[1])
+				if op.Operator == "TD" {
+					t.leading = -ty
+				}
+				t.moveTo(t.x+tx, t.y+ty)
+			}
+		case "Tm":
+			if len(args) == 6 {
+				e, _ := Float(args[4])
+				f, _ := Float(args[5])
+				t.moveTo(e, f)
+			}
+		case "T*":
+			t.nextLine()
+		case "Tj":
+			if len(args) == 1 {
+				t.show(args[0])
+			}
+		case "'", "\"":
+			if len(args) > 0 {
+				t.nextLine()
+				t.show(args[len(args)-1])
+			}
+		case "TJ":
+			if len(args) == 1 {
+				items, _ := args[0].(Array)
+				for _, item := range items {
+					if v, ok := Float(item); ok && v < -250 { // 较大的间距通常表示单词之间的空格
+						t.moved = true
+						continue
+					}
+					t.show(item)
+				}
+			}
+		case "Do":
+			if len(args) == 1 && depth < maxFormDepth {
+				t.form(res, args[0], depth)
+			}
+		}
+	}
+}
+
+// form 提取表单XObject中的文字
+func (t *textExtractor) form(res Dict, name Object, depth int) {
+	xobjects, _ := t.d.Resolve(res["XObject"]).(Dict)
+	n, _ := name.(Name)
+	s, ok := t.d.Resolve(xobjects[n]).(*Stream)
+	if !ok || s.Dict.Name("Subtype") != "Form" {
+		return
+	}
+	data, err := s.Decode()
+	if err != nil {
+		return
+	}
+	resources := t.d.Resolve(s.Dict["Resources"])
+	if resources == nil {
+		resources = res
+	}
+	font, size := t.font, t.size
+	t.run(data, resources, depth+1)
+	t.font, t.size = font, size
+}
+
+func (t *textExtractor) loadFont(o Object) *font {
+	ref, isRef := o.(Ref)
+	if isRef {
+		if f, ok := t.fonts[ref]; ok {
+			return f
+		}
+	}
+	f := t.d.loadFont(o)
+	if isRef {
+		t.fonts[ref] = f
+	}
+	return f
+}
+
+func (t *textExtractor) moveTo(x, y float64) {
+	t.x, t.y = x, y
+	t.moved = true
+}
+
+// nextLine 移至下一行的起点
+func (t *textExtractor) nextLine() {
+	t.moveTo(t.x, t.y-t.leading)
+	t.newLine = true
+}
+
+// show 输出字符串中的文字，位置变化时根据纵坐标是否变化补充换行或空格
+func (t *textExtractor) show(o Object) {
+	s, ok := o.(String)
+	if !ok || t.font == nil || t.size == 0 {
+		return
+	}
+	text := t.font.decode(s)
+	if strings.TrimSpace(text) == "" {
+		if text != "" {
+			t.moved = true
+		}
+		return
+	}
+	if t.shown && t.moved {
+		if t.newLine || math.Abs(t.y-t.lastY) > 1 {
+			t.b.WriteByte('\n')
+		} else if !needNoSpace(t.b.String(), text) {
+			t.b.WriteByte(' ')
+		}
+	}
+	t.b.WriteString(text)
+	t.shown, t.moved, t.newLine, t.lastY = true, false, false, t.y
+}
+
+// needNoSpace 判断两段文字之间是否无需空格：已有空白，或相邻的是中日韩文字
+func needNoSpace(before, after string) bool {
+	if before == "" {
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(before)
+	first, _ := utf8.DecodeRuneInString(after)
+	return unicode.IsSpace(last) || unicode.IsSpace(first) || isCJK(last) || isCJK(first)
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r) || (r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
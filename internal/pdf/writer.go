@@ -0,0 +1,133 @@
+package pdf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Write 将文件写入w。仅写出从/Root和/Info可达的对象，对象按遍历顺序重新编号，
+// 并使用普通的交叉引用表，因此原文件中的增量更新、对象流和交叉引用流都会被合并为一份完整的文件。
+func (d *Document) Write(w io.Writer) error {
+	root, ok := d.Trailer["Root"].(Ref)
+	if !ok {
+		return fmt.Errorf("pdf: 缺少 /Root")
+	}
+
+	numbers := make(map[int]int) // 原对象号 -> 新对象号
+	var order []Object
+	var queue []Ref
+	visit := func(r Ref) {
+		if _, ok := numbers[r.Num]; !ok {
+			numbers[r.Num] = len(numbers) + 1
+			queue = append(queue, r)
+		}
+	}
+	visit(root)
+	if info, ok := d.Trailer["Info"].(Ref); ok {
+		visit(info)
+	}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		o, err := d.Object(r.Num)
+		if err != nil {
+			return err
+		}
+		order = append(order, o)
+		walkRefs(o, visit)
+	}
+	ref := func(r Ref) Ref {
+		if n, ok := numbers[r.Num]; ok {
+			return Ref{Num: n}
+		}
+		return Ref{} // 指向不存在的对象，写出后为"0 0 R"，阅读器会将其视为null
+	}
+
+	bw := bufio.NewWriter(w)
+	cw := &countingWriter{w: bw}
+	fmt.Fprintf(cw, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", d.version)
+	offsets := make([]int64, len(order))
+	var buf []byte
+	for i, o := range order {
+		offsets[i] = cw.n
+		buf = append(buf[:0], fmt.Sprintf("%d 0 obj\n", i+1)...)
+		buf = appendObject(buf, o, ref)
+		buf = append(buf, "\nendobj\n"...)
+		if _, err := cw.Write(buf); err != nil {
+			return err
+		}
+	}
+
+	xrefOffset := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(order)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", off)
+	}
+	trailer := Dict{"Size": int64(len(order) + 1), "Root": root}
+	if info, ok := d.Trailer["Info"].(Ref); ok {
+		trailer["Info"] = info
+	}
+	if id, ok := d.Trailer["ID"].(Array); ok {
+		trailer["ID"] = id
+	}
+	buf = append(buf[:0], "trailer\n"...)
+	buf = appendObject(buf, trailer, ref)
+	buf = append(buf, fmt.Sprintf("\nstartxref\n%d\n%%%%EOF\n", xrefOffset)...)
+	if _, err := cw.Write(buf); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteFile 将文件写入fileName。先写入临时文件再重命名，因此可以安全地覆盖正在读取的原文件。
+func (d *Document) WriteFile(fileName string) error {
+	f, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	if err = d.Write(f); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmpName, fileName)
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+	}
+	return err
+}
+
+// walkRefs 对o中直接包含的每个间接引用调用visit
+func walkRefs(o Object, visit func(Ref)) {
+	switch v := o.(type) {
+	case Ref:
+		visit(v)
+	case Array:
+		for _, e := range v {
+			walkRefs(e, visit)
+		}
+	case Dict:
+		for _, e := range v {
+			walkRefs(e, visit)
+		}
+	case *Stream:
+		walkRefs(v.Dict, visit)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
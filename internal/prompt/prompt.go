@@ -0,0 +1,52 @@
+// Package prompt 在命令行中读取用户输入的口令、密码等内容
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrNotTerminal 表示标准输入不是终端，无法提示用户输入
+var ErrNotTerminal = errors.New("标准输入不是终端，无法输入")
+
+// IsTerminal 判断标准输入是否为终端
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Password 输出label并读取一行输入，输入的内容不会显示在终端上。标准输入不是终端时返回ErrNotTerminal。
+func Password(label string) (string, error) {
+	if !IsTerminal() {
+		return "", ErrNotTerminal
+	}
+	fmt.Print(label)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// NewPassword 读取两次输入的新口令，两次输入不一致或为空时返回错误
+func NewPassword(label string) (string, error) {
+	first, err := Password(label)
+	if err != nil {
+		return "", err
+	}
+	if first == "" {
+		return "", errors.New("口令不能为空")
+	}
+	second, err := Password("请再次输入：")
+	if err != nil {
+		return "", err
+	}
+	if first != second {
+		return "", errors.New("两次输入的口令不一致")
+	}
+	return first, nil
+}
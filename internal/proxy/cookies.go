@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// httpOnlyPrefix 为Netscape格式中HttpOnly cookie所在行的前缀
+const httpOnlyPrefix = "#HttpOnly_"
+
+// ParseCookieFile 解析浏览器扩展等导出的Netscape格式（cookies.txt）的cookie文件。
+// 每行依次为域名、是否包含子域名、路径、是否仅限https、过期时间（Unix时间戳，0表示会话cookie）、名字和值，以制表符分隔。
+func ParseCookieFile(r io.Reader) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := strings.HasPrefix(line, httpOnlyPrefix)
+		if httpOnly {
+			line = line[len(httpOnlyPrefix):]
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) == 6 { //值为空时部分工具会省略最后一列
+			fields = append(fields, "")
+		}
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("第 %d 行格式错误，应为以制表符分隔的7列", n)
+		}
+		expiry, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行的过期时间格式错误：%s", n, fields[4])
+		}
+		c := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		if expiry > 0 {
+			c.Expires = time.Unix(expiry, 0)
+		}
+		cookies = append(cookies, c)
+	}
+	return cookies, scanner.Err()
+}
+
+// WriteCookieFile 将cookies以Netscape格式写入w
+func WriteCookieFile(w io.Writer, cookies []*http.Cookie) error {
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(bw, "# Netscape HTTP Cookie File")
+	for _, c := range cookies {
+		domain := c.Domain
+		if c.HttpOnly {
+			domain = httpOnlyPrefix + domain
+		}
+		var expiry int64
+		if !c.Expires.IsZero() {
+			expiry = c.Expires.Unix()
+		}
+		_, _ = fmt.Fprintf(bw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n", domain, netscapeBool(strings.HasPrefix(c.Domain, ".")),
+			c.Path, netscapeBool(c.Secure), expiry, c.Name, c.Value)
+	}
+	return bw.Flush()
+}
+
+func netscapeBool(b bool) string {
+	if b {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// MatchDomain 判断cookie的域名是否为domain或其子域名
+func MatchDomain(cookieDomain, domain string) bool {
+	d := strings.ToLower(strings.TrimPrefix(cookieDomain, "."))
+	return d == domain || strings.HasSuffix(d, "."+domain)
+}
+
+// FileJar 为保存在Netscape格式文件中的cookie jar，仅保存域名为domain或其子域名的cookie，
+// 服务器设置的cookie会立即写入文件，因此下次运行时仍然有效。
+type FileJar struct {
+	mu       sync.Mutex
+	jar      *cookiejar.Jar
+	fileName string
+	domain   string
+	cookies  map[string]*http.Cookie // 以域名、路径和名字为键
+	skip     map[string]bool         // 不保存的cookie名字
+}
+
+// NewFileJar 读取fileName中的cookie并返回FileJar，文件不存在时返回空的FileJar。名字在skip中的cookie不会被保存。
+func NewFileJar(fileName, domain string, skip ...string) (*FileJar, error) {
+	jar, _ := cookiejar.New(nil)
+	j := &FileJar{jar: jar, fileName: fileName, domain: domain, cookies: make(map[string]*http.Cookie), skip: make(map[string]bool)}
+	for _, name := range skip {
+		j.skip[name] = true
+	}
+	f, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return j, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cookies, err := ParseCookieFile(f)
+	if err != nil {
+		return nil, err
+	}
+	expired := false
+	for _, c := range cookies {
+		if j.add(c) && !c.Expires.IsZero() && c.Expires.Before(time.Now()) {
+			expired = true
+		}
+	}
+	if expired { //从文件中删除已过期的cookie，否则下次运行时仍会读到
+		_ = j.save()
+	}
+	return j, nil
+}
+
+// add 将cookie加入jar，返回是否被接受
+func (j *FileJar) add(c *http.Cookie) bool {
+	if j.skip[c.Name] || !MatchDomain(c.Domain, j.domain) {
+		return false
+	}
+	if !c.Expires.IsZero() && c.Expires.Before(time.Now()) {
+		delete(j.cookies, cookieKey(c))
+		return true
+	}
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	host := strings.TrimPrefix(c.Domain, ".")
+	u := &url.URL{Scheme: "https", Host: host, Path: c.Path}
+	jc := *c
+	if !strings.HasPrefix(c.Domain, ".") {
+		jc.Domain = "" // 仅限该主机的cookie
+	}
+	j.jar.SetCookies(u, []*http.Cookie{&jc})
+	j.cookies[cookieKey(c)] = c
+	return true
+}
+
+func cookieKey(c *http.Cookie) string {
+	return c.Domain + "\t" + c.Path + "\t" + c.Name
+}
+
+// Cookies 实现http.CookieJar接口
+func (j *FileJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// SetCookies 实现http.CookieJar接口，jar发生变化时写入文件
+func (j *FileJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	changed := false
+	for _, c := range cookies {
+		sc := *c
+		if sc.Domain == "" {
+			sc.Domain = u.Hostname()
+		} else if !strings.HasPrefix(sc.Domain, ".") {
+			sc.Domain = "." + sc.Domain // Set-Cookie中指定了Domain时包含子域名
+		}
+		if sc.Path == "" {
+			sc.Path = "/"
+		}
+		if sc.MaxAge < 0 {
+			sc.Expires = time.Unix(1, 0)
+		} else if sc.MaxAge > 0 {
+			sc.Expires = time.Now().Add(time.Duration(sc.MaxAge) * time.Second)
+		}
+		sc.MaxAge, sc.Raw, sc.RawExpires, sc.Unparsed = 0, "", "", nil
+		if j.add(&sc) {
+			changed = true
+		}
+	}
+	if changed {
+		_ = j.save()
+	}
+}
+
+// Replace 使用cookies替换jar中的全部cookie并写入文件
+func (j *FileJar) Replace(cookies []*http.Cookie) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar, _ = cookiejar.New(nil)
+	j.cookies = make(map[string]*http.Cookie)
+	for _, c := range cookies {
+		j.add(c)
+	}
+	return j.save()
+}
+
+// Len 返回jar中的cookie数量
+func (j *FileJar) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.cookies)
+}
+
+// save 将jar中未过期的cookie写入文件，文件的权限为0600
+func (j *FileJar) save() error {
+	keys := make([]string, 0, len(j.cookies))
+	for key, c := range j.cookies {
+		if !c.Expires.IsZero() && c.Expires.Before(time.Now()) {
+			delete(j.cookies, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	cookies := make([]*http.Cookie, len(keys))
+	for i, key := range keys {
+		cookies[i] = j.cookies[key]
+	}
+	if err := os.MkdirAll(filepath.Dir(j.fileName), 0700); err != nil {
+		return err
+	}
+	tmpName := j.fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err = WriteCookieFile(f, cookies); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, j.fileName)
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cookieFile = `# Netscape HTTP Cookie File
+# https://curl.se/docs/http-cookies.html
+
+.koushare.com	TRUE	/	TRUE	2000000000	Token	abc
+#HttpOnly_www.koushare.com	FALSE	/	FALSE	0	SESSION	s1
+.example.com	TRUE	/	FALSE	2000000000	other	x
+`
+
+func TestParseCookieFile(t *testing.T) {
+	cookies, err := ParseCookieFile(strings.NewReader(cookieFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cookies) != 3 {
+		t.Fatalf("got %d cookies, want 3", len(cookies))
+	}
+	if c := cookies[0]; c.Name != "Token" || c.Value != "abc" || c.Domain != ".koushare.com" || !c.Secure ||
+		!c.Expires.Equal(time.Unix(2000000000, 0)) {
+		t.Errorf("cookies[0] = %+v", c)
+	}
+	if c := cookies[1]; c.Name != "SESSION" || !c.HttpOnly || c.Domain != "www.koushare.com" || !c.Expires.IsZero() {
+		t.Errorf("cookies[1] = %+v", c)
+	}
+	if _, err = ParseCookieFile(strings.NewReader("koushare.com\tTRUE\t/\n")); err == nil {
+		t.Error("a malformed line was accepted")
+	}
+}
+
+func TestFileJar(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "cookies.txt")
+	cookies, _ := ParseCookieFile(strings.NewReader(cookieFile))
+	jar, err := NewFileJar(fileName, "koushare.com", "Token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = jar.Replace(cookies); err != nil {
+		t.Fatal(err)
+	}
+	if jar.Len() != 1 {
+		t.Errorf("jar has %d cookies, want only SESSION", jar.Len())
+	}
+	u, _ := url.Parse("https://api.koushare.com/api/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "pref", Value: "1", Domain: "koushare.com", MaxAge: 3600}})
+
+	// 重新读取文件后cookie仍然有效
+	jar, err = NewFileJar(fileName, "koushare.com", "Token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := jar.Cookies(u); len(got) != 1 || got[0].Name != "pref" {
+		t.Errorf("cookies for api.koushare.com = %v, want pref", got)
+	}
+	www, _ := url.Parse("https://www.koushare.com/")
+	if got := jar.Cookies(www); len(got) != 2 {
+		t.Errorf("cookies for www.koushare.com = %v, want SESSION and pref", got)
+	}
+}
+
+func TestFileJarExpired(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "cookies.txt")
+	expired := time.Now().Add(-time.Hour).Unix()
+	data := "www.koushare.com\tFALSE\t/\tFALSE\t2000000000\tSESSION\ts1\n" +
+		"www.koushare.com\tFALSE\t/\tFALSE\t" + strconv.FormatInt(expired, 10) + "\told\tx\n"
+	if err := os.WriteFile(fileName, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// 读取时丢弃的过期cookie同时从文件中删除
+	jar, err := NewFileJar(fileName, "koushare.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jar.Len() != 1 {
+		t.Errorf("jar has %d cookies, want only SESSION", jar.Len())
+	}
+	if saved, _ := os.ReadFile(fileName); strings.Contains(string(saved), "old") {
+		t.Errorf("the expired cookie is still in the file:\n%s", saved)
+	}
+
+	// 运行期间过期的cookie不会在保存时写回文件
+	u, _ := url.Parse("https://www.koushare.com/")
+	jar.SetCookies(u, []*http.Cookie{{Name: "short", Value: "1", MaxAge: 1}})
+	time.Sleep(1100 * time.Millisecond)
+	jar.SetCookies(u, []*http.Cookie{{Name: "pref", Value: "1", MaxAge: 3600}})
+	if saved, _ := os.ReadFile(fileName); strings.Contains(string(saved), "short") {
+		t.Errorf("a cookie that expired during the run was saved:\n%s", saved)
+	}
+}
@@ -2,13 +2,49 @@ package proxy
 
 import (
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 )
 
 var Client = http.Client{}
 
+// rootCAs 为验证服务器证书时使用的根证书，nil表示使用系统根证书
+var rootCAs *x509.CertPool
+
+// insecure 为true时不验证服务器证书
+var insecure bool
+
+// SetCACert 在系统根证书的基础上额外信任PEM格式的证书文件caCert中的证书，适用于会替换证书的企业代理。需在EnableProxy之前调用。
+func SetCACert(caCert string) error {
+	if caCert == "" {
+		rootCAs = nil
+		return nil
+	}
+	data, err := os.ReadFile(caCert)
+	if err != nil {
+		return fmt.Errorf("读取CA证书失败：%w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return errors.New("CA证书文件中没有PEM格式的证书：" + caCert)
+	}
+	rootCAs = pool
+	return nil
+}
+
+// SetInsecure 指定是否不验证服务器证书。不验证证书时登录凭证等内容可能被窃取，仅应在无法使用 --ca-cert 时临时使用。需在EnableProxy之前调用。
+func SetInsecure(value bool) {
+	insecure = value
+}
+
 func EnableProxy(proxyURL string) {
 	proxyFunc := http.ProxyFromEnvironment
 	if proxyURL != "" {
@@ -18,13 +54,17 @@ func EnableProxy(proxyURL string) {
 		}
 		proxyFunc = http.ProxyURL(u)
 	}
+	if insecure {
+		fmt.Fprintln(os.Stderr, "警告！已关闭TLS证书验证，网络请求（包括登录凭证）可能被拦截。")
+	}
 
 	Client = http.Client{
-		Transport: &http.Transport{
+		Transport: &transport{base: &http.Transport{
 			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: true,
+				RootCAs:            rootCAs,
+				InsecureSkipVerify: insecure,
 			},
 			Proxy: proxyFunc,
-		},
+		}},
 	}
 }
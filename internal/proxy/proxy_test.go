@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTLSVerification(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	defer func() {
+		_ = SetCACert("")
+		SetInsecure(false)
+		EnableProxy("")
+	}()
+	get := func() error {
+		resp, err := Client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	EnableProxy("")
+	if err := get(); err == nil || !strings.Contains(err.Error(), "--ca-cert") {
+		t.Fatalf("a self-signed certificate was accepted by default: %v", err)
+	}
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caCert, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCACert(caCert); err != nil {
+		t.Fatal(err)
+	}
+	EnableProxy("")
+	if err := get(); err != nil {
+		t.Errorf("request with --ca-cert failed: %v", err)
+	}
+
+	_ = SetCACert("")
+	SetInsecure(true)
+	EnableProxy("")
+	if err := get(); err != nil {
+		t.Errorf("request with --insecure failed: %v", err)
+	}
+
+	if err := SetCACert(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("a missing CA certificate file was accepted")
+	}
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRetryDelay 为两次重试之间的最长等待时间
+const maxRetryDelay = 30 * time.Second
+
+// rateChunk 为限速时每次读取的最大字节数
+const rateChunk = 32 * 1024
+
+// retries 为网络请求失败时的重试次数，通过 --retries 参数指定
+var retries int
+
+// limiter 限制全部响应的总下载速度，为nil时不限速
+var limiter *rateLimiter
+
+// SetRetries 指定网络请求失败时的重试次数，仅重试GET和HEAD请求
+func SetRetries(n int) {
+	if n >= 0 {
+		retries = n
+	}
+}
+
+// SetRateLimit 指定全部下载的总速度上限（字节/秒），0表示不限速
+func SetRateLimit(bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		limiter = nil
+		return
+	}
+	limiter = &rateLimiter{rate: bytesPerSecond}
+}
+
+// ParseRate 解析速度，如"2M"、"500K"、"1.5MB"或"1048576"，单位为字节/秒
+func ParseRate(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "/S"), "B")
+	unit := 1.0
+	switch {
+	case strings.HasSuffix(v, "K"):
+		unit, v = 1024, v[:len(v)-1]
+	case strings.HasSuffix(v, "M"):
+		unit, v = 1024*1024, v[:len(v)-1]
+	case strings.HasSuffix(v, "G"):
+		unit, v = 1024*1024*1024, v[:len(v)-1]
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("速度格式错误：%s（应为如2M、500K的格式）", s)
+	}
+	return int64(n * unit), nil
+}
+
+// transport 在base的基础上增加失败重试和限速
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	for i := 0; idempotent && i < retries && shouldRetry(resp, err); i++ {
+		if resp != nil {
+			_ = resp.Body.Close()
+		}
+		delay := time.Second << i
+		if delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+		resp, err = t.base.RoundTrip(req)
+	}
+	if isCertError(err) {
+		return nil, fmt.Errorf("%w（如果使用了会替换证书的代理，请使用 --ca-cert 参数指定其CA证书）", err)
+	}
+	if err == nil && limiter != nil {
+		resp.Body = &limitedBody{ReadCloser: resp.Body, limiter: limiter}
+	}
+	return resp, err
+}
+
+// shouldRetry 判断请求是否需要重试：网络错误（证书错误除外）、429或5xx（501除外）
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !isCertError(err)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// isCertError 判断err是否为服务器证书验证失败
+func isCertError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	return errors.As(err, &certErr)
+}
+
+// rateLimiter 为多个连接共享的限速器
+type rateLimiter struct {
+	mu   sync.Mutex
+	rate int64
+	next time.Time // 下一次读取可以开始的时间
+}
+
+// wait 在读取n字节后等待，使总速度不超过rate
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(l.rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+	time.Sleep(delay)
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	limiter *rateLimiter
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if len(p) > rateChunk {
+		p = p[:rateChunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.limiter.wait(n)
+	}
+	return n, err
+}
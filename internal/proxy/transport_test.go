@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]int64{
+		"0":       0,
+		"1048576": 1048576,
+		"500K":    500 * 1024,
+		"2M":      2 * 1024 * 1024,
+		"1.5MB":   1.5 * 1024 * 1024,
+		"2m/s":    2 * 1024 * 1024,
+	}
+	for s, want := range tests {
+		if got, err := ParseRate(s); err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "fast", "-1M"} {
+		if _, err := ParseRate(s); err == nil {
+			t.Errorf("ParseRate(%q) should fail", s)
+		}
+	}
+}
+
+func TestTransportRetry(t *testing.T) {
+	var calls int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	SetRetries(2)
+	defer SetRetries(0)
+	client := http.Client{Transport: &transport{base: http.DefaultTransport}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls != 3 {
+		t.Errorf("status %d after %d calls, want 200 after 3", resp.StatusCode, calls)
+	}
+}
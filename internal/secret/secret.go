@@ -0,0 +1,183 @@
+// Package secret 使用口令或密钥文件加密保存在本地的登录凭证。
+// 口令经scrypt派生出密钥，密钥文件的内容经SHA-256得到密钥，再使用AES-256-GCM加密。
+package secret
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// format 为加密文件的格式名，用于识别文件是否已加密
+const format = "koushare-dl-secret"
+
+const (
+	kdfScrypt  = "scrypt"
+	kdfKeyFile = "keyfile"
+)
+
+// scrypt的参数，在普通电脑上派生一次密钥约需0.1秒
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// minKeyFileSize 为密钥文件的最小长度
+const minKeyFileSize = 16
+
+// ErrWrongKey 表示口令或密钥文件错误，或者文件已被修改
+var ErrWrongKey = errors.New("口令或密钥文件错误")
+
+// envelope 为加密文件的内容
+type envelope struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	N          int    `json:"n,omitempty"`
+	R          int    `json:"r,omitempty"`
+	P          int    `json:"p,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keys 为解密时可以使用的口令和密钥文件。Passphrase仅在文件使用口令加密时才会被调用，因此可以在其中提示用户输入口令。
+type Keys struct {
+	Passphrase func() (string, error)
+	KeyFile    string
+}
+
+// IsSealed 判断data是否为加密后的内容
+func IsSealed(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '{' {
+		return false
+	}
+	var e envelope
+	return json.Unmarshal(data, &e) == nil && e.Format == format
+}
+
+// SealWithPassphrase 使用口令加密plain
+func SealWithPassphrase(plain []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("口令不能为空")
+	}
+	e := envelope{Format: format, Version: 1, KDF: kdfScrypt, N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := rand.Read(e.Salt); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key([]byte(passphrase), e.Salt, e.N, e.R, e.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	return seal(e, key, plain)
+}
+
+// SealWithKeyFile 使用密钥文件加密plain
+func SealWithKeyFile(plain []byte, keyFile string) ([]byte, error) {
+	key, err := keyFromFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return seal(envelope{Format: format, Version: 1, KDF: kdfKeyFile}, key, plain)
+}
+
+func seal(e envelope, key, plain []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	e.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(e.Nonce); err != nil {
+		return nil, err
+	}
+	e.Ciphertext = gcm.Seal(nil, e.Nonce, plain, []byte(format))
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Open 解密data，根据加密方式使用keys中的口令或密钥文件
+func Open(data []byte, keys Keys) ([]byte, error) {
+	var e envelope
+	if err := json.Unmarshal(bytes.TrimSpace(data), &e); err != nil || e.Format != format {
+		return nil, errors.New("不是加密文件")
+	}
+	if e.Version != 1 {
+		return nil, fmt.Errorf("不支持的加密文件版本：%d", e.Version)
+	}
+
+	var key []byte
+	switch e.KDF {
+	case kdfScrypt:
+		// 参数来自文件，超过加密时使用的参数说明文件已损坏或被篡改，拒绝以免耗尽内存或长时间卡住
+		if e.N < 2 || e.N > scryptN || e.R < 1 || e.R > scryptR || e.P < 1 || e.P > scryptP {
+			return nil, errors.New("加密文件已损坏：不支持的scrypt参数")
+		}
+		if keys.Passphrase == nil {
+			return nil, errors.New("文件使用口令加密，需要提供口令")
+		}
+		passphrase, err := keys.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if key, err = scrypt.Key([]byte(passphrase), e.Salt, e.N, e.R, e.P, 32); err != nil {
+			return nil, err
+		}
+	case kdfKeyFile:
+		if keys.KeyFile == "" {
+			return nil, errors.New("文件使用密钥文件加密，需要指定密钥文件")
+		}
+		var err error
+		if key, err = keyFromFile(keys.KeyFile); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的加密方式：%s", e.KDF)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("加密文件已损坏")
+	}
+	plain, err := gcm.Open(nil, e.Nonce, e.Ciphertext, []byte(format))
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plain, nil
+}
+
+// keyFromFile 读取密钥文件并使用SHA-256得到密钥，密钥文件可以是任意内容
+func keyFromFile(keyFile string) ([]byte, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥文件失败：%w", err)
+	}
+	if len(data) < minKeyFileSize {
+		return nil, fmt.Errorf("密钥文件过短，至少需要 %d 字节", minKeyFileSize)
+	}
+	key := sha256.Sum256(data)
+	return key[:], nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
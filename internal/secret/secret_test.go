@@ -0,0 +1,92 @@
+package secret
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSealWithPassphrase(t *testing.T) {
+	plain := []byte("abc 1700000000")
+	data, err := SealWithPassphrase(plain, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(data) || IsSealed(plain) {
+		t.Error("IsSealed returned a wrong result")
+	}
+	passphrase := func(p string) Keys {
+		return Keys{Passphrase: func() (string, error) { return p, nil }}
+	}
+	got, err := Open(data, passphrase("correct horse"))
+	if err != nil || string(got) != string(plain) {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+	if _, err = Open(data, passphrase("wrong")); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open with a wrong passphrase: %v", err)
+	}
+	if _, err = Open(data, Keys{}); err == nil {
+		t.Error("Open without a passphrase succeeded")
+	}
+}
+
+func TestSealWithKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := SealWithKeyFile([]byte("abc 1700000000"), keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Open(data, Keys{KeyFile: keyFile}); err != nil || string(got) != "abc 1700000000" {
+		t.Errorf("Open = %q, %v", got, err)
+	}
+
+	otherKey := filepath.Join(dir, "other")
+	if err = os.WriteFile(otherKey, []byte("fedcba9876543210fedcba9876543210"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Open(data, Keys{KeyFile: otherKey}); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("Open with a wrong key file: %v", err)
+	}
+	if err = os.WriteFile(otherKey, []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = SealWithKeyFile([]byte("x"), otherKey); err == nil {
+		t.Error("a short key file was accepted")
+	}
+}
+
+func TestOpenRejectsScryptParameters(t *testing.T) {
+	data, err := SealWithPassphrase([]byte("abc"), "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]func(e *envelope){
+		"huge N":     func(e *envelope) { e.N = 1 << 30 },
+		"huge r":     func(e *envelope) { e.R = 1 << 20 },
+		"huge p":     func(e *envelope) { e.P = 1 << 20 },
+		"zero N":     func(e *envelope) { e.N = 0 },
+		"negative r": func(e *envelope) { e.R = -1 },
+	}
+	for name, tamper := range tests {
+		var e envelope
+		if err = json.Unmarshal(data, &e); err != nil {
+			t.Fatal(err)
+		}
+		tamper(&e)
+		tampered, _ := json.Marshal(e)
+		asked := false
+		keys := Keys{Passphrase: func() (string, error) { asked = true; return "correct horse", nil }}
+		if _, err = Open(tampered, keys); err == nil || errors.Is(err, ErrWrongKey) {
+			t.Errorf("%s: Open() = %v, want a parameter error", name, err)
+		}
+		if asked {
+			t.Errorf("%s: asked for the passphrase before checking the parameters", name)
+		}
+	}
+}
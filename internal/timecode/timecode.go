@@ -0,0 +1,60 @@
+// Package timecode 解析和格式化 --from/--to 等参数使用的视频时间点
+package timecode
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Parse 解析视频中的时间点，支持"01:10:00"、"70:00"、"4200"（秒，可带小数）以及"1h10m"等格式
+func Parse(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("时间不能为空")
+	}
+	if d, err := time.ParseDuration(s); err == nil && !strings.ContainsAny(s, ":") {
+		if d < 0 {
+			return 0, fmt.Errorf("时间不能为负数：%q", s)
+		}
+		return d, nil
+	}
+
+	fields := strings.Split(s, ":")
+	if len(fields) > 3 {
+		return 0, fmt.Errorf(`无法识别的时间格式 %q，应为"01:10:00"、"70:00"或"4200"`, s)
+	}
+	var total float64
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil || v < 0 || (i > 0 && v >= 60) || (i < len(fields)-1 && strings.Contains(f, ".")) {
+			return 0, fmt.Errorf(`无法识别的时间格式 %q，应为"01:10:00"、"70:00"或"4200"`, s)
+		}
+		total = total*60 + v
+	}
+	return time.Duration(total * float64(time.Second)).Round(time.Millisecond), nil
+}
+
+// Format 将时间点格式化为"01:10:00"的形式，不足一秒的部分被舍去
+func Format(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute), int(d%time.Minute/time.Second))
+}
+
+// FileSuffix 返回截取片段时追加在文件名后的后缀，如"_clip_01-10-00_01-32-00"。to为0表示截取至视频结尾。
+func FileSuffix(from, to time.Duration) string {
+	end := "end"
+	if to > 0 {
+		end = strings.ReplaceAll(Format(to), ":", "-")
+	}
+	return "_clip_" + strings.ReplaceAll(Format(from), ":", "-") + "_" + end
+}
+
+// CheckRange 检查截取范围是否有效，from和to均为0表示不截取
+func CheckRange(from, to time.Duration) error {
+	if to > 0 && to <= from {
+		return fmt.Errorf("结束时间（%s）应晚于开始时间（%s）", Format(to), Format(from))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package timecode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	cases := map[string]time.Duration{
+		"01:10:00":   time.Hour + 10*time.Minute,
+		"70:00":      70 * time.Minute,
+		"4200":       70 * time.Minute,
+		"1h10m":      time.Hour + 10*time.Minute,
+		"00:00:01.5": 1500 * time.Millisecond,
+	}
+	for s, want := range cases {
+		got, err := Parse(s)
+		if err != nil || got != want {
+			t.Errorf("Parse(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "1:2:3:4", "01:75:00", "-5", "1.5:00", "abc"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+}
+
+func TestFileSuffix(t *testing.T) {
+	if got := FileSuffix(70*time.Minute, 92*time.Minute); got != "_clip_01-10-00_01-32-00" {
+		t.Errorf("FileSuffix = %q", got)
+	}
+	if got := FileSuffix(90*time.Second, 0); got != "_clip_00-01-30_end" {
+		t.Errorf("FileSuffix = %q", got)
+	}
+}
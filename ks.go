@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	//"github.com/pkg/profile"
 	"github.com/spf13/cobra"
@@ -10,6 +11,7 @@ import (
 	"github.com/yliu7949/KouShare-dl/internal/config"
 	"github.com/yliu7949/KouShare-dl/internal/proxy"
 	"github.com/yliu7949/KouShare-dl/internal/upgrade"
+	"github.com/yliu7949/KouShare-dl/user"
 )
 
 const version = "v0.9.2"
@@ -21,18 +23,44 @@ func main() {
 	var apiBase string
 	var webBase string
 	var loginBase string
+	var configDir string
+	var profile string
+	var token string
+	var keyFile string
+	var retries int
+	var rateLimit string
+	var caCert string
+	var insecure bool
 	var rootCmd = &cobra.Command{
 		Use: "ks",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			color.DisableColor(noColor)
+			config.SetConfigDir(configDir)
+			if !ks.ApplyConfig(cmd) {
+				os.Exit(1)
+			}
+			if err := proxy.SetCACert(caCert); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			proxy.SetInsecure(insecure)
 			proxy.EnableProxy(proxyURL)
+			proxy.SetRetries(retries)
+			rate, _ := proxy.ParseRate(rateLimit) //已在ApplyConfig中检查
+			proxy.SetRateLimit(rate)
 			config.SetAPIBaseURL(apiBase)
 			config.SetWebBaseURL(webBase)
 			config.SetLoginBaseURL(loginBase)
+			if err := config.SetProfile(profile); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			user.SetToken(token)
+			user.SetKeyFile(keyFile)
 		},
 	}
-	rootCmd.AddCommand(ks.InfoCmd(), ks.SaveCmd(), ks.RecordCmd(), ks.MergeCmd(), ks.SlideCmd(),
-		ks.LoginCmd(), ks.LogoutCmd(), ks.CleanCmd(), VersionCmd(), UpgradeCmd())
+	rootCmd.AddCommand(ks.InfoCmd(), ks.SaveCmd(), ks.MineCmd(), ks.RecordCmd(), ks.ReplayCmd(), ks.MergeCmd(), ks.SlideCmd(), ks.GrepCmd(),
+		ks.LoginCmd(), ks.LogoutCmd(), ks.WhoamiCmd(), ks.ProfilesCmd(), ks.ConfigCmd(), ks.CleanCmd(), VersionCmd(), UpgradeCmd())
 	rootCmd.SetVersionTemplate(`{{printf "KouShare-dl %s\n" .Version}}`)
 	rootCmd.Version = version
 
@@ -41,6 +69,14 @@ func main() {
 	rootCmd.PersistentFlags().StringVar(&apiBase, "api-base", "", "指定蔻享 API Base（默认 https://api.koushare.com，可用环境变量 KOUSHARE_API_BASE）")
 	rootCmd.PersistentFlags().StringVar(&webBase, "web-base", "", "指定蔻享 Web Base（默认 https://www.koushare.com，可用环境变量 KOUSHARE_WEB_BASE）")
 	rootCmd.PersistentFlags().StringVar(&loginBase, "login-base", "", "指定蔻享登录 API Base（默认 https://login.koushare.com，可用环境变量 KOUSHARE_LOGIN_BASE）")
+	rootCmd.PersistentFlags().StringVar(&configDir, "config-dir", "", "指定保存登录凭证的文件夹（默认为用户配置文件夹下的koushare-dl，可用环境变量 KOUSHARE_CONFIG_DIR）")
+	rootCmd.PersistentFlags().StringVar(&profile, "profile", "", "指定使用的账户配置（默认为default，可用环境变量 KOUSHARE_PROFILE）")
+	rootCmd.PersistentFlags().StringVar(&token, "token", "", "指定使用的登录凭证，优先于token文件（可用环境变量 KOUSHARE_TOKEN）")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key-file", "", "指定加密登录凭证的密钥文件（可用环境变量 KOUSHARE_KEY_FILE）")
+	rootCmd.PersistentFlags().IntVar(&retries, "retries", 0, "指定网络请求失败时的重试次数（可用环境变量 KOUSHARE_RETRIES）")
+	rootCmd.PersistentFlags().StringVar(&rateLimit, "rate-limit", "", "指定下载速度上限，如2M表示2MB/s（可用环境变量 KOUSHARE_RATE_LIMIT）")
+	rootCmd.PersistentFlags().StringVar(&caCert, "ca-cert", "", "指定额外信任的CA证书文件（PEM格式），适用于会替换证书的企业代理（可用环境变量 KOUSHARE_CA_CERT）")
+	rootCmd.PersistentFlags().BoolVar(&insecure, "insecure", false, "指定是否不验证服务器的TLS证书（不安全，登录凭证可能被窃取）")
 	_ = rootCmd.Execute()
 }
 
@@ -0,0 +1,382 @@
+package live
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+)
+
+// replayPollInterval 为等待回放上线时两次查询之间的间隔
+const replayPollInterval = time.Minute
+
+// backfillRecording 在直播结束后等待回放上线，下载覆盖录制缺口的回放片段并将其拼接进录制结果
+func (l *Live) backfillRecording(autoMerge bool) {
+	gaps := l.rec.gaps()
+	if len(gaps) == 0 {
+		fmt.Println("录制过程中未发现缺口，无需回填。")
+		return
+	}
+	var missing time.Duration
+	for _, g := range gaps {
+		missing += g.to.Sub(g.from)
+	}
+	fmt.Printf("录制过程中共发现 %d 处缺口（约 %s），等待回放上线后自动回填...\n",
+		len(gaps), formatDurationSeconds(missing.Seconds()))
+
+	replayURL := l.waitForReplayPlaylist(l.BackfillTimeout)
+	if replayURL == "" {
+		fmt.Println(color.Highlight("等待回放上线超时，未能回填录制缺口。"))
+		return
+	}
+	playlistURL, p, err := fetchMediaPlaylist(replayURL)
+	if err != nil {
+		fmt.Println("获取回放播放列表失败：", err)
+		return
+	}
+
+	segments, _ := l.rec.snapshot()
+	starts := l.alignReplay(p, segments)
+	if starts == nil {
+		fmt.Println(color.Highlight("无法确定回放与录制内容的时间对应关系，未能回填录制缺口。"))
+		return
+	}
+
+	candidates := make([]fillCandidate, 0, len(p.segments))
+	for j, seg := range p.segments {
+		u, ok := resolveURL(playlistURL, seg.uri)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, fillCandidate{
+			start:    starts[j],
+			duration: seg.duration,
+			seq:      -1,
+			order:    seg.seq,
+			source:   remoteFillSource(u),
+		})
+	}
+	filled := l.fillGaps(segments, gaps, candidates, autoMerge, "backfill")
+	fmt.Println(color.Done(fmt.Sprintf("回填完成，共补录 %d 个片段。", filled)))
+}
+
+// fillGaps 将落在缺口中的候选片段补录进录制结果并更新片段记录，返回补录的片段数
+func (l *Live) fillGaps(segments []recordedSegment, gaps []recordingGap, candidates []fillCandidate, autoMerge bool, tag string) int {
+	fills := selectFills(segments, gaps, candidates)
+	var result []recordedSegment
+	if autoMerge {
+		result = spliceMergedFile(segments, gaps, fills)
+	} else {
+		result = l.saveFillFiles(segments, gaps, fills, tag)
+	}
+	l.rec.replace(result)
+	return len(result) - len(segments)
+}
+
+// fillSource 是可用于填补录制缺口的一个片段
+type fillSource struct {
+	name  string // 片段名，仅用于输出进度
+	write func(w io.Writer) (int64, error)
+}
+
+func remoteFillSource(u string) fillSource {
+	return fillSource{
+		name: segmentBaseName(u),
+		write: func(w io.Writer) (int64, error) {
+			return fetchSegment(w, u)
+		},
+	}
+}
+
+func localFillSource(s recordedSegment) fillSource {
+	return fillSource{
+		name: s.name,
+		write: func(w io.Writer) (int64, error) {
+			f, err := os.Open(s.file)
+			if err != nil {
+				return 0, err
+			}
+			defer f.Close()
+			return io.Copy(w, io.NewSectionReader(f, s.offset, s.size))
+		},
+	}
+}
+
+// fillCandidate 是一个可能落在录制缺口中的片段
+type fillCandidate struct {
+	start    time.Time
+	duration float64
+	seq      int64 // 与录制片段可比较的媒体序列号，不可比较时为-1
+	order    int64 // 片段在其来源播放列表中的媒体序列号，用于命名补录文件，未知时为-1
+	source   fillSource
+}
+
+// segment 返回该片段补录进录制结果后对应的片段记录
+func (c fillCandidate) segment(name, file string, offset, size int64) recordedSegment {
+	return recordedSegment{
+		name:     name,
+		seq:      c.seq,
+		duration: c.duration,
+		start:    c.start,
+		file:     file,
+		offset:   offset,
+		size:     size,
+	}
+}
+
+// selectFills 为每个缺口挑选落在其中的候选片段。缺口两侧片段与候选片段的序列号均可用时按序列号挑选，
+// 否则按时间挑选。
+func selectFills(segments []recordedSegment, gaps []recordingGap, candidates []fillCandidate) [][]fillCandidate {
+	// 片段边界与缺口边界不完全重合，容许半秒的误差以免引入重复的片段
+	const tolerance = 500 * time.Millisecond
+	fills := make([][]fillCandidate, len(gaps))
+	for i, g := range gaps {
+		prev, next := segments[g.after], segments[g.after+1]
+		for _, c := range candidates {
+			var inside bool
+			if prev.seq >= 0 && next.seq >= 0 && c.seq >= 0 {
+				inside = c.seq > prev.seq && c.seq < next.seq
+			} else {
+				end := c.start.Add(time.Duration(c.duration * float64(time.Second)))
+				inside = c.start.Before(g.to.Add(-tolerance)) && end.After(g.from.Add(tolerance))
+			}
+			if inside {
+				fills[i] = append(fills[i], c)
+			}
+		}
+	}
+	return fills
+}
+
+// waitForReplayPlaylist 轮询直播间状态，直到快速回放或新版回放接口可用，超时后返回空字符串
+func (l *Live) waitForReplayPlaylist(timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for {
+		l.getLiveByRoomID(true)
+		if l.isLive == "2" || l.isLive == "3" {
+			if l.quickReplayURL != "" {
+				return l.quickReplayURL
+			}
+			if l.VideoID != "" || l.resolveVideoID() {
+				if playbackURL, _, err := l.fetchPlaybackURL(); err == nil {
+					return playbackURL
+				}
+			}
+		}
+		if !time.Now().Add(replayPollInterval).Before(deadline) {
+			return ""
+		}
+		fmt.Printf("\r 回放暂未上线，将于 %s 重新检查...", time.Now().Add(replayPollInterval).Format("15:04:05"))
+		time.Sleep(replayPollInterval)
+	}
+}
+
+// alignReplay 计算回放中每个片段在直播时间轴上的开始时间。依次尝试：回放自带的节目时间、
+// 与已录制片段同名的片段、直播间的开播时间。均不可用时返回nil。
+func (l *Live) alignReplay(p hlsPlaylist, segments []recordedSegment) []time.Time {
+	if len(p.segments) == 0 {
+		return nil
+	}
+
+	starts := make([]time.Time, len(p.segments))
+	if !p.segments[0].date.IsZero() {
+		for i, s := range p.segments {
+			starts[i] = s.date
+		}
+		return starts
+	}
+
+	var origin time.Time
+	recorded := make(map[string]time.Time, len(segments))
+	for _, s := range segments {
+		recorded[path.Base(s.name)] = s.start
+	}
+	for _, s := range p.segments {
+		if t, ok := recorded[segmentBaseName(s.uri)]; ok {
+			origin = t.Add(-time.Duration(s.offset * float64(time.Second)))
+			break
+		}
+	}
+	if origin.IsZero() {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", l.date, serverLocation)
+		if err != nil {
+			return nil
+		}
+		fmt.Println(color.Highlight("回放中未找到与录制内容相同的片段，将按开播时间估计缺口位置。"))
+		origin = t
+	}
+	for i, s := range p.segments {
+		starts[i] = origin.Add(time.Duration(s.offset * float64(time.Second)))
+	}
+	return starts
+}
+
+// segmentBaseName 返回片段地址中不含目录、查询参数和扩展名的文件名
+func segmentBaseName(uri string) string {
+	uri, _, _ = strings.Cut(uri, "?")
+	base := path.Base(uri)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+// saveFillFiles 将填补缺口的片段保存为单独的.ts文件，文件名紧随缺口前的片段，以便 merge 命令按顺序合并。
+// 返回补录后的全部片段。
+func (l *Live) saveFillFiles(segments []recordedSegment, gaps []recordingGap, fills [][]fillCandidate, tag string) []recordedSegment {
+	result := make([]recordedSegment, 0, len(segments))
+	next := 0
+	for i, g := range gaps {
+		result = append(result, segments[next:g.after+1]...)
+		next = g.after + 1
+		for k, c := range fills[i] {
+			// 按媒体序列号命名并补零至固定宽度，使 merge 命令按文件名排序时补录片段的顺序正确
+			order := c.order
+			if order < 0 {
+				order = int64(k + 1)
+			}
+			name := fmt.Sprintf("%s_%s%012d", segments[g.after].name, tag, order)
+			fmt.Println(name, "...")
+			fileName := l.SaveDir + name + ".tmp"
+			dstFile, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+			if err != nil {
+				fmt.Println(err.Error())
+				continue
+			}
+			n, err := c.source.write(dstFile)
+			_ = dstFile.Close()
+			if err != nil {
+				fmt.Println(err.Error())
+				_ = os.Remove(fileName)
+				continue
+			}
+			if err = os.Rename(fileName, l.SaveDir+name+".ts"); err != nil {
+				fmt.Println(err.Error())
+				continue
+			}
+			result = append(result, c.segment(name, l.SaveDir+name+".ts", 0, n))
+		}
+	}
+	return append(result, segments[next:]...)
+}
+
+// spliceMergedFile 将填补缺口的片段插入自动合并得到的录制文件中，返回补录后的全部片段。
+// 录制片段可能分布在多个文件中，每个缺口的片段插入缺口前最后一个片段所在的文件中、紧随该片段之后的位置。
+// 某个文件拼接出错时该文件保持不变，其中的缺口不填补。
+func spliceMergedFile(segments []recordedSegment, gaps []recordingGap, fills [][]fillCandidate) []recordedSegment {
+	var files []string
+	points := make(map[string][]splicePoint)
+	for i, g := range gaps {
+		if len(fills[i]) == 0 {
+			continue
+		}
+		prev := segments[g.after]
+		if _, ok := points[prev.file]; !ok {
+			files = append(files, prev.file)
+		}
+		points[prev.file] = append(points[prev.file], splicePoint{gap: i, at: prev.offset + prev.size, fills: fills[i]})
+	}
+
+	inserted := make(map[int][]recordedSegment) // 缺口下标 -> 插入的片段
+	for _, file := range files {
+		if err := spliceFile(file, points[file]); err != nil {
+			fmt.Println("拼接片段失败：", err)
+			delete(points, file)
+			continue
+		}
+		for _, p := range points[file] {
+			inserted[p.gap] = p.inserted
+		}
+	}
+
+	result := make([]recordedSegment, 0, len(segments))
+	next := 0
+	for i, g := range gaps {
+		for _, s := range segments[next : g.after+1] {
+			result = append(result, shiftSegment(s, points[s.file]))
+		}
+		next = g.after + 1
+		result = append(result, inserted[i]...)
+	}
+	for _, s := range segments[next:] {
+		result = append(result, shiftSegment(s, points[s.file]))
+	}
+	return result
+}
+
+// splicePoint 表示在文件中at处插入的一组片段
+type splicePoint struct {
+	gap      int
+	at       int64 // 插入位置（原文件中的偏移）
+	fills    []fillCandidate
+	n        int64             // 实际插入的字节数
+	inserted []recordedSegment // 实际插入的片段
+}
+
+// shiftSegment 返回文件中插入片段后s的新位置
+func shiftSegment(s recordedSegment, points []splicePoint) recordedSegment {
+	for _, p := range points {
+		if p.at <= s.offset {
+			s.offset += p.n
+		}
+	}
+	return s
+}
+
+// spliceFile 在文件fileName中按points插入片段，下载失败的片段被跳过。points须按at升序排列。出错时文件保持不变。
+func spliceFile(fileName string, points []splicePoint) error {
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dstName := fileName + ".backfill.tmp"
+	dst, err := os.OpenFile(dstName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	var shift int64 // 已插入的字节数
+	var cursor int64
+	for i := range points {
+		p := &points[i]
+		if _, err = io.Copy(dst, io.NewSectionReader(src, cursor, p.at-cursor)); err != nil {
+			break
+		}
+		cursor = p.at
+		for _, c := range p.fills {
+			fmt.Println(c.source.name, "...")
+			var buf bytes.Buffer
+			if _, fetchErr := c.source.write(&buf); fetchErr != nil {
+				fmt.Println(fetchErr.Error())
+				continue
+			}
+			n, writeErr := buf.WriteTo(dst)
+			if err = writeErr; err != nil {
+				break
+			}
+			p.inserted = append(p.inserted, c.segment(c.source.name, fileName, p.at+shift+p.n, n))
+			p.n += n
+		}
+		if err != nil {
+			break
+		}
+		shift += p.n
+	}
+	if err == nil {
+		_, err = io.Copy(dst, io.NewSectionReader(src, cursor, 1<<62))
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	_ = src.Close()
+	if err == nil {
+		err = os.Rename(dstName, fileName)
+	}
+	if err != nil {
+		_ = os.Remove(dstName)
+	}
+	return err
+}
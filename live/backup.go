@@ -0,0 +1,123 @@
+package live
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+)
+
+// recordWithBackup 同时录制两种清晰度的直播，直播结束后用备份录制中的片段填补主录制的缺口
+func (l *Live) recordWithBackup(autoMerge bool) {
+	if l.backupM3u8URL == "" || l.backupM3u8URL == l.m3u8URL {
+		fmt.Println(color.Highlight("该直播间仅提供一种清晰度，无法进行双路备份录制。"))
+		l.recordLive(autoMerge)
+		return
+	}
+
+	backup := &Live{
+		lid:        l.lid,
+		RoomID:     l.RoomID,
+		VideoID:    l.VideoID,
+		isLive:     l.isLive,
+		title:      l.title,
+		date:       l.date,
+		m3u8URL:    l.backupM3u8URL,
+		SaveDir:    backupDir(l.SaveDir),
+		nameSuffix: "_backup",
+		quiet:      true,
+	}
+	fmt.Println("同时录制另一清晰度作为备份，保存至", backup.SaveDir)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		backup.recordLive(autoMerge)
+	}()
+	l.recordLive(autoMerge)
+	wg.Wait()
+
+	l.stopServing() //补录会改变片段的下标和所在文件
+	l.patchFromBackup(backup, autoMerge)
+}
+
+// backupDir 返回备份录制的保存路径，为主录制路径旁的同级文件夹，如 ./live/ 对应 ./live_backup/。
+// 备份不能保存在主录制路径中，否则 merge 命令会把备份片段与主录制片段合并在一起。
+func backupDir(saveDir string) string {
+	dir := filepath.Clean(saveDir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+	return dir + "_backup" + string(filepath.Separator)
+}
+
+// backupAlignment 判断备份录制的片段能否与主录制对应。两路录制的片段均带有节目时间时按时间对应（byTime为true）；
+// 否则两路录制的片段均须有媒体序列号，且同一序列号的片段开始时间相差不超过半个片段时长，即两路的编号方式一致。
+func backupAlignment(main, backup []recordedSegment) (byTime, ok bool) {
+	dated, sequenced := true, true
+	for _, s := range append(append([]recordedSegment(nil), main...), backup...) {
+		dated = dated && s.dated
+		sequenced = sequenced && s.seq >= 0
+	}
+	if dated {
+		return true, true
+	}
+	if !sequenced {
+		return false, false
+	}
+
+	starts := make(map[int64]recordedSegment, len(main))
+	for _, s := range main {
+		starts[s.seq] = s
+	}
+	var matched int
+	for _, b := range backup {
+		m, found := starts[b.seq]
+		if !found {
+			continue
+		}
+		tolerance := time.Duration(math.Min(m.duration, b.duration) / 2 * float64(time.Second))
+		if d := m.start.Sub(b.start); d > tolerance || d < -tolerance {
+			return false, false
+		}
+		matched++
+	}
+	return false, matched > 0
+}
+
+// patchFromBackup 用备份录制中的片段填补主录制中的缺口
+func (l *Live) patchFromBackup(backup *Live, autoMerge bool) {
+	gaps := l.rec.gaps()
+	if len(gaps) == 0 {
+		return
+	}
+	fmt.Printf("主录制中共发现 %d 处缺口，尝试使用备份录制填补...\n", len(gaps))
+
+	segments, _ := l.rec.snapshot()
+	backupSegments, _ := backup.rec.snapshot()
+	byTime, ok := backupAlignment(segments, backupSegments)
+	if !ok {
+		fmt.Println(color.Highlight("两路录制的片段无法对应（缺少节目时间且媒体序列号不一致），未使用备份录制填补缺口。"))
+		return
+	}
+	candidates := make([]fillCandidate, 0, len(backupSegments))
+	for _, s := range backupSegments {
+		c := fillCandidate{
+			start:    s.start,
+			duration: s.duration,
+			seq:      s.seq,
+			order:    s.seq,
+			source:   localFillSource(s),
+		}
+		if byTime {
+			c.seq = -1 //按节目时间挑选
+		}
+		candidates = append(candidates, c)
+	}
+	filled := l.fillGaps(segments, gaps, candidates, autoMerge, "backup")
+	fmt.Println(color.Done(fmt.Sprintf("已使用备份录制填补 %d 个片段。", filled)))
+}
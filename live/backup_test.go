@@ -0,0 +1,278 @@
+package live
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2023, 7, 15, 8, 30, 0, 0, serverLocation)
+
+// seg 返回第i个2秒长的片段，序列号为seq
+func seg(i int, seq int64) recordedSegment {
+	return recordedSegment{name: fmt.Sprintf("seg%d", i), seq: seq, duration: 2, start: t0.Add(time.Duration(i) * 2 * time.Second)}
+}
+
+// candidate 返回内容为data的候选片段，时间与seg(i, seq)相同
+func candidate(i int, seq int64, data string) fillCandidate {
+	s := seg(i, seq)
+	return fillCandidate{
+		start:    s.start,
+		duration: s.duration,
+		seq:      seq,
+		source: fillSource{name: s.name, write: func(w io.Writer) (int64, error) {
+			n, err := io.WriteString(w, data)
+			return int64(n), err
+		}},
+	}
+}
+
+func TestSelectFills(t *testing.T) {
+	tests := []struct {
+		name       string
+		segments   []recordedSegment
+		candidates []fillCandidate
+		want       string
+	}{
+		{
+			name:       "by sequence number",
+			segments:   []recordedSegment{seg(0, 10), seg(1, 11), seg(4, 14)},
+			candidates: []fillCandidate{candidate(1, 11, ""), candidate(2, 12, ""), candidate(3, 13, ""), candidate(4, 14, "")},
+			want:       "[seg2 seg3]",
+		},
+		{
+			name:       "by time when the sequence numbers are unknown",
+			segments:   []recordedSegment{seg(0, -1), seg(1, -1), seg(4, -1)},
+			candidates: []fillCandidate{candidate(1, -1, ""), candidate(2, -1, ""), candidate(3, -1, ""), candidate(4, -1, "")},
+			want:       "[seg2 seg3]",
+		},
+		{
+			name:       "by time when only the candidates lack sequence numbers",
+			segments:   []recordedSegment{seg(0, 10), seg(3, 13)},
+			candidates: []fillCandidate{candidate(0, -1, ""), candidate(1, -1, ""), candidate(2, -1, ""), candidate(3, -1, "")},
+			want:       "[seg1 seg2]",
+		},
+		{
+			name:       "no candidate in the gap",
+			segments:   []recordedSegment{seg(0, 10), seg(3, 13)},
+			candidates: []fillCandidate{candidate(5, 15, "")},
+			want:       "[]",
+		},
+	}
+	for _, tt := range tests {
+		r := &recording{segments: tt.segments}
+		gaps := r.gaps()
+		if len(gaps) != 1 {
+			t.Fatalf("%s: got %d gaps, want 1", tt.name, len(gaps))
+		}
+		var names []string
+		for _, c := range selectFills(tt.segments, gaps, tt.candidates)[0] {
+			names = append(names, c.source.name)
+		}
+		if got := "[" + strings.Join(names, " ") + "]"; got != tt.want {
+			t.Errorf("%s: selectFills() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSpliceMergedFile(t *testing.T) {
+	// 自动合并的录制文件中依次为seg0、seg1和seg4，seg1与seg4之间缺少seg2和seg3
+	file := filepath.Join(t.TempDir(), "merged.ts")
+	if err := os.WriteFile(file, []byte("AABBEE"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var segments []recordedSegment
+	for i, n := range []int{0, 1, 4} {
+		s := seg(n, int64(10+n))
+		s.file, s.offset, s.size = file, int64(2*i), 2
+		segments = append(segments, s)
+	}
+	r := &recording{segments: segments}
+	gaps := r.gaps()
+	fills := [][]fillCandidate{{candidate(2, 12, "CC"), candidate(3, 13, "DDD")}}
+
+	result := spliceMergedFile(segments, gaps, fills)
+	if data, _ := os.ReadFile(file); string(data) != "AABBCCDDDEE" {
+		t.Errorf("merged file = %q", data)
+	}
+	var got []string
+	for _, s := range result {
+		got = append(got, fmt.Sprintf("%s@%d+%d", s.name, s.offset, s.size))
+	}
+	if want := "seg0@0+2 seg1@2+2 seg2@4+2 seg3@6+3 seg4@9+2"; strings.Join(got, " ") != want {
+		t.Errorf("segments = %s, want %s", strings.Join(got, " "), want)
+	}
+
+	// 候选片段下载失败时跳过该片段，其余片段照常插入
+	failing := candidate(2, 12, "")
+	failing.source.write = func(w io.Writer) (int64, error) { return 0, fmt.Errorf("network error") }
+	if err := os.WriteFile(file, []byte("AABBEE"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	result = spliceMergedFile(segments, gaps, [][]fillCandidate{{failing, candidate(3, 13, "DD")}})
+	if data, _ := os.ReadFile(file); string(data) != "AABBDDEE" || len(result) != 4 {
+		t.Errorf("merged file = %q with %d segments after a failed fill", data, len(result))
+	}
+}
+
+func TestSpliceMultipleFiles(t *testing.T) {
+	// 录制片段分布在两个文件中：a.ts中为seg0、seg1，b.ts中为seg4、seg5和seg8
+	dir := t.TempDir()
+	files := map[string]string{"a": "AABB", "b": "EEFFII"}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name+".ts"), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var segments []recordedSegment
+	for _, x := range []struct {
+		i      int
+		file   string
+		offset int64
+	}{{0, "a", 0}, {1, "a", 2}, {4, "b", 0}, {5, "b", 2}, {8, "b", 4}} {
+		s := seg(x.i, int64(10+x.i))
+		s.file, s.offset, s.size = filepath.Join(dir, x.file+".ts"), x.offset, 2
+		segments = append(segments, s)
+	}
+	r := &recording{segments: segments}
+	gaps := r.gaps()
+	fills := [][]fillCandidate{
+		{candidate(2, 12, "CC"), candidate(3, 13, "DD")},
+		{candidate(6, 16, "GG"), candidate(7, 17, "HH")},
+	}
+
+	result := spliceMergedFile(segments, gaps, fills)
+	for name, want := range map[string]string{"a": "AABBCCDD", "b": "EEFFGGHHII"} {
+		if data, _ := os.ReadFile(filepath.Join(dir, name+".ts")); string(data) != want {
+			t.Errorf("%s.ts = %q, want %q", name, data, want)
+		}
+	}
+	var got []string
+	for _, s := range result {
+		got = append(got, fmt.Sprintf("%s@%s%d", s.name, filepath.Base(s.file)[:1], s.offset))
+	}
+	if want := "seg0@a0 seg1@a2 seg2@a4 seg3@a6 seg4@b0 seg5@b2 seg6@b4 seg7@b6 seg8@b8"; strings.Join(got, " ") != want {
+		t.Errorf("segments = %s, want %s", strings.Join(got, " "), want)
+	}
+}
+
+func TestSaveFillFilesOrder(t *testing.T) {
+	// 补录文件按媒体序列号命名，超过999个时按文件名排序仍然有序
+	dir := t.TempDir() + "/"
+	segments := []recordedSegment{seg(0, 0), seg(1002, 1002)}
+	r := &recording{segments: segments}
+	var fills []fillCandidate
+	for _, i := range []int{999, 1000} {
+		c := candidate(i, int64(i), fmt.Sprint(i))
+		c.order = int64(i)
+		fills = append(fills, c)
+	}
+	l := &Live{SaveDir: dir}
+	l.saveFillFiles(segments, r.gaps(), [][]fillCandidate{fills}, "backfill")
+	entries, _ := os.ReadDir(dir)
+	var contents []string
+	for _, e := range entries { //按文件名排序
+		data, _ := os.ReadFile(dir + e.Name())
+		contents = append(contents, string(data))
+	}
+	if got := strings.Join(contents, " "); got != "999 1000" {
+		t.Errorf("fill files in name order = %s", got)
+	}
+}
+
+func TestPatchFromBackup(t *testing.T) {
+	mainDir := t.TempDir() + "/live/"
+	l := &Live{SaveDir: mainDir, rec: &recording{}}
+	backup := &Live{SaveDir: backupDir(l.SaveDir), rec: &recording{}}
+	if want := filepath.Join(filepath.Dir(filepath.Clean(mainDir)), "live_backup") + string(filepath.Separator); backup.SaveDir != want {
+		t.Fatalf("backupDir() = %q, want %q", backup.SaveDir, want)
+	}
+
+	// 主录制缺少seg2，备份录制中有全部片段
+	write := func(dir string, i int, data string) recordedSegment {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		s := seg(i, int64(10+i))
+		s.file, s.size = dir+s.name+".ts", int64(len(data))
+		if err := os.WriteFile(s.file, []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	l.rec.replace([]recordedSegment{write(mainDir, 0, "a"), write(mainDir, 1, "b"), write(mainDir, 3, "d")})
+	for i, data := range []string{"A", "B", "C", "D"} {
+		backup.rec.add(write(backup.SaveDir, i, data))
+	}
+
+	l.patchFromBackup(backup, false)
+	segments, _ := l.rec.snapshot()
+	var names []string
+	for _, s := range segments {
+		names = append(names, s.name)
+	}
+	if got := strings.Join(names, " "); got != "seg0 seg1 seg1_backup000000000012 seg3" {
+		t.Fatalf("segments after patching = %s", got)
+	}
+	if data, err := os.ReadFile(mainDir + "seg1_backup000000000012.ts"); err != nil || string(data) != "C" {
+		t.Errorf("fill file = %q, %v", data, err)
+	}
+
+	// merge 命令只合并主录制文件夹中的片段（不含子文件夹），按文件名排序
+	write(mainDir+"old/", 9, "x")
+	MergeTsFiles(mainDir, "merged.mp4")
+	if data, err := os.ReadFile(mainDir + "merged.mp4"); err != nil || !bytes.Equal(data, []byte("abCd")) {
+		t.Errorf("merged = %q, %v", data, err)
+	}
+	if _, err := os.Stat(backup.SaveDir + "seg2.ts"); err != nil {
+		t.Errorf("the backup recording was touched by merge: %v", err)
+	}
+	if _, err := os.Stat(mainDir + "old/seg9.ts"); err != nil {
+		t.Errorf("a segment in a subfolder was merged: %v", err)
+	}
+}
+
+func TestBackupAlignment(t *testing.T) {
+	main := []recordedSegment{seg(0, 10), seg(1, 11), seg(3, 13)}
+	shifted := []recordedSegment{seg(0, 20), seg(1, 21), seg(2, 22), seg(3, 23)} //备份的编号与主录制相差10
+	misnumbered := []recordedSegment{seg(0, 11), seg(1, 12), seg(2, 13)}         //同一序列号对应不同时间的片段
+	unsequenced := []recordedSegment{seg(0, -1), seg(2, -1)}
+	dated := func(segments []recordedSegment) []recordedSegment {
+		out := append([]recordedSegment(nil), segments...)
+		for i := range out {
+			out[i].dated = true
+		}
+		return out
+	}
+
+	tests := []struct {
+		name         string
+		main, backup []recordedSegment
+		byTime, ok   bool
+	}{
+		{"same numbering", main, []recordedSegment{seg(0, 10), seg(2, 12)}, false, true},
+		{"no common sequence number", main, shifted, false, false},
+		{"different numbering", main, misnumbered, false, false},
+		{"unsequenced backup", main, unsequenced, false, false},
+		{"program date time", dated(main), dated(misnumbered), true, true},
+	}
+	for _, tt := range tests {
+		if byTime, ok := backupAlignment(tt.main, tt.backup); byTime != tt.byTime || ok != tt.ok {
+			t.Errorf("%s: backupAlignment() = %v, %v; want %v, %v", tt.name, byTime, ok, tt.byTime, tt.ok)
+		}
+	}
+
+	// 编号方式不一致时不使用备份录制
+	dir := t.TempDir() + "/"
+	l := &Live{SaveDir: dir, rec: &recording{segments: main}}
+	backup := &Live{rec: &recording{segments: misnumbered}}
+	l.patchFromBackup(backup, false)
+	if segments, _ := l.rec.snapshot(); len(segments) != len(main) {
+		t.Errorf("got %d segments after patching from a misnumbered backup", len(segments))
+	}
+}
@@ -0,0 +1,96 @@
+package live
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+	"github.com/yliu7949/KouShare-dl/video"
+)
+
+var vidRe = regexp.MustCompile(`^\d+$`)
+
+// replayVid 从正式回放视频的地址中解析出视频的vid，解析失败时返回空字符串
+func (l *Live) replayVid() string {
+	u, err := url.Parse(strings.TrimSpace(l.rtmpURL))
+	if err != nil || l.rtmpURL == "" {
+		return ""
+	}
+	if vid := u.Query().Get("vid"); vidRe.MatchString(vid) {
+		return vid
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if vidRe.MatchString(parts[i]) {
+			return parts[i]
+		}
+	}
+	return ""
+}
+
+// followReplay 轮询直播间状态，正式回放或快速回放上线后自动下载至录制文件所在的文件夹，超时后放弃
+func (l *Live) followReplay() {
+	deadline := time.Now().Add(l.FollowTimeout)
+	fmt.Println("等待回放上线后自动下载...")
+	for {
+		l.getLiveByRoomID(true)
+		if l.isLive == "2" || l.isLive == "3" {
+			if vid := l.replayVid(); l.isLive == "3" && vid != "" {
+				fmt.Println()
+				l.downloadOfficialReplay(vid)
+				return
+			}
+			if l.quickReplayURL != "" {
+				fmt.Println()
+				l.downloadQuickReplay()
+				return
+			}
+			if l.playback == "0" {
+				fmt.Println("\n本场直播无回放。")
+				return
+			}
+		}
+		if !time.Now().Add(replayPollInterval).Before(deadline) {
+			fmt.Println(color.Highlight("\n等待回放上线超时。"))
+			return
+		}
+		fmt.Printf("\r 回放暂未上线，将于 %s 重新检查...", time.Now().Add(replayPollInterval).Format("15:04:05"))
+		time.Sleep(replayPollInterval)
+	}
+}
+
+// downloadOfficialReplay 使用视频下载流程下载正式回放视频，文件名与录制文件保持一致
+func (l *Live) downloadOfficialReplay(vid string) {
+	fmt.Printf("正式回放视频已上线（vid=%s），开始下载...\n", vid)
+	v := video.Video{
+		Vid:      vid,
+		SaveDir:  l.SaveDir,
+		FileName: l.fileBaseName() + "_正式回放",
+	}
+	v.DownloadSingleVideo(l.saveQuality())
+}
+
+// saveQuality 将录制的清晰度映射为下载视频时的清晰度：--quality standard（标清）对应low（标清）；
+// 指定 --max-height 时，1080及以上对应high（超清），720及以上对应standard（高清），其余对应low（标清）。
+func (l *Live) saveQuality() string {
+	quality := "high"
+	if l.Quality == "standard" {
+		quality = "low"
+	}
+	switch {
+	case l.MaxHeight <= 0 || l.MaxHeight >= 1080 || quality == "low":
+	case l.MaxHeight >= 720:
+		quality = "standard"
+	default:
+		quality = "low"
+	}
+	return quality
+}
+
+// downloadQuickReplay 下载快速回放视频，文件名与录制文件保持一致
+func (l *Live) downloadQuickReplay() {
+	l.recordVOD()
+}
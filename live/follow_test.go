@@ -0,0 +1,98 @@
+package live
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+func TestReplayVid(t *testing.T) {
+	tests := map[string]string{
+		"https://www.koushare.com/video/videodetail/35887":        "35887",
+		"https://www.koushare.com/video/videodetail/35887/":       "35887",
+		"https://www.koushare.com/video/videodetail?vid=35887":    "35887",
+		"https://www.koushare.com/video/videodetail/35887?from=1": "35887",
+		" https://www.koushare.com/video/videodetail/35887 ":      "35887",
+		"https://www.koushare.com/video/videodetail?vid=abc":      "",
+		"https://www.koushare.com/lives":                          "",
+		"":                                                        "",
+	}
+	for rtmpURL, want := range tests {
+		l := &Live{rtmpURL: rtmpURL}
+		if got := l.replayVid(); got != want {
+			t.Errorf("replayVid(%q) = %q, want %q", rtmpURL, got, want)
+		}
+	}
+}
+
+func TestFollowReplayOfficial(t *testing.T) {
+	content := []byte("official replay")
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/api-live/getLiveByRoomid":
+			// 直播已结束且正式回放已上线（islive为3），rtmpurl为正式回放视频的地址
+			_, _ = w.Write([]byte(`{"code":200,"data":{"ltitle":"报告会","livedate":"2023-07-15 08:30:00","islive":"3","playback":"1","lopen":"0",` +
+				`"rtmpurl":"https://www.koushare.com/video/videodetail/35887"}}`))
+		case "/api/api-video/getVideoById":
+			if r.URL.Query().Get("vid") != "35887" {
+				_, _ = w.Write([]byte(`{"code":500,"msg":"视频不存在"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":200,"data":{"vtitle":"报告会（正式回放）","easyurl":"` + srv.URL + `/replay.mp4"}}`))
+		case "/replay.mp4":
+			http.ServeContent(w, r, "replay.mp4", time.Time{}, bytes.NewReader(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	config.SetConfigDir(t.TempDir()) //未登录时下载标清视频
+	config.SetAPIBaseURL(srv.URL)
+
+	dir := t.TempDir() + "/"
+	l := &Live{RoomID: "751111", SaveDir: dir, FollowTimeout: time.Minute}
+	l.followReplay()
+
+	// 文件名与录制文件一致，以“_正式回放_<清晰度>”结尾
+	name := dir + "报告会_2023-07-15 08_30_00_正式回放_标清.mp4"
+	data, err := os.ReadFile(name)
+	if err != nil {
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("%v; files: %s", err, strings.Join(names, ", "))
+	}
+	if !bytes.Equal(data, content) {
+		t.Errorf("replay = %q", data)
+	}
+}
+
+func TestSaveQuality(t *testing.T) {
+	tests := []struct {
+		quality   string
+		maxHeight int64
+		want      string
+	}{
+		{"high", 0, "high"},
+		{"standard", 0, "low"},
+		{"high", 1080, "high"},
+		{"high", 720, "standard"},
+		{"high", 480, "low"},
+		{"standard", 1080, "low"},
+	}
+	for _, tt := range tests {
+		l := &Live{Quality: tt.quality, MaxHeight: tt.maxHeight}
+		if got := l.saveQuality(); got != tt.want {
+			t.Errorf("saveQuality(%s, %d) = %s, want %s", tt.quality, tt.maxHeight, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package live
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/user"
+)
+
+// hlsSegment 表示m3u8播放列表中的一个媒体片段
+type hlsSegment struct {
+	uri      string
+	duration float64   // #EXTINF 给出的时长（秒）
+	seq      int64     // 媒体序列号
+	offset   float64   // 片段开始时间距播放列表开头的秒数
+	date     time.Time // 由 #EXT-X-PROGRAM-DATE-TIME 推算出的片段开始时间，未给出时为零值
+}
+
+// hlsVariant 表示主播放列表（master playlist）中的一个子播放列表
+type hlsVariant struct {
+	uri       string
+	bandwidth int64
+	height    int64
+}
+
+// hlsPlaylist 是解析后的m3u8播放列表
+type hlsPlaylist struct {
+	segments  []hlsSegment
+	variants  []hlsVariant
+	sequenced bool // 是否含有 #EXT-X-MEDIA-SEQUENCE，否则片段的序列号仅在本列表内有意义
+	ended     bool // 是否含有 #EXT-X-ENDLIST
+}
+
+func (p *hlsPlaylist) totalDuration() float64 {
+	if len(p.segments) == 0 {
+		return 0
+	}
+	last := p.segments[len(p.segments)-1]
+	return last.offset + last.duration
+}
+
+// parseM3U8 解析m3u8文本，仅处理本程序用到的标签
+func parseM3U8(text string) hlsPlaylist {
+	var p hlsPlaylist
+	var seq int64
+	var offset float64
+	var duration float64
+	var date time.Time
+	var pending *hlsVariant
+
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			if v, err := strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64); err == nil {
+				seq = v
+				p.sequenced = true
+			}
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v := strings.TrimPrefix(line, "#EXTINF:")
+			if idx := strings.IndexByte(v, ','); idx >= 0 {
+				v = v[:idx]
+			}
+			duration, _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+		case strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:"):
+			v := strings.TrimPrefix(line, "#EXT-X-PROGRAM-DATE-TIME:")
+			if t, err := parseProgramDateTime(v); err == nil {
+				date = t
+			}
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			pending = &hlsVariant{}
+			attrs := parseAttributeList(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			pending.bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			if _, h, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+				pending.height, _ = strconv.ParseInt(h, 10, 64)
+			}
+		case line == "#EXT-X-ENDLIST":
+			p.ended = true
+		case strings.HasPrefix(line, "#"): //忽略其余的标签和注释
+			continue
+		case pending != nil || strings.Contains(line, ".m3u8"):
+			if pending == nil {
+				pending = &hlsVariant{}
+			}
+			pending.uri = line
+			p.variants = append(p.variants, *pending)
+			pending = nil
+		default:
+			p.segments = append(p.segments, hlsSegment{
+				uri:      line,
+				duration: duration,
+				seq:      seq,
+				offset:   offset,
+				date:     date,
+			})
+			seq++
+			offset += duration
+			if !date.IsZero() {
+				date = date.Add(time.Duration(duration * float64(time.Second)))
+			}
+			duration = 0
+		}
+	}
+	return p
+}
+
+func parseProgramDateTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析的时间：%s", v)
+}
+
+// parseAttributeList 解析形如 BANDWIDTH=1280000,RESOLUTION=1280x720,CODECS="a,b" 的属性列表
+func parseAttributeList(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.TrimSpace(key)] = value
+		s = strings.TrimPrefix(rest, ",")
+	}
+	return attrs
+}
+
+// fetchMediaPlaylist 获取rawURL对应的媒体播放列表。若rawURL指向网页或主播放列表，则自动跟随其中的m3u8地址，
+// 返回最终播放列表的地址及解析结果。
+func fetchMediaPlaylist(rawURL string) (string, hlsPlaylist, error) {
+	const maxDepth = 3
+	cur := rawURL
+	for depth := 0; depth < maxDepth; depth++ {
+		text, err := user.MyGetRequest(cur, map[string]string{"Accept": "*/*"})
+		if err != nil {
+			return "", hlsPlaylist{}, err
+		}
+		if !strings.Contains(text, "#EXTM3U") {
+			next := findFirstM3U8URL(text)
+			if next == "" {
+				return "", hlsPlaylist{}, fmt.Errorf("未在 %s 中找到m3u8播放列表", cur)
+			}
+			cur = next
+			continue
+		}
+
+		p := parseM3U8(text)
+		if len(p.segments) != 0 || len(p.variants) == 0 {
+			return cur, p, nil
+		}
+		best := p.variants[0]
+		for _, v := range p.variants[1:] {
+			if v.height > best.height || (v.height == best.height && v.bandwidth > best.bandwidth) {
+				best = v
+			}
+		}
+		next, ok := resolveURL(cur, best.uri)
+		if !ok {
+			return "", hlsPlaylist{}, fmt.Errorf("无效的播放列表地址：%s", best.uri)
+		}
+		cur = next
+	}
+	return "", hlsPlaylist{}, fmt.Errorf("播放列表嵌套层数过多")
+}
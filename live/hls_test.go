@@ -0,0 +1,79 @@
+package live
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseM3U8_MediaPlaylist(t *testing.T) {
+	text := "#EXTM3U\n" +
+		"#EXT-X-TARGETDURATION:4\n" +
+		"#EXT-X-MEDIA-SEQUENCE:100\n" +
+		"#EXT-X-PROGRAM-DATE-TIME:2023-07-15T10:30:00.000+08:00\n" +
+		"#EXTINF:4.000,\n" +
+		"seg100.ts?token=a\n" +
+		"#EXTINF:3.500,\n" +
+		"seg101.ts\n" +
+		"#EXT-X-ENDLIST\n"
+
+	p := parseM3U8(text)
+	if !p.sequenced || !p.ended {
+		t.Fatalf("expected sequenced and ended playlist, got %+v", p)
+	}
+	if len(p.segments) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(p.segments))
+	}
+	second := p.segments[1]
+	if second.seq != 101 || second.offset != 4 || second.duration != 3.5 {
+		t.Fatalf("unexpected second segment: %+v", second)
+	}
+	want := time.Date(2023, 7, 15, 10, 30, 4, 0, serverLocation)
+	if !second.date.Equal(want) {
+		t.Fatalf("expected second segment at %v, got %v", want, second.date)
+	}
+	if got := p.totalDuration(); got != 7.5 {
+		t.Fatalf("expected total duration 7.5, got %v", got)
+	}
+	if got := segmentBaseName(p.segments[0].uri); got != "seg100" {
+		t.Fatalf("unexpected base name %q", got)
+	}
+}
+
+func TestParseM3U8_MasterPlaylist(t *testing.T) {
+	text := "#EXTM3U\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS=\"avc1.4d401e,mp4a.40.2\"\n" +
+		"360p/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720\n" +
+		"720p/index.m3u8\n"
+
+	p := parseM3U8(text)
+	if len(p.segments) != 0 || len(p.variants) != 2 {
+		t.Fatalf("unexpected playlist: %+v", p)
+	}
+	if v := p.variants[1]; v.uri != "720p/index.m3u8" || v.height != 720 || v.bandwidth != 2800000 {
+		t.Fatalf("unexpected variant: %+v", v)
+	}
+}
+
+func TestRecordingGaps(t *testing.T) {
+	base := time.Date(2023, 7, 15, 10, 30, 0, 0, serverLocation)
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	var r recording
+	r.add(recordedSegment{name: "a", seq: 1, duration: 4, start: at(0)})
+	r.add(recordedSegment{name: "b", seq: 2, duration: 4, start: at(4)})
+	r.add(recordedSegment{name: "e", seq: 5, duration: 4, start: at(16)}) // 序列号跳变
+	r.add(recordedSegment{name: "x", seq: -1, duration: 4, start: at(20)})
+	r.add(recordedSegment{name: "y", seq: -1, duration: 4, start: at(60)}) // 时间跳变
+
+	gaps := r.gaps()
+	if len(gaps) != 2 {
+		t.Fatalf("expected 2 gaps, got %+v", gaps)
+	}
+	if gaps[0].after != 1 || !gaps[0].from.Equal(at(8)) || !gaps[0].to.Equal(at(16)) {
+		t.Fatalf("unexpected first gap: %+v", gaps[0])
+	}
+	if gaps[1].after != 3 || !gaps[1].from.Equal(at(24)) || !gaps[1].to.Equal(at(60)) {
+		t.Fatalf("unexpected second gap: %+v", gaps[1])
+	}
+}
@@ -2,10 +2,11 @@ package live
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -15,10 +16,14 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/yliu7949/KouShare-dl/internal/color"
 	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/prompt"
 	"github.com/yliu7949/KouShare-dl/internal/proxy"
 	"github.com/yliu7949/KouShare-dl/user"
 )
 
+// serverLocation 为蔻享接口返回的时间所使用的时区（北京时间）
+var serverLocation = time.FixedZone("CST", 8*60*60)
+
 // Live 包含房间号、直播链接和直播状态等信息
 type Live struct {
 	lid            string
@@ -32,6 +37,7 @@ type Live struct {
 	clicks         string // 点击量
 	topicName      string // 专题/回放
 	m3u8URL        string
+	backupM3u8URL  string // 另一清晰度的直播地址，用于双路备份录制
 	newTsURL       string
 	quickReplayURL string // 快速回放地址
 	rtmpURL        string // 正式回放视频地址
@@ -40,41 +46,63 @@ type Live struct {
 	Password       string // 观看直播间需要输入的密码
 	statusCode     string // 获取直播信息时返回的状态码，301即需要密码或密码不正确；200即请求成功（无需密码或密码正确）。
 	SaveDir        string
+	Quality        string        // 录制的清晰度，high为高清（默认），standard为标清
+	Backup         bool          // 是否同时录制两种清晰度，用另一清晰度的录制填补主录制中的缺口
+	ServeAddr      string        // 本地回看服务的监听地址，为空则不启动
+	TimeZone       string        // 解析 --at 指定的开播时间时使用的时区，为空则使用本地时区
+	Lead           time.Duration // 提前开始轮询直播状态的时间
+	Part           int           // 要下载的回放序号（从1开始），为0时下载第一段回放
+	AllParts       bool          // 是否下载全部回放
+	MaxHeight      int64         // 下载回放时清晰度（视频高度）的上限，为0表示不限制
+	Jobs           int           // 并发下载快速回放片段的数量
+	From           time.Duration // 下载回放时截取的开始时间，为0表示从头开始
+	To             time.Duration // 下载回放时截取的结束时间，为0表示至回放结尾
+
+	Backfill        bool          // 直播结束后是否从回放中回填录制缺口
+	BackfillTimeout time.Duration // 等待回放上线的最长时间
+	FollowReplay    bool          // 录制结束后是否等待并自动下载回放视频
+	FollowTimeout   time.Duration // 等待回放上线的最长时间
+
+	nameSuffix string // 合并保存片段时文件名的后缀，用于区分录制文件与回放文件
+	quiet      bool   // 录制时是否不输出片段名，用于后台进行的备份录制
+
+	newTs    hlsSegment   // 最新片段在m3u8中的信息
+	newTsSeq bool         // 最新片段的序列号是否可用
+	rec      *recording   // 本次录制的片段记录
+	server   *http.Server // 本地回看服务，录制结束后、回填或补录修改片段之前关闭
 }
 
 // WaitAndRecordTheLive 倒计时结束后开始录制直播
 func (l *Live) WaitAndRecordTheLive(liveTime string, autoMerge bool) {
+	var at time.Time // --at 指定的开播时间
 	if liveTime != "" {
-		loc, _ := time.LoadLocation("Local")
-		parsedTime, err := time.ParseInLocation("2006-01-02 15:04:05", liveTime, loc)
+		loc, err := l.location()
+		if err != nil {
+			fmt.Println("时区解析出错：", err)
+			return
+		}
+		parsedTime, err := parseStartTime(liveTime, loc, time.Now())
 		if err != nil {
 			fmt.Println("时间解析出错：", err)
 			return
 		}
-		fmt.Println("设定的直播时间为：", parsedTime)
-		deltaTime, _ := time.ParseDuration(fmt.Sprint(parsedTime.Unix()-time.Now().Unix()) + "s")
-		go func() {
-			for {
-				if parsedTime.Unix()-time.Now().Unix() <= 0 {
-					fmt.Println("\n直播时间到。")
-					return
-				}
-				fmt.Printf("\r 还有%d秒开始直播...", parsedTime.Unix()-time.Now().Unix())
-				time.Sleep(time.Second)
-			}
-		}()
-		time.Sleep(deltaTime)
+		fmt.Println("设定的直播时间为：", parsedTime.In(loc))
+		waitUntil(parsedTime.Add(-l.Lead))
+		at = parsedTime
 	}
 
 	if !l.getLidByRoomID() {
 		return
 	}
 	l.checkLiveStatus()
-	if l.needPassword == "1" && l.Password == "" {
+	if l.needPassword == "1" && l.Password == "" && !l.askPassword("该直播间需要密码，请输入密码：") {
 		fmt.Println(color.Highlight("该直播间需要密码，请使用 --password 参数指定密码。"))
 		return
 	}
-	l.getLiveByRoomID(true)
+	l.getLiveByRoomID(l.Quality != "standard")
+	for i := 0; i < maxPasswordAttempts && l.statusCode == "301" && l.askPassword("直播间密码不正确，请重新输入："); i++ {
+		l.getLiveByRoomID(l.Quality != "standard")
+	}
 
 	if l.statusCode == "301" {
 		fmt.Println(color.Highlight("直播间密码不正确。"))
@@ -85,36 +113,15 @@ func (l *Live) WaitAndRecordTheLive(liveTime string, autoMerge bool) {
 		switch l.isLive {
 		case "0":
 			fmt.Printf("直播尚未开始，开播时间为 %s，倒计时结束后将自动开始录制。\n", l.date)
-			loc, _ := time.LoadLocation("Local")
-			parsedTime, err := time.ParseInLocation("2006-01-02 15:04:05", l.date, loc)
+			parsedTime, err := startAfter(l.date, at)
 			if err != nil {
 				fmt.Println("直播时间解析出错：", err)
 				return
 			}
-			deltaTime, _ := time.ParseDuration(fmt.Sprint(parsedTime.Unix()-time.Now().Unix()) + "s")
-			formatDuration := func(seconds int64) string {
-				duration := time.Duration(seconds) * time.Second
-				days := duration / (24 * time.Hour)
-				duration -= days * (24 * time.Hour)
-				hours := duration / time.Hour
-				duration -= hours * time.Hour
-				minutes := duration / time.Minute
-				duration -= minutes * time.Minute
-				seconds = int64(duration.Seconds())
-
-				return fmt.Sprintf("距开播：%02d天%02d时%02d分%02d秒", days, hours, minutes, seconds)
+			waitUntil(parsedTime.Add(-l.Lead))
+			if !l.waitForLiveStart(parsedTime) {
+				return
 			}
-			go func() {
-				for {
-					if parsedTime.Unix()-time.Now().Unix() <= 0 {
-						fmt.Println("\n直播时间到。")
-						return
-					}
-					fmt.Printf("\r %s...", formatDuration(parsedTime.Unix()-time.Now().Unix()))
-					time.Sleep(time.Second)
-				}
-			}()
-			time.Sleep(deltaTime)
 		case "2":
 			msg = "直播已结束。"
 			if l.quickReplayURL != "" {
@@ -126,14 +133,21 @@ func (l *Live) WaitAndRecordTheLive(liveTime string, autoMerge bool) {
 				msg += "快速回放暂未上线。"
 			}
 			fmt.Println(msg)
+			if l.FollowReplay {
+				l.followReplay()
+			}
 			return
 		case "3":
 			msg = "正式回放视频已上线。"
-			if l.rtmpURL != "" {
-				vid := strings.Split(l.rtmpURL, "/")[len(strings.Split(l.rtmpURL, "/"))-1]
+			if vid := l.replayVid(); vid != "" {
 				msg += fmt.Sprintf(`访问 %s 观看录播视频或使用“ks save %s”命令下载正式回放视频。`, l.rtmpURL, vid)
+			} else if l.rtmpURL != "" {
+				msg += fmt.Sprintf(`访问 %s 观看录播视频。`, l.rtmpURL)
 			}
 			fmt.Println(msg)
+			if l.FollowReplay {
+				l.followReplay()
+			}
 			return
 		default:
 			fmt.Println("直播未按时开始或已结束。")
@@ -142,9 +156,24 @@ func (l *Live) WaitAndRecordTheLive(liveTime string, autoMerge bool) {
 	}
 
 	fmt.Println("运行录制程序...")
-	l.recordLive(autoMerge)
+	l.rec = &recording{}
+	if l.ServeAddr != "" {
+		l.server = l.serveRecording(l.ServeAddr)
+	}
+	if l.Backup {
+		l.recordWithBackup(autoMerge)
+	} else {
+		l.recordLive(autoMerge)
+	}
+	l.stopServing()
 
 	fmt.Println("录制结束.")
+	if l.Backfill {
+		l.backfillRecording(autoMerge)
+	}
+	if l.FollowReplay {
+		l.followReplay()
+	}
 }
 
 func (l *Live) getLidByRoomID() bool {
@@ -161,6 +190,19 @@ func (l *Live) getLidByRoomID() bool {
 	return true
 }
 
+// maxPasswordAttempts 为密码不正确时重新输入的最多次数
+const maxPasswordAttempts = 3
+
+// askPassword 在终端中提示输入直播间密码，输入的内容不会显示。无法输入或输入为空时返回false。
+func (l *Live) askPassword(label string) bool {
+	password, err := prompt.Password(label)
+	if err != nil || password == "" {
+		return false
+	}
+	l.Password = password
+	return true
+}
+
 func (l *Live) checkLiveStatus() {
 	URL := config.APIBaseURL() + "/api/api-live/checkLiveStatus?initial=1&lid=" + l.lid
 	if str, err := user.MyGetRequest(URL); err != nil {
@@ -173,10 +215,10 @@ func (l *Live) checkLiveStatus() {
 
 func (l *Live) getLiveByRoomID(chooseHighQuality bool) {
 	URL := config.APIBaseURL() + "/api/api-live/getLiveByRoomid?roomid=" + l.RoomID + "&allData=1"
-	if l.needPassword == "1" {
+	if l.needPassword == "1" || l.Password != "" {
 		URL = fmt.Sprintf("%s/api/api-live/getLiveByRoomid?roomid=%s&password=%s&allData=1",
 			config.APIBaseURL(),
-			l.RoomID, l.Password)
+			l.RoomID, url.QueryEscape(l.Password))
 	}
 
 	str, err := user.MyGetRequest(URL)
@@ -196,8 +238,10 @@ func (l *Live) getLiveByRoomID(chooseHighQuality bool) {
 	l.isLive = gjson.Get(str, "data.islive").String()
 	if chooseHighQuality {
 		l.m3u8URL = gjson.Get(str, "data.hlsurl").String()
+		l.backupM3u8URL = gjson.Get(str, "data.bqhlsurl").String()
 	} else {
 		l.m3u8URL = gjson.Get(str, "data.bqhlsurl").String()
+		l.backupM3u8URL = gjson.Get(str, "data.hlsurl").String()
 	}
 	l.quickReplayURL = gjson.Get(str, "data.lnoticeurl").String()
 	l.rtmpURL = gjson.Get(str, "data.rtmpurl").String()
@@ -249,16 +293,41 @@ func (l *Live) recordLive(autoMerge bool) {
 		return
 	}
 
+	if l.rec == nil {
+		l.rec = &recording{}
+	}
+	defer l.rec.finish()
 	var url string
 	for {
 		l.getNewTsURLBym3u8()
 		if l.newTsURL != url {
 			url = l.newTsURL
-			fmt.Println(strings.Split(l.newTsURL[29:], ".")[0], "...")
+			name := strings.Split(l.newTsURL[29:], ".")[0]
+			if !l.quiet {
+				fmt.Println(name, "...")
+			}
+			//片段出现在m3u8中时已完整生成，因此未给出节目时间时以当前时间减去片段时长估计其开始时间
+			start := l.newTs.date
+			if start.IsZero() {
+				start = time.Now().Add(-time.Duration(l.newTs.duration * float64(time.Second)))
+			}
+			var seg recordedSegment
+			var ok bool
 			if autoMerge {
-				l.downloadAndMergeTsFile()
+				seg, ok = l.downloadAndMergeTsFile()
 			} else {
-				l.downloadTsFile()
+				seg, ok = l.downloadTsFile()
+			}
+			if ok {
+				seg.name = name
+				seg.seq = -1
+				if l.newTsSeq {
+					seg.seq = l.newTs.seq
+				}
+				seg.duration = l.newTs.duration
+				seg.start = start
+				seg.dated = !l.newTs.date.IsZero()
+				l.rec.add(seg)
 			}
 		}
 		time.Sleep(100 * time.Millisecond)
@@ -275,84 +344,85 @@ func (l *Live) getNewTsURLBym3u8() {
 		fmt.Println("Get请求出错：", err)
 		return
 	}
-	lines := strings.Split(str, "\n")
-	l.newTsURL = "https://live.am-hpc.com/live/" + lines[len(lines)-2 : len(lines)-1][0]
+	p := parseM3U8(str)
+	if len(p.segments) == 0 {
+		return
+	}
+	l.newTs = p.segments[len(p.segments)-1]
+	l.newTsSeq = p.sequenced
+	l.newTsURL = "https://live.am-hpc.com/live/" + l.newTs.uri
 }
 
-func (l *Live) downloadTsFile() {
+func (l *Live) downloadTsFile() (recordedSegment, bool) {
 	if l.SaveDir != "" {
 		if err := os.MkdirAll(l.SaveDir, os.ModePerm); err != nil {
 			fmt.Println("创建下载文件夹失败：", err)
-			return
+			return recordedSegment{}, false
 		}
 	}
 
-	req, err := http.NewRequest(http.MethodGet, l.newTsURL, nil)
-	if err != nil {
-		fmt.Println(err.Error())
-		return
-	}
-	req.Header.Set("Accept", "*/*")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("Accept-Language", "zh-CN")
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Origin", config.WebBaseURL())
-	req.Header.Set("Referer", config.WebBaseURL())
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
-	resp, _ := proxy.Client.Do(req)
-	defer func() {
-		err = resp.Body.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
-
 	name := strings.Split(l.newTsURL[29:], ".")[0]
 	fileName := l.SaveDir + name + ".tmp"
-	dstFile, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	dstFile, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
 		fmt.Println(err.Error())
-		return
+		return recordedSegment{}, false
 	}
-	if _, err = io.Copy(dstFile, resp.Body); err != nil {
+	n, err := fetchSegment(dstFile, l.newTsURL)
+	_ = dstFile.Close()
+	if err != nil {
 		fmt.Println(err.Error())
-		return
+		return recordedSegment{}, false
 	}
-	_ = dstFile.Close()
 	if err = os.Rename(fileName, l.SaveDir+name+".ts"); err != nil {
 		fmt.Println(err.Error())
-		return
+		return recordedSegment{}, false
 	}
+	return recordedSegment{file: l.SaveDir + name + ".ts", size: n}, true
 }
 
-func (l *Live) downloadAndMergeTsFile() {
+func (l *Live) downloadAndMergeTsFile() (recordedSegment, bool) {
 	if l.SaveDir != "" {
 		if err := os.MkdirAll(l.SaveDir, os.ModePerm); err != nil {
 			fmt.Println("创建下载文件夹失败：", err)
-			return
+			return recordedSegment{}, false
 		}
 	}
 
-	req, err := http.NewRequest(http.MethodGet, l.newTsURL, nil)
+	fileName := l.SaveDir + l.mergedFileName()
+	dstFile, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
 	if err != nil {
 		fmt.Println(err.Error())
-		return
+		return recordedSegment{}, false
 	}
-	req.Header.Set("Accept", "*/*")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("Accept-Language", "zh-CN")
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Origin", config.WebBaseURL())
-	req.Header.Set("Referer", config.WebBaseURL())
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
-	resp, _ := proxy.Client.Do(req)
-	defer func() {
-		err = resp.Body.Close()
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
+	defer dstFile.Close()
+	info, err := dstFile.Stat()
+	if err != nil {
+		fmt.Println(err.Error())
+		return recordedSegment{}, false
+	}
+
+	//先将片段完整下载至内存，避免下载失败时在合并文件中留下不完整的片段
+	var buf bytes.Buffer
+	if _, err = fetchSegment(&buf, l.newTsURL); err != nil {
+		fmt.Println(err.Error())
+		return recordedSegment{}, false
+	}
+	n, err := buf.WriteTo(dstFile)
+	if err != nil {
+		fmt.Println(err.Error())
+		return recordedSegment{}, false
+	}
+	return recordedSegment{file: fileName, offset: info.Size(), size: n}, true
+}
+
+// mergedFileName 返回自动合并录制的片段时使用的文件名
+func (l *Live) mergedFileName() string {
+	return l.fileBaseName() + l.nameSuffix + ".ts"
+}
 
+// fileBaseName 返回由直播标题和开播时间组成的文件名（不含扩展名），录制文件与回放文件均以此命名
+func (l *Live) fileBaseName() string {
 	// 过滤视频标题中的不合法字符
 	reg, _ := regexp.Compile(`[\\/:*?"<>|]`)
 	title := reg.ReplaceAllString(l.title, "")
@@ -364,27 +434,39 @@ func (l *Live) downloadAndMergeTsFile() {
 		}
 	}
 	datePart := strings.Replace(l.date, ":", "_", -1)
-	if strings.TrimSpace(datePart) == "" {
-		datePart = time.Now().Format("2006-01-02_15-04-05")
+	if strings.TrimSpace(datePart) == "" { //开播时间未知时以直播场次区分，保证重复运行时文件名不变
+		datePart = "room" + l.RoomID
+		if l.lid != "" {
+			datePart += "_" + l.lid
+		}
 	}
-	fileName := l.SaveDir + fmt.Sprintf("%s_%s.ts", title, datePart)
-	dstFile, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	return title + "_" + datePart
+}
+
+// fetchSegment 下载URL对应的视频片段并写入w，返回写入的字节数
+func fetchSegment(w io.Writer, URL string) (int64, error) {
+	req, err := http.NewRequest(http.MethodGet, URL, nil)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return 0, err
 	}
-	defer dstFile.Close()
-	write := bufio.NewWriter(dstFile)
-	_, err = write.ReadFrom(resp.Body)
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	req.Header.Set("Accept-Language", "zh-CN")
+	req.Header.Set("Connection", "keep-alive")
+	req.Header.Set("Origin", config.WebBaseURL())
+	req.Header.Set("Referer", config.WebBaseURL())
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	resp, err := proxy.Client.Do(req)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return 0, err
 	}
-	err = write.Flush()
-	if err != nil {
-		fmt.Println(err.Error())
-		return
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("下载片段失败：%s", resp.Status)
 	}
+	return io.Copy(w, resp.Body)
 }
 
 // MergeTsFiles 将录制得到的众多.ts文件合并为一个.mp4文件
@@ -392,7 +474,16 @@ func MergeTsFiles(dir string, dstFileName string) {
 	fmt.Println("开始合并视频文件...")
 	var tsFiles []string
 	_ = filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-		if f.IsDir() || len(f.Name()) < 2 || f.Name() == dstFileName {
+		if err != nil {
+			return nil
+		}
+		if f.IsDir() {
+			if filepath.Clean(path) != filepath.Clean(dir) { //不合并子文件夹中的文件
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(f.Name()) < 3 || f.Name() == dstFileName {
 			return nil
 		}
 		if f.Name()[len(f.Name())-3:] == ".ts" {
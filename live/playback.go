@@ -0,0 +1,174 @@
+package live
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"github.com/yliu7949/KouShare-dl/internal/color"
+	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/user"
+)
+
+// playbackRendition 是一段回放的一种清晰度
+type playbackRendition struct {
+	url    string
+	width  int64
+	height int64
+	name   string // 接口给出的清晰度名称，可能为空
+}
+
+// playbackPart 是一场直播中的一段回放，例如上午场和下午场
+type playbackPart struct {
+	name       string
+	renditions []playbackRendition
+}
+
+func (p playbackPart) displayName(i int) string {
+	if p.name != "" {
+		return p.name
+	}
+	return fmt.Sprintf("回放%d", i+1)
+}
+
+// pick 返回高度不超过maxHeight的最高清晰度，maxHeight为0表示不限制；所有清晰度均超过maxHeight时返回最低的清晰度
+func (p playbackPart) pick(maxHeight int64) (playbackRendition, bool) {
+	var best, lowest playbackRendition
+	var found bool
+	for _, r := range p.renditions {
+		if lowest.url == "" || r.height < lowest.height {
+			lowest = r
+		}
+		if maxHeight > 0 && r.height > maxHeight {
+			continue
+		}
+		if !found || r.height > best.height {
+			best = r
+			found = true
+		}
+	}
+	if !found {
+		return lowest, lowest.url != ""
+	}
+	return best, true
+}
+
+// fetchPlaybacks 通过新版回放接口获取直播间的全部回放及其清晰度
+func (l *Live) fetchPlaybacks() ([]playbackPart, error) {
+	playbackURL := config.APIBaseURL() + "/live/v2/live/playback/" + l.RoomID + "?videoId=" + url.QueryEscape(l.VideoID)
+	resp, err := user.MyRequest(http.MethodPost, playbackURL, []byte("{}"))
+	if err != nil {
+		return nil, fmt.Errorf("Get请求出错：%w", err)
+	}
+
+	if gjson.Get(resp, "code").Int() != 200000 {
+		msg := gjson.Get(resp, "msg").String()
+		if msg == "" {
+			msg = "请求失败"
+		}
+		return nil, errors.New(msg)
+	}
+
+	var parts []playbackPart
+	for _, item := range gjson.Get(resp, "data.playbackUrls").Array() {
+		part := playbackPart{
+			name: firstNonEmpty(
+				item.Get("name").String(),
+				item.Get("title").String(),
+				item.Get("videoName").String(),
+			),
+		}
+		for _, r := range item.Get("list").Array() {
+			fileURL := r.Get("fileUrl").String()
+			if fileURL == "" {
+				continue
+			}
+			part.renditions = append(part.renditions, playbackRendition{
+				url:    fileURL,
+				width:  r.Get("width").Int(),
+				height: r.Get("height").Int(),
+				name: firstNonEmpty(
+					r.Get("definitionName").String(),
+					r.Get("definition").String(),
+					r.Get("name").String(),
+				),
+			})
+		}
+		if len(part.renditions) != 0 {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, errors.New("未获取到可下载的回放播放地址（可能需要登录/权限）。")
+	}
+	return parts, nil
+}
+
+// fetchPlaybackURL 通过新版回放接口获取第一段回放中符合清晰度限制的播放地址及其高度
+func (l *Live) fetchPlaybackURL() (string, int64, error) {
+	parts, err := l.fetchPlaybacks()
+	if err != nil {
+		return "", 0, err
+	}
+	r, _ := parts[0].pick(l.MaxHeight)
+	return r.url, r.height, nil
+}
+
+// selectParts 根据 --part 和 --all-parts 参数返回要下载的回放的下标
+func (l *Live) selectParts(parts []playbackPart) ([]int, error) {
+	if len(parts) == 0 {
+		return nil, errors.New("该直播间没有可下载的回放。")
+	}
+	if l.AllParts {
+		selected := make([]int, len(parts))
+		for i := range parts {
+			selected[i] = i
+		}
+		return selected, nil
+	}
+	part := l.Part
+	if part == 0 {
+		part = 1
+	}
+	if part < 1 || part > len(parts) {
+		return nil, fmt.Errorf("回放片段 %d 不存在，该直播间共有 %d 段回放，可使用“ks replay list %s”查看。", part, len(parts), l.RoomID)
+	}
+	return []int{part - 1}, nil
+}
+
+// ListReplays 列出直播间的全部回放及其可选的清晰度
+func (l *Live) ListReplays() {
+	if !l.resolveVideoID() {
+		fmt.Println("未能自动获取回放对应的 videoId，请使用 --videoId 参数指定。")
+		return
+	}
+	parts, err := l.fetchPlaybacks()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if strings.TrimSpace(l.title) != "" {
+		fmt.Printf("%s (roomID=%s):\n", l.title, l.RoomID)
+	} else {
+		fmt.Printf("roomID=%s:\n", l.RoomID)
+	}
+	for i, part := range parts {
+		fmt.Printf("\n\t[%d] %s\n", i+1, color.Emphasize(part.displayName(i)))
+		for _, r := range part.renditions {
+			line := fmt.Sprintf("\t    %-7s", strconv.FormatInt(r.height, 10)+"p")
+			if r.width > 0 {
+				line += fmt.Sprintf(" %dx%d", r.width, r.height)
+			}
+			if r.name != "" {
+				line += "  " + r.name
+			}
+			fmt.Println(line)
+		}
+	}
+	fmt.Printf("\n使用“ks record %s --replay --part N”下载指定的回放，或使用“--all-parts”下载全部回放；使用“--max-height 720”限制清晰度。\n", l.RoomID)
+}
@@ -0,0 +1,67 @@
+package live
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPick(t *testing.T) {
+	part := playbackPart{renditions: []playbackRendition{
+		{url: "720.m3u8", height: 720},
+		{url: "1080.m3u8", height: 1080},
+		{url: "480.m3u8", height: 480},
+	}}
+	tests := []struct {
+		part      playbackPart
+		maxHeight int64
+		want      string
+		ok        bool
+	}{
+		{part, 0, "1080.m3u8", true},
+		{part, 1080, "1080.m3u8", true},
+		{part, 1000, "720.m3u8", true},
+		{part, 720, "720.m3u8", true},
+		{part, 480, "480.m3u8", true},
+		{part, 360, "480.m3u8", true}, //均超过限制时选择最低的清晰度
+		{part, -1, "1080.m3u8", true},
+		{playbackPart{}, 0, "", false},
+		{playbackPart{}, 720, "", false},
+	}
+	for _, tt := range tests {
+		r, ok := tt.part.pick(tt.maxHeight)
+		if r.url != tt.want || ok != tt.ok {
+			t.Errorf("pick(%d) with %d renditions = %q, %v; want %q, %v", tt.maxHeight, len(tt.part.renditions), r.url, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSelectParts(t *testing.T) {
+	three := make([]playbackPart, 3)
+	tests := []struct {
+		part     int
+		allParts bool
+		parts    []playbackPart
+		want     string
+	}{
+		{0, false, three, "[0]"}, //未指定 --part 时为第一段
+		{1, false, three, "[0]"},
+		{3, false, three, "[2]"},
+		{4, false, three, "error"},
+		{-1, false, three, "error"},
+		{0, true, three, "[0 1 2]"},
+		{5, true, three, "[0 1 2]"}, //--all-parts 优先于 --part
+		{0, false, nil, "error"},
+		{0, true, nil, "error"},
+	}
+	for _, tt := range tests {
+		l := &Live{RoomID: "1", Part: tt.part, AllParts: tt.allParts}
+		selected, err := l.selectParts(tt.parts)
+		got := fmt.Sprint(selected)
+		if err != nil {
+			got = "error"
+		}
+		if got != tt.want {
+			t.Errorf("selectParts(part=%d, all=%v) with %d parts = %s, want %s", tt.part, tt.allParts, len(tt.parts), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package live
+
+import (
+	"sync"
+	"time"
+)
+
+// recordedSegment 记录一个已录制的直播片段
+type recordedSegment struct {
+	name     string    // 片段名（不含扩展名）
+	seq      int64     // 媒体序列号，未知时为-1
+	duration float64   // 片段时长（秒）
+	start    time.Time // 片段开始的时间
+	dated    bool      // start是否来自 #EXT-X-PROGRAM-DATE-TIME，否则为录制时估计的时间
+	file     string    // 保存片段的文件
+	offset   int64     // 片段在文件中的起始位置，自动合并时多个片段保存在同一文件中
+	size     int64
+}
+
+func (s recordedSegment) end() time.Time {
+	return s.start.Add(time.Duration(s.duration * float64(time.Second)))
+}
+
+// recording 保存一次直播录制中已录制的全部片段，可被多个goroutine同时访问
+type recording struct {
+	mu       sync.Mutex
+	segments []recordedSegment
+	ended    bool
+}
+
+func (r *recording) add(s recordedSegment) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.segments = append(r.segments, s)
+}
+
+// replace 用补录后的片段替换已录制的片段
+func (r *recording) replace(segments []recordedSegment) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.segments = segments
+}
+
+func (r *recording) finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ended = true
+}
+
+// snapshot 返回已录制片段的副本以及录制是否已结束
+func (r *recording) snapshot() ([]recordedSegment, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]recordedSegment(nil), r.segments...), r.ended
+}
+
+// recordingGap 表示录制过程中缺失的一段时间
+type recordingGap struct {
+	after    int // 缺口之前最后一个已录制片段的下标
+	from, to time.Time
+}
+
+// gaps 根据媒体序列号和片段时间找出录制中的缺口（断网、休眠等造成）
+func (r *recording) gaps() []recordingGap {
+	segments, _ := r.snapshot()
+	var gaps []recordingGap
+	for i := 1; i < len(segments); i++ {
+		prev, cur := segments[i-1], segments[i]
+		missing := prev.seq >= 0 && cur.seq > prev.seq+1
+		if !missing {
+			// 序列号不可用或被重置时，依据时间判断，允许一个片段时长（至少2秒）的误差
+			tolerance := time.Duration(prev.duration * float64(time.Second))
+			if tolerance < 2*time.Second {
+				tolerance = 2 * time.Second
+			}
+			missing = cur.start.Sub(prev.end()) > tolerance
+		}
+		if missing {
+			gaps = append(gaps, recordingGap{after: i - 1, from: prev.end(), to: cur.start})
+		}
+	}
+	return gaps
+}
@@ -4,12 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
-	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -17,14 +15,20 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/yliu7949/KouShare-dl/internal/color"
 	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/timecode"
 	"github.com/yliu7949/KouShare-dl/user"
 )
 
-// DownloadReplayVideo 下载指定直播间的快速回放视频
+// DownloadReplayVideo 下载指定直播间的快速回放视频。优先使用新版回放接口，未能获取 videoId 或新版接口下载失败时使用旧版接口。
 func (l *Live) DownloadReplayVideo() {
+	if l.VideoID == "" && l.resolveVideoID() {
+		fmt.Printf("已自动获取回放对应的 videoId：%s\n", l.VideoID)
+	}
 	if l.VideoID != "" {
-		l.downloadReplayViaAPICore()
-		return
+		if l.downloadReplayViaAPICore() {
+			return
+		}
+		fmt.Println("新版回放接口不可用，尝试使用旧版接口下载快速回放...")
 	}
 
 	if !l.getLidByRoomID() {
@@ -49,23 +53,30 @@ func (l *Live) DownloadReplayVideo() {
 			fmt.Println("本场直播无回放。")
 		} else if l.playback == "1" {
 			fmt.Println("快速回放暂未上线。")
+			if l.FollowReplay {
+				l.followReplay()
+			}
 		}
 	case "3":
 		fmt.Println("正式回放视频已上线。")
-		if l.rtmpURL != "" {
-			vid := strings.Split(l.rtmpURL, "/")[len(strings.Split(l.rtmpURL, "/"))-1]
+		if vid := l.replayVid(); vid != "" && l.FollowReplay {
+			l.downloadOfficialReplay(vid)
+		} else if vid != "" {
 			fmt.Printf("访问 %s 观看录播视频或使用“ks save %s”命令下载正式回放视频。\n", l.rtmpURL, vid)
+		} else if l.rtmpURL != "" {
+			fmt.Printf("访问 %s 观看录播视频。\n", l.rtmpURL)
 		}
 	default:
 		fmt.Println("暂时无法下载回放视频。")
 	}
 }
 
-func (l *Live) downloadReplayViaAPICore() {
+// downloadReplayViaAPICore 通过新版回放接口下载回放视频。接口未返回可下载的回放时返回false，以便改用旧版接口。
+func (l *Live) downloadReplayViaAPICore() bool {
 	if l.SaveDir != "" {
 		if err := os.MkdirAll(l.SaveDir, os.ModePerm); err != nil {
 			fmt.Println("创建下载文件夹失败：", err)
-			return
+			return true
 		}
 	}
 
@@ -74,62 +85,66 @@ func (l *Live) downloadReplayViaAPICore() {
 		fmt.Printf("回放标题：%s\n", color.Emphasize(l.title))
 	}
 
-	playbackURL := config.APIBaseURL() + "/live/v2/live/playback/" + l.RoomID + "?videoId=" + url.QueryEscape(l.VideoID)
-	resp, err := user.MyRequest(http.MethodPost, playbackURL, []byte("{}"))
+	parts, err := l.fetchPlaybacks()
 	if err != nil {
-		fmt.Println("Get请求出错：", err)
-		return
+		fmt.Println(err)
+		return false
 	}
-
-	if gjson.Get(resp, "code").Int() != 200000 {
-		msg := gjson.Get(resp, "msg").String()
-		if msg == "" {
-			msg = "请求失败"
-		}
-		fmt.Println(msg)
-		return
+	selected, err := l.selectParts(parts)
+	if err != nil {
+		fmt.Println(err)
+		return true
 	}
 
-	bestURL := ""
-	bestHeight := int64(0)
-	for _, item := range gjson.Get(resp, "data.playbackUrls.0.list").Array() {
-		fileURL := item.Get("fileUrl").String()
-		if fileURL == "" {
+	for _, i := range selected {
+		rendition, ok := parts[i].pick(l.MaxHeight)
+		if !ok {
+			fmt.Printf("第 %d 段回放没有可下载的播放地址。\n", i+1)
 			continue
 		}
-		height := item.Get("height").Int()
-		if height > bestHeight {
-			bestHeight = height
-			bestURL = fileURL
+		partPart := ""
+		if len(parts) > 1 {
+			partPart = fmt.Sprintf("_part%d", i+1)
+			fmt.Printf("回放片段（%d/%d）：%s\n", i+1, len(parts), parts[i].displayName(i))
+		}
+		outputPath := filepath.Join(l.SaveDir, l.apiCoreReplayFileName(partPart, rendition.height))
+		if _, err := os.Stat(outputPath); err == nil {
+			fmt.Println(color.Done("该回放视频已下载，自动跳过下载："), outputPath)
+			continue
 		}
-	}
-	if bestURL == "" {
-		fmt.Println("未获取到可下载的回放播放地址（可能需要登录/权限）。")
-		return
-	}
 
-	titlePart := sanitizeFilePart(l.title)
-	if titlePart != "" {
-		titlePart += "_"
+		fmt.Printf("清晰度：%sp\n", strconv.FormatInt(rendition.height, 10))
+		// 先下载至临时文件，完成后再重命名，中断后再次运行时不会把不完整的文件当作已下载
+		tmpPath := strings.TrimSuffix(outputPath, ".mp4") + ".tmp.mp4"
+		if err := downloadHLSClipWithFFmpeg(rendition.url, tmpPath, l.From, l.To); err != nil {
+			fmt.Println("ffmpeg 下载失败：", err)
+			continue
+		}
+		if err := os.Rename(tmpPath, outputPath); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Println("快速回放视频下载完成：", outputPath)
 	}
-	outputName := fmt.Sprintf("%sreplay_room%s_vid%s_%sp_%s.mp4",
-		titlePart,
-		l.RoomID,
-		l.VideoID,
-		strconv.FormatInt(bestHeight, 10),
-		time.Now().Format("2006-01-02_15-04-05"),
-	)
-	outputPath := filepath.Join(l.SaveDir, outputName)
+	return true
+}
 
-	fmt.Printf("清晰度：%sp\n", strconv.FormatInt(bestHeight, 10))
-	if err := downloadHLSWithFFmpeg(bestURL, outputPath); err != nil {
-		fmt.Println("ffmpeg 下载失败：", err)
-		return
+// apiCoreReplayFileName 返回通过新版回放接口下载的回放视频的文件名。与replayFileName一样由直播标题和场次组成，重复运行时不变。
+func (l *Live) apiCoreReplayFileName(partPart string, height int64) string {
+	name := l.fileBaseName() + "_快速回放" + partPart + "_" + strconv.FormatInt(height, 10) + "p"
+	if l.From > 0 || l.To > 0 {
+		name += timecode.FileSuffix(l.From, l.To)
 	}
-	fmt.Println("快速回放视频下载完成：", outputPath)
+	return name + ".mp4"
 }
 
 func downloadHLSWithFFmpeg(m3u8URL string, outputPath string) error {
+	return downloadHLSClipWithFFmpeg(m3u8URL, outputPath, 0, 0)
+}
+
+// downloadHLSClipWithFFmpeg 使用ffmpeg下载HLS视频中[from, to)范围内的内容，from和to均为0时下载完整视频。
+// 开始时间作为输入参数传给ffmpeg，因此ffmpeg只会请求与该范围重叠的片段。
+func downloadHLSClipWithFFmpeg(m3u8URL string, outputPath string, from, to time.Duration) error {
 	if _, err := exec.LookPath("ffmpeg"); err != nil {
 		return fmt.Errorf("未找到 ffmpeg，请先安装 ffmpeg 或将其加入 PATH")
 	}
@@ -142,6 +157,19 @@ func downloadHLSWithFFmpeg(m3u8URL string, outputPath string) error {
 	if totalDurationSec > 0 {
 		fmt.Printf("总时长：%s\n", formatDurationSeconds(totalDurationSec))
 	}
+	if from > 0 || to > 0 {
+		if totalDurationSec > 0 && from.Seconds() >= totalDurationSec {
+			return fmt.Errorf("指定的开始时间（%s）超出了回放的时长", timecode.Format(from))
+		}
+		end := totalDurationSec
+		if to > 0 && (end <= 0 || to.Seconds() < end) {
+			end = to.Seconds()
+		}
+		if end > 0 {
+			totalDurationSec = end - from.Seconds()
+		}
+		fmt.Printf("截取范围：%s-%s\n", timecode.Format(from), formatClipEnd(to))
+	}
 	fmt.Println("开始下载（显示总进度与速度）...")
 
 	args := []string{
@@ -154,7 +182,14 @@ func downloadHLSWithFFmpeg(m3u8URL string, outputPath string) error {
 	if useHeaders {
 		args = append(args, "-headers", headers)
 	}
-	args = append(args, "-i", m3u8URL, "-c", "copy", outputPath)
+	if from > 0 {
+		args = append(args, "-ss", strconv.FormatFloat(from.Seconds(), 'f', 3, 64))
+	}
+	args = append(args, "-i", m3u8URL)
+	if to > 0 {
+		args = append(args, "-t", strconv.FormatFloat((to-from).Seconds(), 'f', 3, 64))
+	}
+	args = append(args, "-c", "copy", outputPath)
 	cmd := exec.Command("ffmpeg", args...)
 
 	stdout, err := cmd.StdoutPipe()
@@ -354,24 +389,6 @@ func probeDurationSecondsFromM3U8(m3u8URL string) float64 {
 	return 0
 }
 
-func sanitizeFilePart(s string) string {
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return ""
-	}
-	reg, _ := regexp.Compile(`[\\/:*?"<>|]`)
-	s = reg.ReplaceAllString(s, "")
-	s = strings.TrimSpace(s)
-	if s == "" {
-		return ""
-	}
-	// avoid insanely long filenames
-	if len([]rune(s)) > 80 {
-		s = string([]rune(s)[:80])
-	}
-	return s
-}
-
 func (l *Live) tryPopulateLiveMetaFromAPICore() {
 	if strings.TrimSpace(l.RoomID) == "" {
 		return
@@ -384,72 +401,46 @@ func (l *Live) tryPopulateLiveMetaFromAPICore() {
 	if gjson.Get(resp, "code").Int() != 200000 {
 		return
 	}
-	l.title = firstNonEmpty(
+	// 接口缺少某个字段时保留之前获取到的值，以免已确定的文件名在重复调用后改变
+	if title := firstNonEmpty(
 		gjson.Get(resp, "data.title").String(),
 		gjson.Get(resp, "data.ltitle").String(),
 		gjson.Get(resp, "data.liveTitle").String(),
 		gjson.Get(resp, "data.name").String(),
-	)
-	l.date = firstNonEmpty(
+	); title != "" {
+		l.title = title
+	}
+	if date := firstNonEmpty(
 		gjson.Get(resp, "data.livedate").String(),
 		gjson.Get(resp, "data.liveDate").String(),
 		gjson.Get(resp, "data.date").String(),
-	)
+	); date != "" {
+		l.date = date
+	}
+	if l.VideoID == "" {
+		l.VideoID = findVideoID(resp)
+	}
 }
 
-func firstNonEmpty(values ...string) string {
-	for _, v := range values {
-		if strings.TrimSpace(v) != "" {
-			return v
-		}
+// findVideoID 从新版直播详情接口的响应中获取回放对应的 videoId，即回放页面地址中 ?vid= 的值
+func findVideoID(resp string) string {
+	if v := strings.TrimSpace(gjson.Get(resp, "data.videoId").String()); v != "0" {
+		return v
 	}
 	return ""
 }
 
-// recordVOD 根据点播模式的m3u8文件下载快速回放视频
-func (l *Live) recordVOD() {
-	fmt.Println("开始下载快速回放视频...")
-	str, err := user.MyGetRequest(l.quickReplayURL)
-	if err != nil {
-		fmt.Println("Get请求出错：", err)
-		return
-	}
-
-	if !strings.Contains(str, "#EXTM3U") {
-		if m3u8URL := findFirstM3U8URL(str); m3u8URL != "" {
-			l.quickReplayURL = m3u8URL
-			str, err = user.MyGetRequest(l.quickReplayURL)
-			if err != nil {
-				fmt.Println("Get请求出错：", err)
-				return
-			}
-		}
-	}
-
-	lines := strings.Split(str, "\n")
-	for _, line := range lines {
-		if strings.HasPrefix(line, "#") { //忽略m3u8文件中的注释行
-			continue
-		}
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		if strings.Contains(line, ".m3u8") {
-			if resolved, ok := resolveURL(l.quickReplayURL, line); ok {
-				l.quickReplayURL = resolved
-				l.recordVOD()
-				return
-			}
-		}
+// resolveVideoID 通过新版直播详情接口自动获取回放对应的 videoId，获取成功时返回true
+func (l *Live) resolveVideoID() bool {
+	l.tryPopulateLiveMetaFromAPICore()
+	return l.VideoID != ""
+}
 
-		fmt.Println(strings.Split(line, "&")[0], "...")
-		if resolved, ok := resolveURL(l.quickReplayURL, line); ok {
-			l.newTsURL = resolved
-		} else {
-			l.newTsURL = l.quickReplayURL[:strings.LastIndex(l.quickReplayURL, "/")+1] + line
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
 		}
-		l.downloadAndMergeTsFile()
 	}
-	fmt.Println("快速回放视频下载完成。")
+	return ""
 }
@@ -0,0 +1,51 @@
+package live
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+// liveDetail 为新版直播详情接口 /live/v2/live/<roomID> 的响应示例
+const liveDetail = `{"code":200000,"msg":"success","data":{"roomId":49392,"title":"第二届全国生物物理大会","livedate":"2023-07-15 08:30:00","videoId":197212}}`
+
+func TestTryPopulateLiveMetaFromAPICore(t *testing.T) {
+	body := liveDetail
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/live/v2/live/49392" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	config.SetConfigDir(t.TempDir()) //不读取本机的登录凭证
+	config.SetAPIBaseURL(srv.URL)
+
+	l := &Live{RoomID: "49392"}
+	if !l.resolveVideoID() || l.VideoID != "197212" {
+		t.Fatalf("VideoID = %q, want 197212", l.VideoID)
+	}
+	if l.title != "第二届全国生物物理大会" || l.date != "2023-07-15 08:30:00" {
+		t.Errorf("title = %q, date = %q", l.title, l.date)
+	}
+
+	// 之后的响应缺少标题和开播时间时，保留之前获取到的值
+	body = `{"code":200000,"data":{"roomId":49392}}`
+	name := l.fileBaseName()
+	l.tryPopulateLiveMetaFromAPICore()
+	if got := l.fileBaseName(); got != name {
+		t.Errorf("fileBaseName() changed from %q to %q", name, got)
+	}
+
+	// 接口未给出 videoId（或为0）时无法自动获取
+	for _, resp := range []string{body, `{"code":200000,"data":{"videoId":0}}`} {
+		body = resp
+		l = &Live{RoomID: "49392"}
+		if l.resolveVideoID() {
+			t.Errorf("resolveVideoID() = true for %s", resp)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package live
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Windows等系统上可能没有时区数据库，内置一份以支持 --tz 参数
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+)
+
+// liveStartGrace 为超过开播时间多久仍未开播则放弃录制
+const liveStartGrace = 30 * time.Minute
+
+// liveStartPollInterval 为等待开播时查询直播状态的间隔
+var liveStartPollInterval = 10 * time.Second
+
+// location 返回解析开播时间时使用的时区
+func (l *Live) location() (*time.Location, error) {
+	if l.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(l.TimeZone)
+}
+
+// parseStartTime 解析开播时间，支持以下格式：
+//
+//	2006-01-02 15:04:05（可省略秒），按loc指定的时区解析
+//	RFC3339，如 2023-07-15T18:30:00+08:00
+//	相对于now的时间，如 +2h30m
+func parseStartTime(s string, loc *time.Location, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "+") {
+		d, err := time.ParseDuration(s[1:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		// 去掉单调时钟读数，使等待时始终以墙上时间为准
+		return now.Add(d).Round(0), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(`无法识别的时间格式 %q，应为"2006-01-02 15:04:05"、RFC3339或"+2h30m"`, s)
+}
+
+// startAfter 返回预计的开播时间：服务器记录的开播时间date与 --at 指定的时间at中较晚的一个。
+// 直播推迟开始时服务器记录的时间可能早于实际开播时间，此时以 --at 为准。
+func startAfter(date string, at time.Time) (time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02 15:04:05", date, serverLocation)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if at.After(start) {
+		return at, nil
+	}
+	return start, nil
+}
+
+// waitUntil 倒计时至t。每秒按墙上时间重新计算剩余时间，因此系统休眠后唤醒也能按时结束等待。
+func waitUntil(t time.Time) {
+	t = t.Round(0)
+	if !time.Now().Before(t) {
+		return
+	}
+	for {
+		remaining := time.Until(t)
+		if remaining <= 0 {
+			break
+		}
+		fmt.Printf("\r %s...", formatCountdown(remaining))
+		if remaining > time.Second {
+			remaining = time.Second
+		}
+		time.Sleep(remaining)
+	}
+	fmt.Println("\n直播时间到。")
+}
+
+// waitForLiveStart 轮询直播状态直至开播，开播后刷新直播地址。直播已结束或超过开播时间太久仍未开播时返回false。
+func (l *Live) waitForLiveStart(start time.Time) bool {
+	for {
+		l.checkLiveStatus()
+		switch l.isLive {
+		case "1":
+			l.getLiveByRoomID(l.Quality != "standard")
+			return l.isLive == "1"
+		case "2", "3":
+			fmt.Println("直播已结束。")
+			return false
+		}
+		if time.Now().After(start.Add(liveStartGrace)) {
+			fmt.Println(color.Highlight("直播未按时开始，停止等待。"))
+			return false
+		}
+		fmt.Printf("\r 等待开播，将于 %s 重新检查...", time.Now().Add(liveStartPollInterval).Format("15:04:05"))
+		time.Sleep(liveStartPollInterval)
+	}
+}
+
+func formatCountdown(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * (24 * time.Hour)
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+
+	return fmt.Sprintf("距开播：%02d天%02d时%02d分%02d秒", days, hours, minutes, seconds)
+}
@@ -0,0 +1,95 @@
+package live
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+func TestParseStartTime(t *testing.T) {
+	shanghai, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2023, 7, 15, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2023-07-15 18:30:00", time.Date(2023, 7, 15, 10, 30, 0, 0, time.UTC)},
+		{"2023-07-15 18:30", time.Date(2023, 7, 15, 10, 30, 0, 0, time.UTC)},
+		{"2023-07-15T18:30:00+02:00", time.Date(2023, 7, 15, 16, 30, 0, 0, time.UTC)},
+		{"+2h30m", time.Date(2023, 7, 15, 10, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseStartTime(tt.in, shanghai, now)
+		if err != nil {
+			t.Fatalf("parseStartTime(%q): %v", tt.in, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("parseStartTime(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+
+	if _, err := parseStartTime("tomorrow", shanghai, now); err == nil {
+		t.Error("expected error for unsupported format")
+	}
+}
+
+func TestFormatCountdown(t *testing.T) {
+	got := formatCountdown(26*time.Hour + 3*time.Minute + 4*time.Second)
+	if want := "距开播：01天02时03分04秒"; got != want {
+		t.Errorf("formatCountdown = %q, want %q", got, want)
+	}
+}
+
+func TestWaitForDelayedLive(t *testing.T) {
+	// 服务器记录的开播时间已过去一小时，但 --at 指定的时间刚到，直播推迟开始
+	serverDate := time.Now().Add(-time.Hour).In(serverLocation).Format("2006-01-02 15:04:05")
+	at := time.Now().Round(0)
+	start, err := startAfter(serverDate, at)
+	if err != nil || !start.Equal(at) {
+		t.Fatalf("startAfter() = %v, %v; want %v", start, err, at)
+	}
+	if start, _ = startAfter(serverDate, time.Time{}); start.After(at) {
+		t.Errorf("startAfter() without --at = %v", start)
+	}
+
+	var checks int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/api-live/checkLiveStatus":
+			checks++
+			if checks < 3 {
+				_, _ = w.Write([]byte(`{"code":200,"data":{"islive":"0","lopen":"0"}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":200,"data":{"islive":"1","lopen":"0"}}`))
+		case "/api/api-live/getLiveByRoomid":
+			_, _ = w.Write([]byte(`{"code":200,"data":{"islive":"1","hlsurl":"https://example.com/live.m3u8"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	config.SetConfigDir(t.TempDir())
+	config.SetAPIBaseURL(srv.URL)
+	interval := liveStartPollInterval
+	liveStartPollInterval = 10 * time.Millisecond
+	defer func() { liveStartPollInterval = interval }()
+
+	l := &Live{RoomID: "1", lid: "1"}
+	if !l.waitForLiveStart(at) || checks != 3 {
+		t.Errorf("waitForLiveStart() gave up after %d checks", checks)
+	}
+	l = &Live{RoomID: "1", lid: "1"}
+	checks = 0
+	serverStart, _ := startAfter(serverDate, time.Time{})
+	if l.waitForLiveStart(serverStart) || checks != 1 {
+		t.Errorf("waitForLiveStart() with the server date: %d checks", checks)
+	}
+}
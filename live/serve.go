@@ -0,0 +1,115 @@
+package live
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+)
+
+// serveRecording 在addr上以EVENT类型的m3u8播放列表提供已录制的片段，供局域网内的播放器边录边看。
+// 返回的服务器由调用者在录制结束后关闭；启动失败时返回nil。
+func (l *Live) serveRecording(addr string) *http.Server {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Println(color.Error("启动本地回看服务失败："), err)
+		return nil
+	}
+
+	srv := &http.Server{Handler: l.recordingHandler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println(color.Error("本地回看服务异常退出："), err)
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "localhost"
+	}
+	fmt.Printf("本地回看服务已启动，使用任意HLS播放器打开 %s 即可从头观看已录制的内容。\n",
+		color.Emphasize("http://"+net.JoinHostPort(host, port)+"/index.m3u8"))
+	return srv
+}
+
+// stopServing 关闭本地回看服务。片段按下标提供，回填或补录改变片段列表后下标会错位，因此须在修改片段之前关闭。
+func (l *Live) stopServing() {
+	if l.server == nil {
+		return
+	}
+	_ = l.server.Close()
+	l.server = nil
+	fmt.Println("本地回看服务已关闭。")
+}
+
+// recordingHandler 返回提供播放列表index.m3u8和片段segments/<i>.ts的Handler
+func (l *Live) recordingHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.m3u8", l.servePlaylist)
+	mux.HandleFunc("/segments/", l.serveSegment)
+	return mux
+}
+
+func (l *Live) servePlaylist(w http.ResponseWriter, r *http.Request) {
+	segments, ended := l.rec.snapshot()
+
+	targetDuration := 1.0
+	for _, s := range segments {
+		targetDuration = math.Max(targetDuration, s.duration)
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:EVENT\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(math.Ceil(targetDuration)))
+	gaps := make(map[int]bool)
+	for _, g := range l.rec.gaps() {
+		gaps[g.after+1] = true
+	}
+	for i, s := range segments {
+		if gaps[i] { //缺口前后的片段在时间戳上不连续
+			b.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+		duration := s.duration
+		if duration <= 0 {
+			duration = targetDuration
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\nsegments/%d.ts\n", duration, i)
+	}
+	if ended {
+		b.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_, _ = io.WriteString(w, b.String())
+}
+
+func (l *Live) serveSegment(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/segments/"), ".ts")
+	i, err := strconv.Atoi(name)
+	segments, _ := l.rec.snapshot()
+	if err != nil || i < 0 || i >= len(segments) {
+		http.NotFound(w, r)
+		return
+	}
+	s := segments[i]
+
+	f, err := os.Open(s.file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "video/mp2t")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	http.ServeContent(w, r, name+".ts", s.start, io.NewSectionReader(f, s.offset, s.size))
+}
@@ -0,0 +1,145 @@
+package live
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, URL string, header ...string) (*http.Response, string) {
+	req, err := http.NewRequest(http.MethodGet, URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(data)
+}
+
+func TestServePlaylist(t *testing.T) {
+	l := &Live{rec: &recording{}}
+	srv := httptest.NewServer(l.recordingHandler())
+	defer srv.Close()
+
+	resp, body := get(t, srv.URL+"/index.m3u8")
+	if ct := resp.Header.Get("Content-Type"); ct != "application/vnd.apple.mpegurl" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if !strings.Contains(body, "#EXT-X-PLAYLIST-TYPE:EVENT\n") || strings.Contains(body, "#EXTINF") || strings.Contains(body, "#EXT-X-ENDLIST") {
+		t.Errorf("empty playlist:\n%s", body)
+	}
+
+	// 录制过程中播放列表随片段增加而增长，缺口后的片段前有#EXT-X-DISCONTINUITY
+	l.rec.add(seg(0, 10))
+	l.rec.add(seg(1, 11))
+	_, body = get(t, srv.URL+"/index.m3u8")
+	if strings.Count(body, "#EXTINF") != 2 || strings.Contains(body, "#EXT-X-DISCONTINUITY") || strings.Contains(body, "#EXT-X-ENDLIST") {
+		t.Errorf("playlist while recording:\n%s", body)
+	}
+	long := seg(4, 14)
+	long.duration = 5.5
+	l.rec.add(long)
+	_, body = get(t, srv.URL+"/index.m3u8")
+	want := "#EXT-X-TARGETDURATION:6\n#EXT-X-MEDIA-SEQUENCE:0\n" +
+		"#EXTINF:2.000,\nsegments/0.ts\n" +
+		"#EXTINF:2.000,\nsegments/1.ts\n" +
+		"#EXT-X-DISCONTINUITY\n#EXTINF:5.500,\nsegments/2.ts\n"
+	if !strings.HasSuffix(body, want) {
+		t.Errorf("playlist after a gap:\n%s\nwant suffix:\n%s", body, want)
+	}
+
+	// 录制结束后添加#EXT-X-ENDLIST
+	l.rec.finish()
+	if _, body = get(t, srv.URL+"/index.m3u8"); !strings.HasSuffix(body, "segments/2.ts\n#EXT-X-ENDLIST\n") {
+		t.Errorf("playlist after the recording ended:\n%s", body)
+	}
+}
+
+func TestServeSegment(t *testing.T) {
+	// 自动合并时多个片段保存在同一文件中，各片段只提供自己的部分
+	file := filepath.Join(t.TempDir(), "merged.ts")
+	if err := os.WriteFile(file, []byte("0123456789"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	l := &Live{rec: &recording{}}
+	first, second := seg(0, 10), seg(1, 11)
+	first.file, first.offset, first.size = file, 0, 4
+	second.file, second.offset, second.size = file, 4, 6
+	l.rec.add(first)
+	l.rec.add(second)
+	srv := httptest.NewServer(l.recordingHandler())
+	defer srv.Close()
+
+	tests := []struct {
+		path, rangeHeader string
+		status            int
+		body              string
+		contentRange      string
+	}{
+		{"/segments/0.ts", "", http.StatusOK, "0123", ""},
+		{"/segments/1.ts", "", http.StatusOK, "456789", ""},
+		{"/segments/1.ts", "bytes=2-", http.StatusPartialContent, "6789", "bytes 2-5/6"},
+		{"/segments/1.ts", "bytes=0-1", http.StatusPartialContent, "45", "bytes 0-1/6"},
+		{"/segments/1.ts", "bytes=-3", http.StatusPartialContent, "789", "bytes 3-5/6"},
+		{"/segments/1.ts", "bytes=6-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */6"},
+		{"/segments/2.ts", "", http.StatusNotFound, "", ""},
+		{"/segments/x.ts", "", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		resp, body := get(t, srv.URL+tt.path, "Range", tt.rangeHeader)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s %s: status %d, want %d", tt.path, tt.rangeHeader, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status/100 == 2 && body != tt.body {
+			t.Errorf("%s %s: body %q, want %q", tt.path, tt.rangeHeader, body, tt.body)
+		}
+		if cr := resp.Header.Get("Content-Range"); cr != tt.contentRange {
+			t.Errorf("%s %s: Content-Range %q, want %q", tt.path, tt.rangeHeader, cr, tt.contentRange)
+		}
+		if tt.status/100 == 2 && resp.Header.Get("Content-Type") != "video/mp2t" {
+			t.Errorf("%s: Content-Type %q", tt.path, resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestStopServing(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	l := &Live{rec: &recording{}}
+	if l.server = l.serveRecording(addr); l.server == nil {
+		t.Fatal("serveRecording() failed")
+	}
+	URL := "http://" + addr + "/index.m3u8"
+	if resp, _ := get(t, URL); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %s", URL, resp.Status)
+	}
+
+	// 回填或补录之前关闭服务，播放器不会读到下标错位的片段
+	l.stopServing()
+	if resp, err := http.Get(URL); err == nil {
+		_ = resp.Body.Close()
+		t.Error("the server is still running after stopServing()")
+	}
+	l.stopServing() //重复关闭时不做任何事
+}
@@ -0,0 +1,324 @@
+package live
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+	"github.com/yliu7949/KouShare-dl/internal/timecode"
+)
+
+// defaultJobs 为未指定 --jobs 参数时并发下载片段的数量
+const defaultJobs = 4
+
+// replayManifest 记录快速回放的下载进度，保存在输出文件旁的清单文件中，用于中断后继续下载
+type replayManifest struct {
+	RoomID    string        `json:"roomId"`
+	Part      int           `json:"part"`      // --part 指定的回放序号
+	Rendition string        `json:"rendition"` // 媒体播放列表的地址（不含查询参数），不同清晰度的地址不同
+	From      time.Duration `json:"from"`      // --from 指定的截取范围
+	To        time.Duration `json:"to"`
+	URIsHash  string        `json:"urisHash"` // 需要下载的片段地址（不含查询参数）的SHA-256
+	Segments  int           `json:"segments"` // 需要下载的片段数
+	Duration  float64       `json:"duration"` // 需要下载的片段的总时长（秒）
+	Done      []int         `json:"done"`     // 已下载完成的片段序号
+}
+
+// newReplayManifest 返回尚未下载任何片段的清单。地址中的查询参数多为会变化的鉴权信息，因此不参与比较。
+func (l *Live) newReplayManifest(playlistURL string, segments []hlsSegment) replayManifest {
+	h := sha256.New()
+	for _, s := range segments {
+		h.Write([]byte(stripQuery(s.uri) + "\n"))
+	}
+	return replayManifest{
+		RoomID:    l.RoomID,
+		Part:      l.Part,
+		Rendition: stripQuery(playlistURL),
+		From:      l.From,
+		To:        l.To,
+		URIsHash:  hex.EncodeToString(h.Sum(nil)),
+		Segments:  len(segments),
+		Duration:  segmentsDuration(segments),
+	}
+}
+
+// sameReplay 判断两个清单是否对应同一回放的同一范围，只有相同时才能继续使用之前下载的片段
+func (m replayManifest) sameReplay(o replayManifest) bool {
+	return m.RoomID == o.RoomID && m.Part == o.Part && m.Rendition == o.Rendition &&
+		m.From == o.From && m.To == o.To && m.URIsHash == o.URIsHash && m.Segments == o.Segments
+}
+
+func stripQuery(u string) string {
+	if i := strings.IndexAny(u, "?#"); i >= 0 {
+		return u[:i]
+	}
+	return u
+}
+
+func loadReplayManifest(fileName string) (replayManifest, bool) {
+	var m replayManifest
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return m, false
+	}
+	if err = json.Unmarshal(data, &m); err != nil {
+		return m, false
+	}
+	return m, true
+}
+
+func (m *replayManifest) save(fileName string) error {
+	sort.Ints(m.Done)
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpName := fileName + ".tmp"
+	if err = os.WriteFile(tmpName, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// replayFileName 返回快速回放视频的文件名。文件名由直播标题和场次组成，与录制文件保持一致，重复运行时不变。
+func (l *Live) replayFileName() string {
+	name := l.fileBaseName() + "_快速回放"
+	if l.From > 0 || l.To > 0 {
+		name += timecode.FileSuffix(l.From, l.To)
+	}
+	return name + ".ts"
+}
+
+// clipSegments 根据#EXTINF给出的片段时长，返回与[l.From, l.To)有重叠的片段，以及这些片段实际覆盖的时间范围
+func (l *Live) clipSegments(segments []hlsSegment) (selected []hlsSegment, from, to time.Duration) {
+	for _, s := range segments {
+		start := time.Duration(s.offset * float64(time.Second))
+		end := time.Duration((s.offset + s.duration) * float64(time.Second))
+		if end <= l.From || (l.To > 0 && start >= l.To) {
+			continue
+		}
+		if len(selected) == 0 {
+			from = start
+		}
+		selected = append(selected, s)
+		to = end
+	}
+	return selected, from, to
+}
+
+// recordVOD 根据点播模式的m3u8文件下载快速回放视频。片段并发下载至临时文件夹，下载进度记录在清单文件中，
+// 中断后再次运行会从中断处继续下载；全部片段下载完成后按顺序合并为一个.ts文件。
+func (l *Live) recordVOD() {
+	fmt.Println("开始下载快速回放视频...")
+	playlistURL, p, err := fetchMediaPlaylist(l.quickReplayURL)
+	if err != nil {
+		fmt.Println("获取快速回放播放列表失败：", err)
+		return
+	}
+	if len(p.segments) == 0 {
+		fmt.Println("快速回放播放列表中没有视频片段。")
+		return
+	}
+	segments := p.segments
+	if l.From > 0 || l.To > 0 {
+		var from, to time.Duration
+		if segments, from, to = l.clipSegments(p.segments); len(segments) == 0 {
+			fmt.Printf("指定的开始时间（%s）超出了快速回放的时长（%s）。\n", timecode.Format(l.From), timecode.Format(time.Duration(p.totalDuration()*float64(time.Second))))
+			return
+		}
+		fmt.Printf("仅下载 %s-%s 范围内的 %d 个片段（实际范围为 %s-%s）。\n", timecode.Format(l.From), formatClipEnd(l.To),
+			len(segments), timecode.Format(from), timecode.Format(to))
+	}
+	urls := make([]string, len(segments))
+	for i, s := range segments {
+		u, ok := resolveURL(playlistURL, s.uri)
+		if !ok {
+			fmt.Println("无效的片段地址：", s.uri)
+			return
+		}
+		urls[i] = u
+	}
+
+	if l.SaveDir != "" {
+		if err := os.MkdirAll(l.SaveDir, os.ModePerm); err != nil {
+			fmt.Println("创建下载文件夹失败：", err)
+			return
+		}
+	}
+	outputPath := l.SaveDir + l.replayFileName()
+	partsDir := outputPath + ".parts"
+	manifestPath := outputPath + ".manifest.json"
+
+	m, resumed := loadReplayManifest(manifestPath)
+	if !resumed {
+		if _, err := os.Stat(outputPath); err == nil {
+			fmt.Println(color.Done("该快速回放视频已下载，自动跳过下载："), outputPath)
+			return
+		}
+	}
+	want := l.newReplayManifest(playlistURL, segments)
+	if resumed && !m.sameReplay(want) {
+		// 回放内容、清晰度或截取范围已变化（例如快速回放被重新生成），之前下载的片段不再可用
+		fmt.Println("快速回放内容已变化，重新开始下载。")
+		_ = os.RemoveAll(partsDir)
+		resumed = false
+	}
+	if !resumed {
+		m = want
+	}
+	if err := os.MkdirAll(partsDir, os.ModePerm); err != nil {
+		fmt.Println("创建临时文件夹失败：", err)
+		return
+	}
+
+	done := make(map[int]bool, len(m.Done))
+	for _, i := range m.Done {
+		if _, err := os.Stat(partFileName(partsDir, i)); err == nil {
+			done[i] = true
+		}
+	}
+	m.Done = m.Done[:0]
+	for i := range done {
+		m.Done = append(m.Done, i)
+	}
+	if len(done) != 0 {
+		fmt.Printf("继续上次的下载，已完成 %d/%d 个片段。\n", len(done), len(urls))
+	}
+	if err := m.save(manifestPath); err != nil {
+		fmt.Println("保存下载清单失败：", err)
+		return
+	}
+
+	failed := l.downloadParts(urls, done, partsDir, &m, manifestPath)
+	if failed != 0 {
+		fmt.Println(color.Error(fmt.Sprintf("有 %d 个片段下载失败，再次运行该命令可继续下载。", failed)))
+		return
+	}
+
+	if err := concatParts(partsDir, len(urls), outputPath); err != nil {
+		fmt.Println("合并视频片段失败：", err)
+		return
+	}
+	_ = os.RemoveAll(partsDir)
+	_ = os.Remove(manifestPath)
+	fmt.Println("快速回放视频下载完成：", outputPath)
+}
+
+func partFileName(partsDir string, i int) string {
+	return filepath.Join(partsDir, fmt.Sprintf("%05d.ts", i))
+}
+
+// downloadParts 并发下载尚未完成的片段，每完成一个片段就更新清单文件，返回下载失败的片段数
+func (l *Live) downloadParts(urls []string, done map[int]bool, partsDir string, m *replayManifest, manifestPath string) int {
+	jobs := l.Jobs
+	if jobs <= 0 {
+		jobs = defaultJobs
+	}
+
+	pending := make(chan int)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	completed, failed := len(done), 0
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range pending {
+				err := downloadPart(urls[i], partFileName(partsDir, i))
+
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Printf("\n片段 %d 下载失败：%v\n", i+1, err)
+				} else {
+					completed++
+					m.Done = append(m.Done, i)
+					if err = m.save(manifestPath); err != nil {
+						fmt.Println("\n保存下载清单失败：", err)
+					}
+				}
+				fmt.Printf("\r 已下载 %d/%d 个片段...", completed, len(urls))
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range urls {
+		if !done[i] {
+			pending <- i
+		}
+	}
+	close(pending)
+	wg.Wait()
+	fmt.Println()
+	return failed
+}
+
+func downloadPart(URL string, fileName string) error {
+	tmpName := fileName + ".tmp"
+	f, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = fetchSegment(f, URL)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// concatParts 将临时文件夹中的片段按顺序合并为outputPath
+func concatParts(partsDir string, n int, outputPath string) error {
+	tmpName := outputPath + ".tmp"
+	dst, err := os.OpenFile(tmpName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < n && err == nil; i++ {
+		var src *os.File
+		if src, err = os.Open(partFileName(partsDir, i)); err != nil {
+			break
+		}
+		_, err = io.Copy(dst, src)
+		_ = src.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if _, statErr := os.Stat(outputPath); statErr == nil {
+		return errors.New("目标文件已存在：" + outputPath)
+	}
+	return os.Rename(tmpName, outputPath)
+}
+
+func segmentsDuration(segments []hlsSegment) (d float64) {
+	for _, s := range segments {
+		d += s.duration
+	}
+	return d
+}
+
+// formatClipEnd 格式化截取的结束时间，为0时表示至结尾
+func formatClipEnd(to time.Duration) string {
+	if to <= 0 {
+		return "结尾"
+	}
+	return timecode.Format(to)
+}
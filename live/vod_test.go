@@ -0,0 +1,280 @@
+package live
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+// vodServer 为点播模式的HLS测试服务器，片段seg<i>.ts的内容为"<i>;"，fail中的片段在第一次请求时返回500
+type vodServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests map[string]int
+	fail     map[string]bool
+}
+
+func newVODServer(t *testing.T, segments int, fail ...string) *vodServer {
+	s := &vodServer{requests: make(map[string]int), fail: make(map[string]bool)}
+	for _, name := range fail {
+		s.fail[name] = true
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		s.mu.Lock()
+		s.requests[name]++
+		failNow := s.fail[name] && s.requests[name] == 1
+		s.mu.Unlock()
+		if name == "index.m3u8" {
+			var b strings.Builder
+			b.WriteString("#EXTM3U\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-TARGETDURATION:10\n")
+			for i := 0; i < segments; i++ {
+				fmt.Fprintf(&b, "#EXTINF:10.000,\nseg%d.ts\n", i)
+			}
+			b.WriteString("#EXT-X-ENDLIST\n")
+			_, _ = w.Write([]byte(b.String()))
+			return
+		}
+		var i int
+		if _, err := fmt.Sscanf(name, "seg%d.ts", &i); err != nil || i >= segments {
+			http.NotFound(w, r)
+			return
+		}
+		if failNow {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprintf(w, "%d;", i)
+	}))
+	t.Cleanup(s.Close)
+	config.SetConfigDir(t.TempDir()) //不读取本机的登录凭证
+	return s
+}
+
+func (s *vodServer) count(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[name]
+}
+
+func TestRecordVODResume(t *testing.T) {
+	srv := newVODServer(t, 6, "seg2.ts", "seg4.ts")
+	dir := t.TempDir() + "/"
+	l := &Live{RoomID: "1", title: "测试/直播", date: "2023-07-15 08:30:00", SaveDir: dir, Jobs: 2, quickReplayURL: srv.URL + "/index.m3u8"}
+	outputPath := dir + "测试直播_2023-07-15 08_30_00_快速回放.ts"
+	if name := l.replayFileName(); dir+name != outputPath {
+		t.Fatalf("replayFileName() = %q", name)
+	}
+
+	// 第一次运行时有两个片段下载失败，清单中记录其余的片段
+	l.recordVOD()
+	if _, err := os.Stat(outputPath); err == nil {
+		t.Fatal("the output was written although two segments failed")
+	}
+	m, ok := loadReplayManifest(outputPath + ".manifest.json")
+	if !ok || m.RoomID != "1" || m.Segments != 6 || m.Duration != 60 || fmt.Sprint(m.Done) != "[0 1 3 5]" {
+		t.Fatalf("manifest after the first run = %+v, %v", m, ok)
+	}
+
+	// 第二次运行时只下载失败的片段
+	l.recordVOD()
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "0;1;2;3;4;5;" {
+		t.Errorf("output = %q", data)
+	}
+	for i := 0; i < 6; i++ {
+		name := fmt.Sprintf("seg%d.ts", i)
+		want := 1
+		if name == "seg2.ts" || name == "seg4.ts" {
+			want = 2
+		}
+		if got := srv.count(name); got != want {
+			t.Errorf("%s was requested %d times, want %d", name, got, want)
+		}
+	}
+	for _, name := range []string{outputPath + ".parts", outputPath + ".manifest.json"} {
+		if _, err = os.Stat(name); err == nil {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+
+	// 输出文件已存在时跳过下载
+	l.recordVOD()
+	if got := srv.count("seg0.ts"); got != 1 {
+		t.Errorf("seg0.ts was downloaded again after the replay was complete")
+	}
+}
+
+func TestRecordVODChangedManifest(t *testing.T) {
+	srv := newVODServer(t, 3)
+	dir := t.TempDir() + "/"
+	l := &Live{RoomID: "1", title: "直播", date: "2023-07-15 08:30:00", SaveDir: dir, quickReplayURL: srv.URL + "/index.m3u8"}
+	outputPath := dir + l.replayFileName()
+
+	// 清单中的片段数与播放列表不一致时，之前下载的片段作废
+	partsDir := outputPath + ".parts"
+	if err := os.MkdirAll(partsDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partFileName(partsDir, 0), []byte("stale;"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	m := replayManifest{RoomID: "1", Segments: 5, Done: []int{0}}
+	if err := m.save(outputPath + ".manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	l.recordVOD()
+	if data, err := os.ReadFile(outputPath); err != nil || string(data) != "0;1;2;" {
+		t.Errorf("output = %q, %v", data, err)
+	}
+
+	// 片段数相同，但片段地址（回放被重新生成）或清晰度不同时同样作废
+	var segments []hlsSegment
+	for i := 0; i < 3; i++ {
+		segments = append(segments, hlsSegment{uri: fmt.Sprintf("seg%d.ts?sign=%d", i, i)})
+	}
+	playlistURL := srv.URL + "/index.m3u8?token=1"
+	if current := l.newReplayManifest(playlistURL, segments); !current.sameReplay(l.newReplayManifest(srv.URL+"/index.m3u8", segments)) {
+		t.Error("a changed query string invalidated the manifest")
+	}
+	regenerated := append([]hlsSegment(nil), segments...)
+	regenerated[1].uri = "seg1_new.ts"
+	clipped := &Live{RoomID: "1", From: time.Second}
+	for name, m := range map[string]replayManifest{
+		"regenerated": l.newReplayManifest(playlistURL, regenerated),
+		"rendition":   l.newReplayManifest(srv.URL+"/720p/index.m3u8", segments),
+		"clip range":  clipped.newReplayManifest(playlistURL, segments),
+		"part":        (&Live{RoomID: "1", Part: 2}).newReplayManifest(playlistURL, segments),
+	} {
+		if m.sameReplay(l.newReplayManifest(playlistURL, segments)) {
+			t.Errorf("%s: the stale manifest was accepted", name)
+		}
+	}
+
+	_ = os.Remove(outputPath)
+	if err := os.MkdirAll(partsDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partFileName(partsDir, 1), []byte("stale;"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	stale := l.newReplayManifest(srv.URL+"/index.m3u8", regenerated)
+	stale.Done = []int{1}
+	if err := stale.save(outputPath + ".manifest.json"); err != nil {
+		t.Fatal(err)
+	}
+	l.recordVOD()
+	if data, err := os.ReadFile(outputPath); err != nil || string(data) != "0;1;2;" {
+		t.Errorf("output after the playlist was regenerated = %q, %v", data, err)
+	}
+}
+
+func TestClipSegments(t *testing.T) {
+	var segments []hlsSegment
+	for i := 0; i < 5; i++ {
+		segments = append(segments, hlsSegment{uri: fmt.Sprintf("seg%d.ts", i), duration: 10, offset: float64(i * 10)})
+	}
+	tests := []struct {
+		from, to time.Duration
+		want     string
+		start    time.Duration
+		end      time.Duration
+	}{
+		{0, 0, "seg0.ts seg1.ts seg2.ts seg3.ts seg4.ts", 0, 50 * time.Second},
+		{15 * time.Second, 0, "seg1.ts seg2.ts seg3.ts seg4.ts", 10 * time.Second, 50 * time.Second},
+		{10 * time.Second, 20 * time.Second, "seg1.ts", 10 * time.Second, 20 * time.Second},
+		{5 * time.Second, 25 * time.Second, "seg0.ts seg1.ts seg2.ts", 0, 30 * time.Second},
+		{0, 10 * time.Second, "seg0.ts", 0, 10 * time.Second},
+		{50 * time.Second, 0, "", 0, 0},
+	}
+	for _, tt := range tests {
+		l := &Live{From: tt.from, To: tt.to}
+		selected, start, end := l.clipSegments(segments)
+		var names []string
+		for _, s := range selected {
+			names = append(names, s.uri)
+		}
+		if got := strings.Join(names, " "); got != tt.want || start != tt.start || end != tt.end {
+			t.Errorf("clipSegments(%v, %v) = %q, %v, %v; want %q, %v, %v", tt.from, tt.to, got, start, end, tt.want, tt.start, tt.end)
+		}
+	}
+}
+
+func TestDownloadParts(t *testing.T) {
+	srv := newVODServer(t, 4, "seg1.ts")
+	partsDir := t.TempDir()
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	urls := make([]string, 4)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/seg%d.ts", srv.URL, i)
+	}
+	m := replayManifest{RoomID: "1", Segments: 4}
+
+	l := &Live{Jobs: 3}
+	if failed := l.downloadParts(urls, map[int]bool{3: true}, partsDir, &m, manifestPath); failed != 1 {
+		t.Errorf("failed = %d, want 1", failed)
+	}
+	if srv.count("seg3.ts") != 0 {
+		t.Error("a segment that was already done was downloaded again")
+	}
+	if saved, ok := loadReplayManifest(manifestPath); !ok || fmt.Sprint(saved.Done) != "[0 2]" {
+		t.Errorf("saved manifest = %+v, %v", saved, ok)
+	}
+	if _, err := os.Stat(partFileName(partsDir, 1)); err == nil {
+		t.Error("a failed segment left a part file")
+	}
+	if entries, _ := filepath.Glob(filepath.Join(partsDir, "*.tmp")); len(entries) != 0 {
+		t.Errorf("temporary files were left: %v", entries)
+	}
+}
+
+func TestConcatParts(t *testing.T) {
+	partsDir := t.TempDir()
+	for i, data := range []string{"a", "bc", "d"} {
+		if err := os.WriteFile(partFileName(partsDir, i), []byte(data), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	outputPath := filepath.Join(t.TempDir(), "replay.ts")
+
+	if err := concatParts(partsDir, 4, outputPath); err == nil {
+		t.Error("a missing part was accepted")
+	}
+	if _, err := os.Stat(outputPath + ".tmp"); err == nil {
+		t.Error("the temporary file was left after a failure")
+	}
+	if err := concatParts(partsDir, 3, outputPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(outputPath); string(data) != "abcd" {
+		t.Errorf("output = %q", data)
+	}
+	if err := concatParts(partsDir, 3, outputPath); err == nil {
+		t.Error("an existing output was overwritten")
+	}
+}
+
+func TestAPICoreReplayFileName(t *testing.T) {
+	l := &Live{RoomID: "49392", lid: "7", title: "报告会"}
+	if got := l.apiCoreReplayFileName("_part2", 720); got != "报告会_room49392_7_快速回放_part2_720p.mp4" {
+		t.Errorf("apiCoreReplayFileName() = %q", got)
+	}
+	l.date = "2023-07-15 08:30:00"
+	l.From = time.Hour
+	want := "报告会_2023-07-15 08_30_00_快速回放_1080p_clip_01-00-00_end.mp4"
+	if got := l.apiCoreReplayFileName("", 1080); got != want || l.apiCoreReplayFileName("", 1080) != got {
+		t.Errorf("apiCoreReplayFileName() = %q, want %q", got, want)
+	}
+}
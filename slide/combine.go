@@ -0,0 +1,214 @@
+package slide
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yliu7949/KouShare-dl/internal/pdf"
+)
+
+// savedSlide 为已下载的专题课件
+type savedSlide struct {
+	fileNames []string //保存的文件，解压压缩包时可能有多个
+	seriesSlide
+}
+
+// label 返回课件在书签和目录中显示的名字，由视频标题和讲者组成
+func (s savedSlide) label() string {
+	title := strings.TrimSpace(s.Title)
+	if title == "" {
+		title = strings.TrimSuffix(filepath.Base(s.fileNames[0]), filepath.Ext(s.fileNames[0]))
+	}
+	if speaker := strings.TrimSpace(s.Speaker); speaker != "" {
+		title += "（" + speaker + "）"
+	}
+	return title
+}
+
+// combineSlides 将已下载的专题课件按专题中的顺序合并为一个pdf文件，每个课件对应一个书签
+func (s *Slide) combineSlides(slides []savedSlide) {
+	m := pdf.NewMerger()
+	var entries []tocEntry
+	merged := make(map[string]int) //已合并的文件及其第一页，多个报告共用同一个课件时只合并一次
+	for _, slide := range slides {
+		first := -1 //该报告的第一页
+		for _, fileName := range slide.fileNames {
+			if page, ok := merged[fileName]; ok {
+				if first < 0 {
+					first = page
+				}
+				continue
+			}
+			if !isPDF(fileName) {
+				fmt.Printf("课件 %s 不是pdf文件，已跳过。\n", filepath.Base(fileName))
+				continue
+			}
+			doc, err := pdf.ReadFile(fileName)
+			if err == nil {
+				var page int
+				if page, err = m.Append(doc); err == nil {
+					merged[fileName] = page
+					if first < 0 {
+						first = page
+					}
+					continue
+				}
+			}
+			fmt.Printf("课件 %s 无法合并，已跳过：%v\n", filepath.Base(fileName), err)
+		}
+		if first >= 0 {
+			m.AddOutline(slide.label(), first)
+			entries = append(entries, tocEntry{label: slide.label(), page: m.PageRef(first), pageIndex: first})
+		}
+	}
+	if len(entries) == 0 {
+		fmt.Println("没有可以合并的pdf课件。")
+		return
+	}
+
+	title := s.seriesName
+	if s.svpName != "" {
+		title += "_" + s.svpName
+	}
+	if s.TOC {
+		addContentsPages(m, title, entries)
+	}
+	fileName := s.SaveDir + title + ".pdf"
+	if err := m.WriteFile(fileName); err != nil {
+		fmt.Println("合并课件失败：", err)
+		return
+	}
+	fmt.Printf("已将 %d 个课件合并为：%s\n", len(entries), fileName)
+}
+
+// tocEntry 为目录中的一项
+type tocEntry struct {
+	label     string
+	page      pdf.Ref // 课件第一页
+	pageIndex int     // 课件第一页的页码（从0开始，不含目录页）
+}
+
+// 目录页使用A4纸张，单位为point
+const (
+	tocPageWidth   = 595.28
+	tocPageHeight  = 841.89
+	tocMargin      = 56
+	tocTitleSize   = 18
+	tocFontSize    = 11
+	tocLineSpacing = 22
+	tocTitleSpace  = 60 // 第一页标题占用的高度
+)
+
+// addContentsPages 在合并结果的开头插入目录页：第一页顶部为专题名，其后每行为一个课件及其起始页码，点击可跳转至该课件
+func addContentsPages(m *pdf.Merger, title string, entries []tocEntry) {
+	linesPerPage := int(math.Floor((tocPageHeight - 2*tocMargin) / tocLineSpacing))
+	firstPageLines := linesPerPage - int(math.Ceil(float64(tocTitleSpace)/tocLineSpacing))
+	pageCount := 1
+	if len(entries) > firstPageLines {
+		pageCount += (len(entries) - firstPageLines + linesPerPage - 1) / linesPerPage
+	}
+
+	font := m.Add(cjkFont(m))
+	resources := pdf.Dict{"Font": pdf.Dict{"F1": font}}
+	for page, i := 0, 0; page < pageCount; page++ {
+		var ops []pdf.Operation
+		var annots pdf.Array
+		y := tocPageHeight - tocMargin
+		lines := linesPerPage
+		if page == 0 {
+			ops = append(ops, textOps(title, tocTitleSize, (tocPageWidth-textWidth(title, tocTitleSize))/2, y-tocTitleSize)...)
+			y -= tocTitleSpace
+			lines = firstPageLines
+		}
+		for ; lines > 0 && i < len(entries); lines, i = lines-1, i+1 {
+			y -= tocLineSpacing
+			number := strconv.Itoa(pageCount + entries[i].pageIndex + 1)
+			numberX := tocPageWidth - tocMargin - textWidth(number, tocFontSize)
+			label := truncateText(strconv.Itoa(i+1)+". "+entries[i].label, tocFontSize, numberX-tocMargin-2*tocFontSize)
+			ops = append(ops, textOps(label, tocFontSize, tocMargin, y)...)
+			ops = append(ops, textOps(number, tocFontSize, numberX, y)...)
+			annots = append(annots, pdf.Dict{
+				"Type":    pdf.Name("Annot"),
+				"Subtype": pdf.Name("Link"),
+				"Rect":    pdf.Array{float64(tocMargin), y - 4, tocPageWidth - tocMargin, y + tocFontSize + 4},
+				"Border":  pdf.Array{int64(0), int64(0), int64(0)},
+				"Dest":    pdf.Array{entries[i].page, pdf.Name("Fit")},
+			})
+		}
+		m.InsertPage(page, pdf.Dict{
+			"MediaBox":  pdf.Array{int64(0), int64(0), tocPageWidth, tocPageHeight},
+			"Resources": resources,
+			"Contents":  m.Add(pdf.NewStream(nil, pdf.FormatContent(ops))),
+			"Annots":    annots,
+		})
+	}
+}
+
+// cjkFont 返回阅读器内置的宋体（STSong-Light），无需嵌入字体文件即可显示中文
+func cjkFont(m *pdf.Merger) pdf.Dict {
+	descriptor := m.Add(pdf.Dict{
+		"Type":        pdf.Name("FontDescriptor"),
+		"FontName":    pdf.Name("STSong-Light"),
+		"Flags":       int64(6),
+		"FontBBox":    pdf.Array{int64(-25), int64(-254), int64(1000), int64(880)},
+		"ItalicAngle": int64(0),
+		"Ascent":      int64(880),
+		"Descent":     int64(-120),
+		"CapHeight":   int64(880),
+		"StemV":       int64(93),
+	})
+	descendant := m.Add(pdf.Dict{
+		"Type":           pdf.Name("Font"),
+		"Subtype":        pdf.Name("CIDFontType0"),
+		"BaseFont":       pdf.Name("STSong-Light"),
+		"CIDSystemInfo":  pdf.Dict{"Registry": pdf.String("Adobe"), "Ordering": pdf.String("GB1"), "Supplement": int64(4)},
+		"FontDescriptor": descriptor,
+		"DW":             int64(1000),
+		"W":              pdf.Array{int64(1), int64(95), int64(500)}, // ASCII字符为半角
+	})
+	return pdf.Dict{
+		"Type":            pdf.Name("Font"),
+		"Subtype":         pdf.Name("Type0"),
+		"BaseFont":        pdf.Name("STSong-Light-UniGB-UTF16-H"),
+		"Encoding":        pdf.Name("UniGB-UTF16-H"),
+		"DescendantFonts": pdf.Array{descendant},
+	}
+}
+
+func textOps(s string, size float64, x, y float64) []pdf.Operation {
+	return []pdf.Operation{
+		{Operator: "BT"},
+		{Operator: "Tf", Operands: []pdf.Object{pdf.Name("F1"), size}},
+		{Operator: "Td", Operands: []pdf.Object{x, y}},
+		{Operator: "Tj", Operands: []pdf.Object{pdf.UTF16BE(s)}},
+		{Operator: "ET"},
+	}
+}
+
+// textWidth 估算文字的宽度：ASCII字符为半角，其余字符为全角
+func textWidth(s string, size float64) float64 {
+	var w float64
+	for _, r := range s {
+		if r < 0x80 {
+			w += size / 2
+		} else {
+			w += size
+		}
+	}
+	return w
+}
+
+// truncateText 将过长的文字截断至maxWidth以内，并以省略号结尾
+func truncateText(s string, size, maxWidth float64) string {
+	if textWidth(s, size) <= maxWidth {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && textWidth(string(runes), size)+size > maxWidth {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
@@ -0,0 +1,55 @@
+package slide
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yliu7949/KouShare-dl/internal/pdf"
+)
+
+func TestCombineSlides(t *testing.T) {
+	dir := t.TempDir()
+	var slides []savedSlide
+	for i, title := range []string{"第一讲", "", "第三讲"} {
+		fileName := filepath.Join(dir, string(rune('a'+i))+".pdf")
+		writeTestSlides(t, fileName)
+		slides = append(slides, savedSlide{fileNames: []string{fileName}, seriesSlide: seriesSlide{Talk: Talk{Title: title, Speaker: "张三"}}})
+	}
+	slides = append(slides, savedSlide{fileNames: []string{filepath.Join(dir, "missing.pdf"), filepath.Join(dir, "notes.pptx")}})
+
+	s := Slide{seriesName: "测试专题", SaveDir: dir + "/", TOC: true}
+	s.combineSlides(slides)
+
+	doc, err := pdf.ReadFile(filepath.Join(dir, "测试专题.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 10 {
+		t.Fatalf("got %d pages, want 1 contents page and 9 slides", len(pages))
+	}
+	content, _ := doc.Contents(pages[0])[0].Decode()
+	if !strings.Contains(string(content), "Tj") {
+		t.Errorf("the contents page has no text: %q", content)
+	}
+	annots, _ := doc.Resolve(pages[0].Dict["Annots"]).(pdf.Array)
+	if len(annots) != 3 {
+		t.Fatalf("the contents page has %d links, want 3", len(annots))
+	}
+	link := doc.Resolve(annots[1]).(pdf.Dict)
+	if dest := doc.Resolve(link["Dest"]).(pdf.Array); dest[0] != pages[4].Ref {
+		t.Errorf("the second link points to %v, want page 5 %v", dest[0], pages[4].Ref)
+	}
+
+	catalog := doc.Resolve(doc.Trailer["Root"]).(pdf.Dict)
+	outlines := doc.Resolve(catalog["Outlines"]).(pdf.Dict)
+	second := doc.Resolve(outlines["First"]).(pdf.Dict)
+	second = doc.Resolve(second["Next"]).(pdf.Dict)
+	if got, want := string(second["Title"].(pdf.String)), string(pdf.TextString("b（张三）")); got != want {
+		t.Errorf("second outline title = %q, want %q", got, want)
+	}
+}
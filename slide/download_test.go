@@ -0,0 +1,94 @@
+package slide
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSaveFile(t *testing.T) {
+	deck := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte("slides "), 1000)...)
+	var fullRequests, rangeRequests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Range") != "" {
+			rangeRequests++
+		} else {
+			fullRequests++
+		}
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(deck))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir() + "/"
+	s := Slide{SaveDir: dir, name: "第一讲", url: server.URL + "/a"}
+	files := s.saveFile()
+	if len(files) != 1 || files[0] != dir+"第一讲.pdf" {
+		t.Fatalf("saveFile = %v", files)
+	}
+
+	// 再次下载时跳过未变化的课件
+	s.name = "第一讲"
+	if files = s.saveFile(); len(files) != 1 || files[0] != dir+"第一讲.pdf" {
+		t.Fatalf("second saveFile = %v", files)
+	}
+	if fullRequests != 2 || rangeRequests != 0 {
+		t.Errorf("got %d full and %d range requests, want 2 and 0", fullRequests, rangeRequests)
+	}
+
+	// 从中断处继续下载；内容与已下载的课件相同，不再重复保存
+	if err := os.WriteFile(dir+"第二讲.part", deck[:100], 0666); err != nil {
+		t.Fatal(err)
+	}
+	s = Slide{SaveDir: dir, name: "第二讲", url: server.URL + "/b"}
+	if files = s.saveFile(); len(files) != 1 || files[0] != dir+"第一讲.pdf" {
+		t.Fatalf("saveFile of the duplicate = %v", files)
+	}
+	if rangeRequests != 1 {
+		t.Errorf("got %d range requests, want 1", rangeRequests)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if got := strings.Join(names, " "); got != indexFileName+" 第一讲.pdf" {
+		t.Errorf("files in the folder: %s", got)
+	}
+
+	s = Slide{SaveDir: dir, name: "第三讲", url: server.URL + "/missing"}
+	if files = s.saveFile(); files != nil {
+		t.Errorf("saveFile of a missing file = %v", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "第三讲.pdf")); err == nil {
+		t.Error("the error page should not be saved")
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		s            string
+		start, total int64
+		ok           bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */200", 0, 200, true},
+		{"items 0-1/2", 0, 0, false},
+	}
+	for _, test := range tests {
+		start, total, ok := parseContentRange(test.s)
+		if start != test.start || total != test.total || ok != test.ok {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v", test.s, start, total, ok)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package slide
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// extractZip 将zip压缩包fileName中的文件解压到同名文件夹中，返回解压出的文件名。
+// 压缩包中的目录结构会被保留，但不会写出到该文件夹之外。
+func extractZip(fileName string) ([]string, error) {
+	r, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	dir := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	var files []string
+	for i, f := range r.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(filepath.Base(f.Name), ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		name := f.Name
+		if !utf8.ValidString(name) { //未使用UTF-8编码的文件名（如GBK）无法还原，以序号代替
+			name = fmt.Sprintf("file_%d%s", i+1, filepath.Ext(name))
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if rel, err := filepath.Rel(dir, dst); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return files, errors.New("压缩包中的文件路径无效：" + f.Name)
+		}
+		if err := extractZipFile(f, dst); err != nil {
+			return files, err
+		}
+		files = append(files, dst)
+	}
+	return files, nil
+}
+
+func extractZipFile(f *zip.File, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dstFile, src); err != nil {
+		_ = dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
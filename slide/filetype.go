@@ -0,0 +1,134 @@
+package slide
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// coursewareTypes 为Content-Type与课件扩展名的对应关系
+var coursewareTypes = map[string]string{
+	"application/pdf":               ".pdf",
+	"application/vnd.ms-powerpoint": ".ppt",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation": ".pptx",
+	"application/msword": ".doc",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+	"application/vnd.ms-excel": ".xls",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": ".xlsx",
+	"application/zip":              ".zip",
+	"application/x-zip-compressed": ".zip",
+	"application/x-rar-compressed": ".rar",
+	"application/vnd.rar":          ".rar",
+	"application/x-7z-compressed":  ".7z",
+	"application/gzip":             ".gz",
+	"image/jpeg":                   ".jpg",
+	"image/png":                    ".png",
+	"video/mp4":                    ".mp4",
+}
+
+// coursewareExts 为已知的课件扩展名，课件名以其结尾时视为已带有扩展名
+var coursewareExts = map[string]bool{
+	".pdf": true, ".ppt": true, ".pptx": true, ".pps": true, ".ppsx": true, ".key": true,
+	".doc": true, ".docx": true, ".xls": true, ".xlsx": true,
+	".zip": true, ".rar": true, ".7z": true, ".gz": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".mp4": true,
+}
+
+// detectFileType 判断已下载的课件fileName的实际类型，返回其扩展名（如".pptx"），无法判断时返回空字符串。
+// 文件头能确定类型时以文件头为准；否则依次参考响应头中Content-Disposition的文件名、Content-Type以及课件原来的名字。
+func detectFileType(fileName string, header http.Header, name string) string {
+	if ext := sniffFileType(fileName); ext != "" {
+		return ext
+	}
+	return headerFileType(header, name)
+}
+
+// headerFileType 仅根据响应头和课件原来的名字判断课件的类型
+func headerFileType(header http.Header, name string) string {
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		if ext := strings.ToLower(filepath.Ext(params["filename"])); coursewareExts[ext] {
+			return ext
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type")); err == nil {
+		if ext, ok := coursewareTypes[mediaType]; ok {
+			return ext
+		}
+	}
+	if ext := strings.ToLower(filepath.Ext(name)); coursewareExts[ext] {
+		return ext
+	}
+	return ""
+}
+
+// sniffFileType 根据文件头判断文件类型。旧版Office文件（ppt、doc、xls）的文件头相同，无法区分，此时返回空字符串。
+func sniffFileType(fileName string) string {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return ""
+	}
+	head := make([]byte, 1024)
+	n, _ := f.Read(head)
+	head = head[:n]
+	_ = f.Close()
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		return zipFileType(fileName)
+	case bytes.HasPrefix(head, []byte("Rar!\x1a\x07")):
+		return ".rar"
+	case bytes.HasPrefix(head, []byte("7z\xbc\xaf\x27\x1c")):
+		return ".7z"
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		return ".gz"
+	case bytes.Contains(head, []byte("%PDF-")): // 部分pdf文件的文件头之前有少量多余的字节
+		return ".pdf"
+	}
+	if ext, ok := coursewareTypes[http.DetectContentType(head)]; ok {
+		return ext
+	}
+	return ""
+}
+
+// zipFileType 区分普通的zip压缩包和以zip格式保存的Office文件
+func zipFileType(fileName string) string {
+	r, err := zip.OpenReader(fileName)
+	if err != nil {
+		return ".zip"
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		switch {
+		case strings.HasPrefix(f.Name, "ppt/"):
+			return ".pptx"
+		case strings.HasPrefix(f.Name, "word/"):
+			return ".docx"
+		case strings.HasPrefix(f.Name, "xl/"):
+			return ".xlsx"
+		}
+	}
+	return ".zip"
+}
+
+// withExt 为课件名加上扩展名ext。课件名已带有其它已知的扩展名时将其替换，如"报告.pdf"实为pptx文件时改为"报告.pptx"。
+func withExt(name, ext string) string {
+	if ext == "" {
+		return name
+	}
+	old := filepath.Ext(name)
+	if strings.EqualFold(old, ext) {
+		return name
+	}
+	if coursewareExts[strings.ToLower(old)] {
+		name = strings.TrimSuffix(name, old)
+	}
+	return name + ext
+}
+
+func isPDF(fileName string) bool {
+	return strings.EqualFold(filepath.Ext(fileName), ".pdf")
+}
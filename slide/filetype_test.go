@@ -0,0 +1,104 @@
+package slide
+
+import (
+	"archive/zip"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestZip(t *testing.T, fileName string, files map[string]string) {
+	f, err := os.Create(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = fw.Write([]byte(content))
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+}
+
+func TestDetectFileType(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		fileName := filepath.Join(dir, name)
+		if err := os.WriteFile(fileName, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return fileName
+	}
+	pptx := filepath.Join(dir, "pptx")
+	writeTestZip(t, pptx, map[string]string{"[Content_Types].xml": "", "ppt/presentation.xml": ""})
+	archive := filepath.Join(dir, "zip")
+	writeTestZip(t, archive, map[string]string{"a.pdf": "%PDF-1.4"})
+	ole := write("ole", "\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")
+
+	tests := []struct {
+		fileName string
+		header   http.Header
+		name     string
+		want     string
+	}{
+		{write("pdf", "%PDF-1.7\n"), nil, "报告.pptx", ".pdf"},
+		{pptx, http.Header{"Content-Type": {"application/pdf"}}, "报告.pdf", ".pptx"},
+		{archive, nil, "报告", ".zip"},
+		{ole, http.Header{"Content-Disposition": {`attachment; filename*=UTF-8''%E6%8A%A5%E5%91%8A.ppt`}}, "报告", ".ppt"},
+		{ole, http.Header{"Content-Type": {"application/msword"}}, "报告", ".doc"},
+		{ole, http.Header{"Content-Type": {"application/octet-stream"}}, "报告.xls", ".xls"},
+		{ole, nil, "报告", ""},
+	}
+	for _, test := range tests {
+		if test.header == nil {
+			test.header = http.Header{}
+		}
+		if got := detectFileType(test.fileName, test.header, test.name); got != test.want {
+			t.Errorf("detectFileType(%s, %v, %s) = %q, want %q", filepath.Base(test.fileName), test.header, test.name, got, test.want)
+		}
+	}
+}
+
+func TestWithExt(t *testing.T) {
+	tests := []struct{ name, ext, want string }{
+		{"报告", ".pptx", "报告.pptx"},
+		{"报告.pdf", ".pptx", "报告.pptx"},
+		{"报告.PDF", ".pdf", "报告.PDF"},
+		{"Dr. Wang", ".pdf", "Dr. Wang.pdf"},
+		{"报告.key", "", "报告.key"},
+	}
+	for _, test := range tests {
+		if got := withExt(test.name, test.ext); got != test.want {
+			t.Errorf("withExt(%q, %q) = %q, want %q", test.name, test.ext, got, test.want)
+		}
+	}
+}
+
+func TestExtractZip(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "课件.zip")
+	writeTestZip(t, fileName, map[string]string{"第一讲.pdf": "%PDF-1.4", "附录/数据.xlsx": "", "__MACOSX/._第一讲.pdf": ""})
+	files, err := extractZip(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("extracted %v, want 2 files", files)
+	}
+	dir := filepath.Join(filepath.Dir(fileName), "课件")
+	if _, err = os.Stat(filepath.Join(dir, "附录", "数据.xlsx")); err != nil {
+		t.Error(err)
+	}
+
+	evil := filepath.Join(t.TempDir(), "evil.zip")
+	writeTestZip(t, evil, map[string]string{"../outside.pdf": ""})
+	if _, err = extractZip(evil); err == nil {
+		t.Error("extractZip should refuse paths outside the target folder")
+	}
+}
@@ -0,0 +1,115 @@
+package slide
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// indexFileName 为保存课件下载记录的文件名，位于课件所在的文件夹中
+const indexFileName = ".koushare-slides.json"
+
+// slideIndex 记录文件夹中已下载的课件，用于跳过未变化的课件和去除内容相同的课件
+type slideIndex struct {
+	dir     string
+	Entries map[string]*indexEntry `json:"entries"` //以课件的下载链接为键
+}
+
+// indexEntry 为一个课件的下载记录
+type indexEntry struct {
+	Files     []string `json:"files"`               //保存的文件，为相对于课件文件夹的路径；下载未完成时为空
+	Size      int64    `json:"size"`                //服务器返回的文件大小，未知时为-1
+	ETag      string   `json:"etag,omitempty"`      //服务器返回的ETag
+	SHA256    string   `json:"sha256,omitempty"`    //下载内容的SHA-256
+	Optimized bool     `json:"optimized,omitempty"` //是否已去除pdf文件中的水印
+	Talk
+}
+
+// loadSlideIndex 读取文件夹dir中的下载记录，记录不存在或损坏时返回空记录
+func loadSlideIndex(dir string) *slideIndex {
+	idx := &slideIndex{dir: dir}
+	if data, err := os.ReadFile(filepath.Join(dir, indexFileName)); err == nil {
+		_ = json.Unmarshal(data, idx)
+	}
+	if idx.Entries == nil {
+		idx.Entries = make(map[string]*indexEntry)
+	}
+	return idx
+}
+
+func (idx *slideIndex) save() error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpName := filepath.Join(idx.dir, indexFileName+".tmp")
+	if err = os.WriteFile(tmpName, data, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, filepath.Join(idx.dir, indexFileName))
+}
+
+// paths 返回记录中文件的完整路径，任一文件不存在时返回nil
+func (idx *slideIndex) paths(e *indexEntry) []string {
+	if e == nil || len(e.Files) == 0 {
+		return nil
+	}
+	var paths []string
+	for _, file := range e.Files {
+		path := filepath.Join(idx.dir, filepath.FromSlash(file))
+		if _, err := os.Stat(path); err != nil {
+			return nil
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// unchanged 判断下载链接为url的课件是否已下载且服务器上的文件没有变化：有ETag时比较ETag，否则比较文件大小
+func (idx *slideIndex) unchanged(url string, size int64, etag string) bool {
+	e := idx.Entries[url]
+	if idx.paths(e) == nil {
+		return false
+	}
+	if etag != "" && e.ETag != "" {
+		return etag == e.ETag
+	}
+	return size >= 0 && size == e.Size
+}
+
+// findContent 查找内容的SHA-256为sum且文件仍然存在的课件
+func (idx *slideIndex) findContent(sum string) *indexEntry {
+	for _, e := range idx.Entries {
+		if e.SHA256 == sum && idx.paths(e) != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// record 记录下载链接为url的课件保存的文件
+func (idx *slideIndex) record(url string, e *indexEntry, paths []string) {
+	e.Files = e.Files[:0]
+	for _, path := range paths {
+		if rel, err := filepath.Rel(idx.dir, path); err == nil {
+			e.Files = append(e.Files, filepath.ToSlash(rel))
+		}
+	}
+	idx.Entries[url] = e
+}
+
+func fileSHA256(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -1,131 +1,89 @@
-//go:build !windows
-
 package slide
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"regexp"
-	"strconv"
-	"strings"
-)
 
-var qpdfBinPath = ""
-
-func optimizePDF(fileName string) {
-	_ = decompressPdfFile(fileName)
-	offsetMap := getOffsetFromXref(fileName)
-	objectSlice := getObjectSlice(fileName)
+	"github.com/yliu7949/KouShare-dl/internal/pdf"
+)
 
-	pdfFile, err := os.OpenFile(fileName, os.O_RDWR, 0666)
+// optimizePDF 去除课件每一页上叠加的水印，返回处理的页数。
+// 水印以单独的内容流附加在页面原有内容之后：文字水印通过将字号（Tf）设为0隐藏，图片水印则删除其绘制指令（Do）。
+// 仅有一个内容流的页面没有叠加水印，不做处理。
+func optimizePDF(fileName string) (int, error) {
+	doc, err := pdf.ReadFile(fileName)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return 0, err
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		return 0, err
 	}
-	for _, objID := range objectSlice {
-		_, _ = pdfFile.Seek(offsetMap[objID], 0)
-		id, _ := strconv.Atoi(objID)
-		buff := make([]byte, offsetMap[strconv.Itoa(id+1)]-offsetMap[objID]-1)
-		_, err = pdfFile.Read(buff)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
 
-		var result string
-		reg := regexp.MustCompile(` \d+ Tf`)
-		if reg.MatchString(string(buff)) {
-			result = reg.ReplaceAllString(string(buff), " 00 Tf")
-		} else {
-			reg = regexp.MustCompile(`/.+Do`)
-			strSlice := reg.FindStringSubmatch(string(buff))
-			if len(strSlice) != 0 {
-				result = reg.ReplaceAllString(string(buff), strings.Repeat("\n", len(strSlice[0])))
-			} else {
-				fmt.Println("obj:", objID, "未匹配，跳过该对象。")
-				continue
-			}
+	done := make(map[*pdf.Stream]bool) // 多个页面可能共用同一个水印内容流
+	var count int
+	for _, page := range pages {
+		contents := doc.Contents(page)
+		if len(contents) < 2 {
+			continue
+		}
+		overlay := contents[len(contents)-1]
+		if done[overlay] {
+			count++
+			continue
 		}
-		_, _ = pdfFile.Seek(offsetMap[objID], 0)
-		_, err = pdfFile.Write([]byte(result))
+		data, err := overlay.Decode()
 		if err != nil {
-			fmt.Println(err)
-			return
+			return count, err
 		}
-	}
-	_ = pdfFile.Close()
-	_ = compressPdfFile(fileName)
-	//如果在解压pdf文件时得到了warning，则会生成以~qpdf-orig结尾的备份文件；如果解压时没有警告和错误，则不会生成备份文件
-	if _, err := os.Stat(fileName + ".~qpdf-orig"); err == nil {
-		err = os.Remove(fileName + ".~qpdf-orig") //删除备份文件
+		ops, err := pdf.ParseContent(data)
 		if err != nil {
-			return
+			return count, err
+		}
+		if ops, ok := stripOverlay(ops); ok {
+			overlay.SetData(pdf.FormatContent(ops))
+			done[overlay] = true
+			count++
 		}
 	}
-}
-
-// 获取解压后的pdf文件中的obj列表
-func getObjectSlice(fileName string) (objectSlice []string) {
-	cmd := exec.Command(qpdfBinPath+"qpdf", "--show-pages", fileName)
-	output, err := cmd.Output()
-	if err != nil {
-		fmt.Println(err)
-		return nil
-	}
-	showPages := string(output) + "p"
-
-	//通过正则表达式获取pdf文件中每一页content中的最后一个对象的ID，并存储在objectSlice变量里
-	reg := regexp.MustCompile(`content:\s+(?:.+\s+){2,5}\s+(?P<x>\d+).+\np`)
-	if !reg.MatchString(showPages) {
-		fmt.Println("Not match.")
-		return nil
-	}
-	result := reg.FindAllStringSubmatch(showPages, -1)
-	for i := 0; i < len(result); i++ {
-		objectSlice = append(objectSlice, result[i][1])
+	if count == 0 {
+		return 0, nil
 	}
-	return objectSlice
+	return count, doc.WriteFile(fileName)
 }
 
-func getOffsetFromXref(fileName string) map[string]int64 {
-	cmd := exec.Command(qpdfBinPath+"qpdf", "--show-xref", fileName)
-	output, err := cmd.Output()
-	if err != nil {
-		fmt.Println(err)
-		return nil
-	}
-	showXref := string(output)
-
-	//通过正则表达式获取pdf文件中的每一个obj及其距文档开头的offset，并存储在offsetMap变量里
-	reg := regexp.MustCompile(`(?P<object>\d+).+= (?P<offset>\d+)`)
-	if !reg.MatchString(showXref) {
-		fmt.Println("Not match.")
-		return nil
+// stripOverlay 隐藏水印内容流中的文字；没有文字时删除其中绘制的图片
+func stripOverlay(ops []pdf.Operation) ([]pdf.Operation, bool) {
+	var changed bool
+	for i, op := range ops {
+		if op.Operator == "Tf" && len(op.Operands) == 2 {
+			ops[i].Operands = []pdf.Object{op.Operands[0], int64(0)}
+			changed = true
+		}
 	}
-	result := reg.FindAllStringSubmatch(showXref, -1)
-	offsetMap := make(map[string]int64)
-	for i := 0; i < len(result); i++ {
-		offset, _ := strconv.Atoi(result[i][2])
-		offsetMap[result[i][1]] = int64(offset)
+	if changed {
+		return ops, true
 	}
-	return offsetMap
-}
 
-func decompressPdfFile(fileName string) error {
-	cmd := exec.Command(qpdfBinPath+"qpdf", "--qdf", "--replace-input", fileName)
-	err := cmd.Run()
-	if err != nil {
-		return err
+	kept := ops[:0]
+	for _, op := range ops {
+		if op.Operator == "Do" {
+			changed = true
+			continue
+		}
+		kept = append(kept, op)
 	}
-	return nil
+	return kept, changed
 }
 
-func compressPdfFile(fileName string) error {
-	cmd := exec.Command(qpdfBinPath+"qpdf", "--replace-input", fileName)
-	err := cmd.Run()
-	if err != nil {
-		return err
+// optimizeSavedPDF 对下载的课件去除水印并输出结果
+func optimizeSavedPDF(fileName string) {
+	count, err := optimizePDF(fileName)
+	switch {
+	case err != nil:
+		fmt.Println("去除水印失败：", err)
+	case count == 0:
+		fmt.Println("未发现水印。")
+	default:
+		fmt.Printf("已去除 %d 页的水印。\n", count)
 	}
-	return nil
 }
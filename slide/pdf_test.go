@@ -0,0 +1,63 @@
+package slide
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yliu7949/KouShare-dl/internal/pdf"
+)
+
+// writeTestSlides 生成一个三页的课件：前两页叠加了文字水印，第三页叠加了图片水印
+func writeTestSlides(t *testing.T, fileName string) {
+	doc := pdf.New()
+	text := doc.Add(pdf.NewStream(nil, []byte("q BT /F1 40 Tf (KouShare) Tj ET Q")))
+	image := doc.Add(pdf.NewStream(nil, []byte("q 100 0 0 100 0 0 cm /Im0 Do Q")))
+	pages := pdf.Ref{Num: 100}
+	var kids pdf.Array
+	for i, overlay := range []pdf.Ref{text, text, image} {
+		body := doc.Add(pdf.NewStream(nil, []byte("BT /F1 12 Tf (page "+string(rune('1'+i))+") Tj ET")))
+		kids = append(kids, doc.Add(pdf.Dict{"Type": pdf.Name("Page"), "Parent": pages, "Contents": pdf.Array{body, overlay}}))
+	}
+	doc.Set(pages, pdf.Dict{"Type": pdf.Name("Pages"), "Kids": kids, "Count": int64(len(kids)), "MediaBox": pdf.Array{int64(0), int64(0), int64(720), int64(540)}})
+	doc.Trailer["Root"] = doc.Add(pdf.Dict{"Type": pdf.Name("Catalog"), "Pages": pages})
+	if err := doc.WriteFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOptimizePDF(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "slides.pdf")
+	writeTestSlides(t, fileName)
+
+	count, err := optimizePDF(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("optimizePDF processed %d pages, want 3", count)
+	}
+
+	doc, err := pdf.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, page := range pages {
+		contents := doc.Contents(page)
+		body, _ := contents[0].Decode()
+		overlay, _ := contents[1].Decode()
+		if !strings.Contains(string(body), "12 Tf") {
+			t.Errorf("page %d: the page content was changed: %q", i+1, body)
+		}
+		if i < 2 && !strings.Contains(string(overlay), "/F1 0 Tf") {
+			t.Errorf("page %d: the text watermark is still visible: %q", i+1, overlay)
+		}
+		if i == 2 && strings.Contains(string(overlay), "Do") {
+			t.Errorf("page %d: the image watermark is still drawn: %q", i+1, overlay)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package slide
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+)
+
+// maxSnippets 为每个课件最多显示的匹配页数
+const maxSnippets = 5
+
+// snippetContext 为匹配内容前后显示的字数
+const snippetContext = 20
+
+// pageMatch 为课件中匹配的一页
+type pageMatch struct {
+	page    int
+	snippet string
+}
+
+// Search 在dir及其子文件夹中的pdf课件中搜索query，同时匹配下载记录中的视频标题和讲者，输出匹配的报告、vid和页码。
+// 搜索时忽略大小写和空白字符；尚未提取文字的课件会先提取文字并保存为同名的txt文件。
+func Search(query, dir string) {
+	if len(normalizeText(query)) == 0 {
+		fmt.Println("搜索内容不能为空。")
+		return
+	}
+	talks := collectTalks(dir)
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && isPDF(path) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("读取目录错误：", err)
+		return
+	}
+
+	var count int
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		pages, err := extractText(file)
+		if err != nil {
+			fmt.Printf("无法读取课件 %s：%v\n", rel, err)
+			continue
+		}
+		var matches []pageMatch
+		for i, page := range pages {
+			if snippet, ok := matchText(page, query); ok {
+				matches = append(matches, pageMatch{i + 1, snippet})
+			}
+		}
+		abs, _ := filepath.Abs(file)
+		fileTalks := talks[abs]
+		var talkMatched bool
+		for _, talk := range fileTalks {
+			if _, ok := matchText(talk.Title+" "+talk.Speaker, query); ok {
+				talkMatched = true
+			}
+		}
+		if len(matches) == 0 && !talkMatched {
+			continue
+		}
+		count++
+		printSearchResult(rel, fileTalks, talkMatched, matches)
+	}
+
+	if count == 0 {
+		fmt.Printf("没有找到与\"%s\"匹配的课件。\n", query)
+	} else {
+		fmt.Printf("共有 %d 个课件与\"%s\"匹配。\n", count, query)
+	}
+}
+
+func printSearchResult(fileName string, talks []Talk, talkMatched bool, matches []pageMatch) {
+	for _, talk := range talks {
+		label := talk.Title
+		if talk.Speaker != "" {
+			label += "（" + talk.Speaker + "）"
+		}
+		fmt.Printf("%s\tvid=%s\n", color.Emphasize(label), talk.Vid)
+	}
+	fmt.Println("  课件：", fileName)
+	if talkMatched {
+		fmt.Println("  视频标题或讲者匹配")
+	}
+	if len(matches) != 0 {
+		pages := make([]string, len(matches))
+		for i, m := range matches {
+			pages[i] = fmt.Sprint(m.page)
+		}
+		fmt.Printf("  匹配的页码：%s\n", strings.Join(pages, "、"))
+	}
+	for i, m := range matches {
+		if i == maxSnippets {
+			fmt.Printf("  ……（另有 %d 页匹配）\n", len(matches)-maxSnippets)
+			break
+		}
+		fmt.Printf("  第 %d 页：%s\n", m.page, m.snippet)
+	}
+	fmt.Println()
+}
+
+// collectTalks 读取dir及其子文件夹中的下载记录，返回课件文件（绝对路径）所属的报告
+func collectTalks(dir string) map[string][]Talk {
+	talks := make(map[string][]Talk)
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() != indexFileName {
+			return nil
+		}
+		idx := loadSlideIndex(filepath.Dir(path))
+		for _, e := range idx.Entries {
+			if e.Talk == (Talk{}) {
+				continue
+			}
+			for _, file := range idx.paths(e) {
+				abs, _ := filepath.Abs(file)
+				if !containsTalk(talks[abs], e.Talk) {
+					talks[abs] = append(talks[abs], e.Talk)
+				}
+			}
+		}
+		return nil
+	})
+	return talks
+}
+
+func containsTalk(talks []Talk, talk Talk) bool {
+	for _, t := range talks {
+		if t == talk {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeText 将文字转换为小写并去除空白字符
+func normalizeText(text string) []rune {
+	runes, _ := normalizeRunes([]rune(text))
+	return runes
+}
+
+// normalizeRunes 与normalizeText相同，同时返回每个字符在原文中的位置
+func normalizeRunes(text []rune) (runes []rune, positions []int) {
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		runes = append(runes, unicode.ToLower(r))
+		positions = append(positions, i)
+	}
+	return runes, positions
+}
+
+// matchText 在text中查找query（忽略大小写和空白字符），返回匹配处及其前后文字组成的摘要
+func matchText(text, query string) (string, bool) {
+	q := normalizeText(query)
+	original := []rune(text)
+	runes, positions := normalizeRunes(original)
+	k := indexRunes(runes, q)
+	if len(q) == 0 || k < 0 {
+		return "", false
+	}
+	start, end := positions[k], positions[k+len(q)-1]+1
+	from, to := start-snippetContext, end+snippetContext
+	prefix, suffix := "…", "…"
+	if from <= 0 {
+		from, prefix = 0, ""
+	}
+	if to >= len(original) {
+		to, suffix = len(original), ""
+	}
+	return prefix + collapseSpace(string(original[from:start])) + color.Highlight(collapseSpace(string(original[start:end]))) +
+		collapseSpace(string(original[end:to])) + suffix, true
+}
+
+func indexRunes(s, sub []rune) int {
+	for i := 0; i+len(sub) <= len(s); i++ {
+		j := 0
+		for j < len(sub) && s[i+j] == sub[j] {
+			j++
+		}
+		if j == len(sub) {
+			return i
+		}
+	}
+	return -1
+}
+
+// collapseSpace 将连续的空白字符（包括换行）替换为一个空格
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
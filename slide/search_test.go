@@ -0,0 +1,86 @@
+package slide
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+	"github.com/yliu7949/KouShare-dl/internal/pdf"
+)
+
+func TestExtractText(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "slides.pdf")
+	writeTestSlides(t, fileName)
+	if _, err := optimizePDF(fileName); err != nil {
+		t.Fatal(err)
+	}
+	// 为第一页加上字体，使其中的文字可以提取
+	doc, err := pdf.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, _ := doc.Pages()
+	for _, page := range pages {
+		page.Dict["Resources"] = pdf.Dict{"Font": pdf.Dict{"F1": pdf.Dict{"Type": pdf.Name("Font"), "Subtype": pdf.Name("Type1"), "BaseFont": pdf.Name("Helvetica")}}}
+	}
+	if err = doc.WriteFile(fileName); err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := extractText(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(text, "|"); got != "page 1|page 2|page 3" { // 已隐藏的水印文字不会被提取
+		t.Errorf("extractText = %q", got)
+	}
+	data, err := os.ReadFile(textFileName(fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "page 1\fpage 2\fpage 3" {
+		t.Errorf("txt file = %q", data)
+	}
+}
+
+func TestMatchText(t *testing.T) {
+	color.DisableColor(true)
+	text := "Introduction\nThe Phase\nDiagram of water and ice, measured at low temperature in the laboratory"
+	snippet, ok := matchText(text, "phase diagram")
+	if !ok {
+		t.Fatal("matchText did not match across a line break")
+	}
+	if want := "Introduction The Phase Diagram of water and ice, m…"; snippet != want {
+		t.Errorf("snippet = %q, want %q", snippet, want)
+	}
+	if _, ok = matchText("相 图", "相图"); !ok {
+		t.Error("matchText should ignore whitespace between CJK characters")
+	}
+	if _, ok = matchText(text, "phase transition"); ok {
+		t.Error("matchText matched a missing query")
+	}
+}
+
+func TestCollectTalks(t *testing.T) {
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, "课件", "a.pdf")
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fileName, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	idx := loadSlideIndex(dir)
+	talk := Talk{Vid: "7405", Title: "相变", Speaker: "张三"}
+	idx.record("https://example.com/a.zip", &indexEntry{Talk: talk}, []string{fileName})
+	if err := idx.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	abs, _ := filepath.Abs(fileName)
+	if got := collectTalks(dir)[abs]; len(got) != 1 || got[0] != talk {
+		t.Errorf("collectTalks = %v", got)
+	}
+}
@@ -3,7 +3,10 @@ package slide
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/tidwall/gjson"
@@ -14,17 +17,36 @@ import (
 
 // Slide 包含视频号、课件下载链接等基本信息
 type Slide struct {
-	Vid             string
-	svid            string   //专题id
-	seriesName      string   //专题名字
-	svpid           string   //子专题id
-	svpName         string   //子专题名字
-	name            string   //单个课件的文件名
-	url             string   //单个课件的下载链接
-	coursewareNames []string //该专题视频中所有课件的文件名
-	coursewareURLs  []string //该专题视频中所有课件的下载链接
-	QpdfPath        string   //qpdf的bin路径
-	SaveDir         string
+	Vid          string
+	svid         string        //专题id
+	seriesName   string        //专题名字
+	svpid        string        //子专题id
+	svpName      string        //子专题名字
+	name         string        //单个课件的文件名
+	url          string        //单个课件的下载链接
+	seriesSlides []seriesSlide //该专题视频中所有课件的信息
+	Optimize     bool          //是否去除课件中的水印
+	Combine      bool          //是否将专题课件合并为一个pdf文件
+	TOC          bool          //合并时是否生成目录页
+	Extract      bool          //是否解压zip格式的课件
+	Text         bool          //是否提取pdf课件中的文字，保存为同名的txt文件
+	index        *slideIndex   //课件文件夹中的下载记录
+	talk         Talk          //当前下载的课件所属的报告
+	SaveDir      string
+}
+
+// Talk 为课件所属报告的信息，记录在下载记录中，搜索课件时用于显示和匹配
+type Talk struct {
+	Vid     string `json:"vid,omitempty"`
+	Title   string `json:"title,omitempty"`   //视频标题
+	Speaker string `json:"speaker,omitempty"` //讲者
+}
+
+// seriesSlide 为专题中一个视频的课件信息
+type seriesSlide struct {
+	name string //课件的文件名
+	url  string //课件的下载链接
+	Talk
 }
 
 // DownloadSingleSlide 下载指定vid的视频对应的课件
@@ -71,22 +93,38 @@ func (s *Slide) DownloadSeriesSlides() {
 		}
 	}
 
-	var tempName string //用来记录for循环中上一次下载课件的名字
-	for i, coursewareURL := range s.coursewareURLs {
-		if s.url = coursewareURL[1 : len(coursewareURL)-1]; len(s.url) == 0 {
+	downloaded := make(map[string]bool) //多个视频可能共用同一个课件，每个下载链接只下载一次
+	var saved []savedSlide
+	for i, item := range s.seriesSlides {
+		if s.url = item.url; len(s.url) == 0 || downloaded[s.url] {
 			continue
 		}
-		if i >= 1 && tempName+`"` == s.coursewareNames[i][1:] { //若本次要下载的文件与上一次下载的文件相同，则跳过本次下载
-			continue
+		downloaded[s.url] = true
+		fmt.Printf("正在下载 \"%s\"专题课件(%d/%d)\t", s.seriesName, i+1, len(s.seriesSlides))
+		s.name, s.talk = item.name, item.Talk
+		if fileNames := s.saveFile(); len(fileNames) != 0 {
+			saved = append(saved, savedSlide{fileNames: fileNames, seriesSlide: item})
 		}
-		fmt.Printf("正在下载 \"%s\"专题课件(%d/%d)\t", s.seriesName, i+1, len(s.coursewareURLs))
-		s.name = s.coursewareNames[i]
-		s.name = s.name[1 : len(s.name)-1]
-		tempName = s.name
-		s.saveFile()
+	}
+
+	if s.Combine {
+		s.combineSlides(saved)
 	}
 }
 
+// SaveCourseware 将报告talk的下载链接为url的课件保存至SaveDir，文件名为name加上课件实际的扩展名，返回保存的文件名。
+// 用于在已获取视频信息时直接下载其课件，如与视频一同下载课件。
+func (s *Slide) SaveCourseware(url, name string, talk Talk) []string {
+	if _, err := os.Stat(s.SaveDir); os.IsNotExist(err) {
+		if err := os.MkdirAll(s.SaveDir, os.ModePerm); err != nil {
+			fmt.Println("创建下载文件夹失败：", err)
+			return nil
+		}
+	}
+	s.url, s.name, s.talk = url, name, talk
+	return s.saveFile()
+}
+
 func (s *Slide) getSlideInfo() bool {
 	URL := config.APIBaseURL() + "/api/api-video/getVideoById?vid=" + s.Vid + "&related=3&allData=1&password="
 	str, err := user.MyGetRequest(URL)
@@ -105,6 +143,7 @@ func (s *Slide) getSlideInfo() bool {
 	s.svpName = gjson.Get(str, "data.svpname").String()
 	s.name = gjson.Get(str, "data.vcourseware").String()
 	s.url = gjson.Get(str, "data.vcoursewareurl").String()
+	s.talk = Talk{Vid: s.Vid, Title: gjson.Get(str, "data.vtitle").String(), Speaker: gjson.Get(str, "data.details_name").String()}
 	return true
 }
 
@@ -123,38 +162,230 @@ func (s *Slide) findSeriesSlides() {
 	if str, err := user.MyGetRequest(URL); err != nil {
 		fmt.Println("Get请求出错：", err)
 	} else {
-		coursewareNames := gjson.Get(str, `data.#(svid=="`+s.svid+`")#.vcourseware`).String()
-		s.coursewareNames = strings.Split(coursewareNames[1:len(coursewareNames)-1], ",")
-		coursewareURLs := gjson.Get(str, `data.#(svid=="`+s.svid+`")#.vcoursewareurl`).String()
-		s.coursewareURLs = strings.Split(coursewareURLs[1:len(coursewareURLs)-1], ",")
+		s.seriesSlides = nil
+		for _, video := range gjson.Get(str, `data.#(svid=="`+s.svid+`")#`).Array() {
+			s.seriesSlides = append(s.seriesSlides, seriesSlide{
+				name: video.Get("vcourseware").String(),
+				url:  video.Get("vcoursewareurl").String(),
+				Talk: Talk{
+					Vid:     video.Get("vid").String(),
+					Title:   video.Get("vtitle").String(),
+					Speaker: video.Get("details_name").String(),
+				},
+			})
+		}
 	}
 }
 
-func (s *Slide) saveFile() {
-	resp, err := proxy.Client.Get(s.url)
+// saveFile 下载课件，返回保存的文件名，下载失败时返回空切片。
+// 课件先下载为.part文件，中断后再次运行时从断点处继续；已下载且服务器上未变化的课件会被跳过，
+// 内容与已下载的课件相同时不再重复保存。课件的扩展名根据其实际类型确定；解压zip压缩包时返回解压出的文件。
+func (s *Slide) saveFile() []string {
+	if s.index == nil || s.index.dir != s.SaveDir {
+		s.index = loadSlideIndex(s.SaveDir)
+	}
+	entry := s.index.Entries[s.url]
+	if entry == nil {
+		entry = &indexEntry{Size: -1}
+	}
+
+	partName := s.SaveDir + s.name + ".part"
+	resp, offset, size, err := s.requestFile(partName, entry.ETag)
 	if err != nil {
-		fmt.Println("Get请求出错：", err.Error())
-		return
+		fmt.Println("下载课件失败：", err)
+		return nil
 	}
 	defer resp.Body.Close()
-	if len(s.name) >= 3 && s.name[len(s.name)-3:] != "pdf" {
-		s.name += ".pdf"
+	etag := resp.Header.Get("ETag")
+
+	if s.index.unchanged(s.url, size, etag) {
+		_ = os.Remove(partName)
+		files := s.index.paths(entry)
+		fmt.Printf("%s 已存在，跳过下载。\n", filepath.Base(files[0]))
+		s.recordEntry(entry, files) //更新报告的信息
+		return s.processFiles(entry, files)
 	}
-	fmt.Println(s.name)
-	dstFile, err := os.OpenFile(s.SaveDir+s.name, os.O_CREATE|os.O_WRONLY, 0666)
-	if err != nil {
+	if entry.Files == nil { //兼容没有下载记录的旧文件：同名且大小相同时视为已下载
+		existing := s.SaveDir + withExt(s.name, headerFileType(resp.Header, s.name))
+		if info, err := os.Stat(existing); err == nil && size >= 0 && info.Size() == size {
+			_ = os.Remove(partName)
+			fmt.Printf("%s 已存在，跳过下载。\n", filepath.Base(existing))
+			entry = &indexEntry{Size: size, ETag: etag}
+			entry.SHA256, _ = fileSHA256(existing)
+			s.recordEntry(entry, []string{existing})
+			return s.processFiles(entry, []string{existing})
+		}
+	}
+
+	if offset == 0 || etag != entry.ETag { //记录ETag，以便断点续传时确认服务器上的文件没有变化
+		entry = &indexEntry{Size: size, ETag: etag}
+		s.recordEntry(entry, nil)
+	}
+	if err = writePart(partName, resp.Body, offset, size); err != nil {
+		fmt.Println("下载课件失败：", err)
+		fmt.Println("再次运行该命令可继续下载。")
+		return nil
+	}
+
+	if entry.SHA256, err = fileSHA256(partName); err != nil {
 		fmt.Println(err.Error())
-		return
+		return nil
 	}
-	if _, err = io.Copy(dstFile, resp.Body); err != nil {
+	if same := s.index.findContent(entry.SHA256); same != nil {
+		_ = os.Remove(partName)
+		files := s.index.paths(same)
+		fmt.Printf("内容与已下载的 %s 相同，不再重复保存。\n", filepath.Base(files[0]))
+		entry.Optimized = same.Optimized
+		s.recordEntry(entry, files)
+		return s.processFiles(entry, files)
+	}
+
+	ext := detectFileType(partName, resp.Header, s.name)
+	s.name = withExt(s.name, ext)
+	fmt.Println(s.name)
+	fileName := s.SaveDir + s.name
+	if err = os.Rename(partName, fileName); err != nil {
 		fmt.Println(err.Error())
-		return
+		return nil
 	}
-	_ = dstFile.Close()
 
-	//优化pdf文件
-	if s.QpdfPath != "" {
-		qpdfBinPath = s.QpdfPath
-		optimizePDF(s.SaveDir + s.name)
+	files := []string{fileName}
+	switch {
+	case ext == ".zip" && s.Extract:
+		files = s.extractSavedZip(fileName)
+	case (ext == ".rar" || ext == ".7z") && s.Extract:
+		fmt.Printf("暂不支持解压%s格式的压缩包，已保留原文件。\n", ext)
+	}
+	s.recordEntry(entry, files)
+	return s.processFiles(entry, files)
+}
+
+// requestFile 请求课件。partName已存在时请求其后的部分，返回的offset为本次下载的起始位置，size为文件的总大小（未知时为-1）。
+// etag为上次下载时服务器返回的ETag，服务器上的文件已变化时重新下载整个文件。
+func (s *Slide) requestFile(partName, etag string) (resp *http.Response, offset, size int64, err error) {
+	if info, err := os.Stat(partName); err == nil {
+		offset = info.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		if etag != "" {
+			req.Header.Set("If-Range", etag)
+		}
+	}
+	if resp, err = proxy.Client.Do(req); err != nil {
+		return nil, 0, 0, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, 0, resp.ContentLength, nil
+	case http.StatusPartialContent:
+		start, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if ok && start == offset {
+			return resp, offset, total, nil
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// .part文件已经完整，只是上次没来得及重命名
+		if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+			return resp, offset, total, nil
+		}
+	default:
+		resp.Body.Close()
+		return nil, 0, 0, fmt.Errorf("服务器返回 %s", resp.Status)
+	}
+
+	// 服务器返回的范围与请求的不符，删除.part文件后重新下载
+	resp.Body.Close()
+	if err = os.Remove(partName); err != nil {
+		return nil, 0, 0, err
+	}
+	return s.requestFile(partName, "")
+}
+
+// parseContentRange 解析"bytes 100-199/200"或"bytes */200"形式的Content-Range，total未知时为-1
+func parseContentRange(contentRange string) (start, total int64, ok bool) {
+	var end int64
+	var totalStr string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &totalStr); err != nil {
+		start = 0
+		if _, err = fmt.Sscanf(contentRange, "bytes */%s", &totalStr); err != nil {
+			return 0, 0, false
+		}
+	}
+	if totalStr == "*" {
+		return start, -1, true
+	}
+	total, err := strconv.ParseInt(totalStr, 10, 64)
+	return start, total, err == nil
+}
+
+// writePart 将body写入partName的offset处，并检查写入后的文件大小是否为size
+func writePart(partName string, body io.Reader, offset, size int64) error {
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(partName, flag, 0666)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && offset+n != size {
+		return fmt.Errorf("文件不完整（%d/%d字节）", offset+n, size)
+	}
+	return nil
+}
+
+// recordEntry 更新当前课件的下载记录
+func (s *Slide) recordEntry(entry *indexEntry, files []string) {
+	if s.talk != (Talk{}) {
+		entry.Talk = s.talk
+	}
+	s.index.record(s.url, entry, files)
+	if err := s.index.save(); err != nil {
+		fmt.Println("保存下载记录失败：", err)
+	}
+}
+
+// processFiles 对pdf文件去除水印（尚未处理过时）和提取文字（指定Text时）
+func (s *Slide) processFiles(entry *indexEntry, files []string) []string {
+	if s.Optimize && !entry.Optimized {
+		for _, file := range files {
+			if isPDF(file) {
+				optimizeSavedPDF(file)
+			}
+		}
+		entry.Optimized = true
+		s.recordEntry(entry, files)
+	}
+	if s.Text {
+		for _, file := range files {
+			if isPDF(file) {
+				extractSavedText(file)
+			}
+		}
+	}
+	return files
+}
+
+// extractSavedZip 解压下载的zip压缩包，解压成功后删除压缩包
+func (s *Slide) extractSavedZip(fileName string) []string {
+	files, err := extractZip(fileName)
+	if err != nil {
+		fmt.Println("解压课件失败：", err)
+		return []string{fileName}
 	}
+	fmt.Printf("已从压缩包中解压 %d 个文件到：%s\n", len(files), strings.TrimSuffix(fileName, filepath.Ext(fileName)))
+	_ = os.Remove(fileName)
+	return files
 }
@@ -0,0 +1,51 @@
+package slide
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yliu7949/KouShare-dl/internal/pdf"
+)
+
+// pageSeparator 分隔txt文件中各页的文字，与pdftotext的输出相同
+const pageSeparator = "\f"
+
+// textFileName 返回保存pdf文件文字的txt文件名，如"报告.pdf"对应"报告.txt"
+func textFileName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".txt"
+}
+
+// extractText 提取pdf文件中每一页的文字，写入同名的txt文件。txt文件比pdf文件新时不再重复提取。
+func extractText(fileName string) (pages []string, err error) {
+	txtName := textFileName(fileName)
+	if txt, err := os.Stat(txtName); err == nil {
+		if info, err := os.Stat(fileName); err == nil && !txt.ModTime().Before(info.ModTime()) {
+			data, err := os.ReadFile(txtName)
+			return strings.Split(string(data), pageSeparator), err
+		}
+	}
+
+	doc, err := pdf.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	list, err := doc.Pages()
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range list {
+		pages = append(pages, strings.ReplaceAll(doc.Text(page), pageSeparator, " "))
+	}
+	return pages, os.WriteFile(txtName, []byte(strings.Join(pages, pageSeparator)), 0666)
+}
+
+// extractSavedText 提取下载的pdf课件中的文字并输出结果
+func extractSavedText(fileName string) {
+	if _, err := extractText(fileName); err != nil {
+		fmt.Println("提取课件文字失败：", err)
+		return
+	}
+	fmt.Println("已将课件文字保存为：", textFileName(fileName))
+}
@@ -0,0 +1,119 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/tidwall/gjson"
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+// errTokenRejected 表示服务器拒绝了token，需要重新登录
+var errTokenRejected = errors.New("登录凭证已失效")
+
+// Account 为服务器返回的账户信息
+type Account struct {
+	Name  string
+	Phone string
+}
+
+// revalidateOnce 保证每次运行最多向服务器重新验证一次token
+var revalidateOnce sync.Once
+
+// tokenRejected 记录重新验证的结果
+var tokenRejected bool
+
+// accountURL 返回获取当前登录账户信息的API
+func accountURL() string {
+	return config.LoginBaseURL() + "/api/api-user/getUserInfo"
+}
+
+// fetchAccount 使用token请求账户信息，token被拒绝时返回errTokenRejected
+func fetchAccount(token string) (*Account, error) {
+	statusCode, data, err := doRequest(http.MethodGet, accountURL(), nil, token)
+	if err != nil {
+		return nil, err
+	}
+	if isUnauthorized(statusCode, data) {
+		return nil, errTokenRejected
+	}
+	if statusCode != http.StatusOK || gjson.Get(data, "code").String() != "200" {
+		if msg := gjson.Get(data, "msg").String(); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, fmt.Errorf("服务器返回 %d", statusCode)
+	}
+	return &Account{
+		Name:  gjson.Get(data, "data.nickname").String(),
+		Phone: gjson.Get(data, "data.phone").String(),
+	}, nil
+}
+
+// isUnauthorized 判断响应是否表示需要登录：HTTP状态码为401，或返回的JSON中code为401
+func isUnauthorized(statusCode int, data string) bool {
+	return statusCode == http.StatusUnauthorized || gjson.Get(data, "code").String() == "401"
+}
+
+// revalidateToken 在请求被服务器以401拒绝后向服务器重新验证token，token无效时更新LoginState为-1并返回true
+func revalidateToken() bool {
+	revalidateOnce.Do(func() {
+		if _, err := fetchAccount(u.Token); errors.Is(err, errTokenRejected) {
+			tokenRejected = true
+			u.LoginState = -1
+			fmt.Println("登录凭证已失效，将以未登录状态继续。使用“ks login”重新登录。")
+		} else if err != nil {
+			fmt.Println("请求被服务器拒绝，且无法向服务器验证登录凭证：", err)
+		}
+	})
+	return tokenRejected
+}
+
+// Whoami 向服务器验证当前账户配置的token，并输出账户名称、手机号码（部分隐藏）和token的过期时间
+func Whoami() {
+	switch GetLoginState() {
+	case 0:
+		fmt.Println("未登录。使用“ks login [phone number]”登录。")
+		return
+	case -1:
+		fmt.Println("登录凭证已失效，需要重新登录。")
+		return
+	}
+	account, err := fetchAccount(u.Token)
+	if errors.Is(err, errTokenRejected) {
+		u.LoginState = -1
+		fmt.Println("登录凭证已被服务器拒绝，需要重新登录。")
+		return
+	} else if err != nil {
+		fmt.Println("无法向服务器验证登录凭证，登录状态未知：", err)
+		return
+	}
+
+	fmt.Println("登录凭证有效。")
+	fmt.Println("账户配置：", config.Profile())
+	if externalToken() != "" {
+		fmt.Println("凭证来源： --token 参数或环境变量 KOUSHARE_TOKEN")
+	} else {
+		fmt.Println("凭证来源：", tokenFileName())
+	}
+	if account.Name != "" {
+		fmt.Println("账户名称：", account.Name)
+	}
+	if account.Phone != "" {
+		fmt.Println("手机号码：", maskPhone(account.Phone))
+	}
+	if u.Expires.IsZero() {
+		fmt.Println("过期时间： 未知")
+	} else {
+		fmt.Println("过期时间：", u.Expires.Local().Format("2006-01-02 15:04:05"))
+	}
+}
+
+// maskPhone 隐藏手机号码的中间四位，如15012345678显示为150****5678
+func maskPhone(phone string) string {
+	if len(phone) != 11 {
+		return phone
+	}
+	return phone[:3] + "****" + phone[7:]
+}
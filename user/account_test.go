@@ -0,0 +1,93 @@
+package user
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+// userInfo 为账户信息接口的响应示例
+const userInfo = `{"code":200,"msg":"操作成功","data":{"uid":10086,"nickname":"alice","phone":"15012345678","avatar":""}}`
+
+func TestRevalidateToken(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie("Token")
+		loggedIn := cookie != nil && cookie.Value == "good"
+		switch r.URL.Path {
+		case "/api/api-user/getUserInfo":
+			if !loggedIn {
+				_, _ = w.Write([]byte(`{"code":401,"msg":"请登录"}`))
+				return
+			}
+			_, _ = w.Write([]byte(userInfo))
+		case "/video":
+			if cookie != nil && !loggedIn {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte(`{"code":200}`))
+		}
+	}))
+	defer srv.Close()
+	config.SetLoginBaseURL(srv.URL)
+
+	account, err := fetchAccount("good")
+	if err != nil || account.Name != "alice" || maskPhone(account.Phone) != "150****5678" {
+		t.Errorf("fetchAccount = %+v, %v", account, err)
+	}
+	if _, err = fetchAccount("bad"); err != errTokenRejected {
+		t.Errorf("fetchAccount with a bad token: %v", err)
+	}
+
+	loadOnce.Do(func() {})
+	u.Token, u.LoginState = "bad", 1
+	data, err := MyGetRequest(srv.URL + "/video")
+	if err != nil || data != `{"code":200}` {
+		t.Errorf("MyGetRequest = %q, %v", data, err)
+	}
+	if u.LoginState != -1 {
+		t.Errorf("LoginState = %d after the token was rejected, want -1", u.LoginState)
+	}
+}
+
+func TestWhoamiUnverified(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	config.SetLoginBaseURL(srv.URL)
+
+	loadOnce.Do(func() {})
+	u.Token, u.LoginState = "eyJhbGciOiJIUzI1NiJ9.eyJzdWIiOiJhbGljZSJ9.sig", 1
+	out := captureStdout(t, Whoami)
+	if !strings.Contains(out, "无法向服务器验证登录凭证") || strings.Contains(out, "登录凭证有效") || strings.Contains(out, "账户名称") {
+		t.Errorf("Whoami() printed %q", out)
+	}
+	if u.LoginState != 1 {
+		t.Errorf("LoginState = %d, an unverified token should be left as it is", u.LoginState)
+	}
+}
+
+// captureStdout 返回运行f时输出到标准输出的内容
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	f()
+	os.Stdout = stdout
+	_ = w.Close()
+	return <-done
+}
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"time"
+)
+
+// codeTimeout 为等待短信验证码的最长时间
+const codeTimeout = 5 * time.Minute
+
+// verifyCodeRegexp 匹配6位短信验证码，文件或命令的输出可以是完整的短信内容
+var verifyCodeRegexp = regexp.MustCompile(`\d{6}`)
+
+// readVerifyCode 读取短信验证码。依次检查CodeFile和CodeCmd，均未指定时从命令行读取。
+// sent为短信验证码的发送时间，CodeFile在此之前写入的内容会被视为上一次登录的验证码而忽略。
+func (u *User) readVerifyCode(sent time.Time) (string, error) {
+	var text string
+	switch {
+	case u.CodeFile != "":
+		fmt.Println("短信验证码发送成功，正在等待验证码写入文件：", u.CodeFile)
+		var err error
+		if text, err = waitCodeFile(u.CodeFile, sent, codeTimeout); err != nil {
+			return "", err
+		}
+	case u.CodeCmd != "":
+		fmt.Println("短信验证码发送成功，正在运行命令获取验证码：", u.CodeCmd)
+		var err error
+		if text, err = runCodeCmd(u.CodeCmd, u.PhoneNumber, codeTimeout); err != nil {
+			return "", err
+		}
+	default:
+		fmt.Printf("短信验证码发送成功，请输入6位验证码：")
+		if _, err := fmt.Scan(&text); err != nil {
+			return "", err
+		}
+		return text, nil
+	}
+
+	code := verifyCodeRegexp.FindString(text)
+	if code == "" {
+		return "", errors.New("未找到6位短信验证码")
+	}
+	return code, nil
+}
+
+// waitCodeFile 等待短信验证码写入文件fileName，直至文件在since之后被修改且包含6位验证码
+func waitCodeFile(fileName string, since time.Time, timeout time.Duration) (string, error) {
+	since = since.Truncate(time.Second) //部分文件系统的修改时间精确到秒
+	deadline := time.Now().Add(timeout)
+	for {
+		if info, err := os.Stat(fileName); err == nil && !info.ModTime().Before(since) {
+			if data, err := os.ReadFile(fileName); err == nil && verifyCodeRegexp.Match(data) {
+				return string(data), nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("等待 %v 后文件 %s 中仍没有新的短信验证码", timeout, fileName)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// runCodeCmd 使用系统的shell运行命令command并返回其输出。命令可以通过环境变量 KOUSHARE_PHONE 获取手机号码。
+func runCodeCmd(command, phoneNumber string, timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), "KOUSHARE_PHONE="+phoneNumber)
+	cmd.Stderr = os.Stderr
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("命令运行超过 %v", timeout)
+		}
+		return "", fmt.Errorf("命令运行失败：%w", err)
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,37 @@
+package user
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestReadVerifyCode(t *testing.T) {
+	sent := time.Now()
+	fileName := filepath.Join(t.TempDir(), "sms.txt")
+	if err := os.WriteFile(fileName, []byte("【蔻享学术】您的验证码为123456，5分钟内有效。"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	u := User{CodeFile: fileName}
+	if code, err := u.readVerifyCode(sent); err != nil || code != "123456" {
+		t.Errorf("code from file = %q, %v", code, err)
+	}
+	// 发送验证码之前写入的文件为上一次登录的验证码
+	if _, err := waitCodeFile(fileName, sent.Add(time.Minute), time.Second); err == nil {
+		t.Error("a stale code file was accepted")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	u = User{PhoneNumber: "15012345678", CodeCmd: `echo "code for $KOUSHARE_PHONE: 112233" | sed 's/15012345678/phone/'`}
+	if code, err := u.readVerifyCode(sent); err != nil || code != "112233" {
+		t.Errorf("code from cmd = %q, %v", code, err)
+	}
+	u = User{CodeCmd: "exit 3"}
+	if _, err := u.readVerifyCode(sent); err == nil {
+		t.Error("a failing command was accepted")
+	}
+}
@@ -0,0 +1,107 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/proxy"
+)
+
+// cookieDomain 为保存cookie的域名，包括其子域名
+const cookieDomain = "koushare.com"
+
+// tokenCookieName 为保存登录凭证的cookie，单独保存在token文件中
+const tokenCookieName = "Token"
+
+// cookieFileName 返回当前账户配置保存其它cookie的文件路径
+func cookieFileName() string {
+	return filepath.Join(config.ProfileDir(config.Profile()), "cookies.txt")
+}
+
+// jarOnce 保证cookie文件仅读取一次
+var jarOnce sync.Once
+
+// ensureCookieJar 读取cookie文件作为proxy.Client的cookie jar，已读取过时不做任何事。
+// 与ensureToken分开，以便登录时无需读取（可能需要口令的）token文件即可携带cookie。
+func ensureCookieJar() {
+	jarOnce.Do(loadCookieJar)
+}
+
+// loadCookieJar 读取当前账户配置的cookie文件，并将其作为proxy.Client的cookie jar
+func loadCookieJar() {
+	jar, err := proxy.NewFileJar(cookieFileName(), cookieDomain, tokenCookieName)
+	if err != nil {
+		fmt.Println("警告！读取cookie文件失败：", err)
+		return
+	}
+	proxy.Client.Jar = jar
+}
+
+// ImportCookies 从浏览器导出的Netscape格式的cookie文件中导入登录凭证。Token cookie及其过期时间保存在token文件中，
+// 其它蔻享学术的cookie保存在配置文件夹的cookies.txt中，此后的请求都会携带这些cookie。
+func (u *User) ImportCookies(fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	cookies, err := proxy.ParseCookieFile(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	var token *http.Cookie
+	var others []*http.Cookie
+	for _, c := range cookies {
+		if !proxy.MatchDomain(c.Domain, cookieDomain) {
+			continue
+		}
+		if c.Name == tokenCookieName {
+			if token == nil || c.Expires.After(token.Expires) {
+				token = c
+			}
+		} else {
+			others = append(others, c)
+		}
+	}
+	if token == nil || token.Value == "" {
+		return errors.New("文件中没有蔻享学术的Token cookie，请先在浏览器中登录蔻享学术后再导出cookie")
+	}
+	if !token.Expires.IsZero() && token.Expires.Before(time.Now()) {
+		return fmt.Errorf("文件中的Token cookie已于 %s 过期，请在浏览器中重新登录后再导出cookie", token.Expires.Format("2006-01-02 15:04:05"))
+	}
+
+	if err = saveToken(*token, u.Encrypt); err != nil {
+		return err
+	}
+	u.Token, u.LoginState, u.Expires = token.Value, 1, token.Expires
+	fmt.Println("登录凭证导入成功：", tokenFileName())
+	if !token.Expires.IsZero() {
+		fmt.Println("登录凭证有效期至：", token.Expires.Format("2006-01-02 15:04:05"))
+	}
+
+	jar, err := proxy.NewFileJar(cookieFileName(), cookieDomain, tokenCookieName)
+	if err == nil {
+		err = jar.Replace(others)
+	}
+	if err != nil {
+		fmt.Println("警告！保存cookie文件时遇到了问题：", err)
+	} else if n := jar.Len(); n > 0 {
+		fmt.Printf("已保存其它 %d 个cookie：%s\n", n, cookieFileName())
+	}
+	return nil
+}
+
+// removeCookies 删除cookie文件，文件不存在时不报错
+func removeCookies() error {
+	if err := os.Remove(cookieFileName()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package user
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/proxy"
+)
+
+func TestImportCookies(t *testing.T) {
+	dir := t.TempDir()
+	config.SetConfigDir(filepath.Join(dir, "config"))
+	fileName := filepath.Join(dir, "cookies.txt")
+	data := "# Netscape HTTP Cookie File\n" +
+		".koushare.com\tTRUE\t/\tTRUE\t2000000000\tToken\tabc\n" +
+		"www.koushare.com\tFALSE\t/\tFALSE\t2000000000\tSESSION\ts1\n"
+	if err := os.WriteFile(fileName, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var u User
+	if err := u.ImportCookies(fileName); err != nil {
+		t.Fatal(err)
+	}
+	token, expires, state, err := readToken(tokenFileName())
+	if err != nil || token != "abc" || state != 1 || !expires.Equal(time.Unix(2000000000, 0)) {
+		t.Errorf("readToken = %q, %v, %d, %v", token, expires, state, err)
+	}
+	if _, err = os.Stat(cookieFileName()); err != nil {
+		t.Error("the other cookies were not saved:", err)
+	}
+
+	if err = os.WriteFile(fileName, []byte("www.koushare.com\tFALSE\t/\tFALSE\t0\tSESSION\ts1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = u.ImportCookies(fileName); err == nil {
+		t.Error("a cookie file without Token was accepted")
+	}
+}
+
+func TestLoginUsesCookies(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":500,"msg":"发送过于频繁"}`))
+	}))
+	defer srv.Close()
+	config.SetConfigDir(t.TempDir())
+	config.SetLoginBaseURL(srv.URL)
+	if err := os.MkdirAll(filepath.Dir(cookieFileName()), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cookieFileName(), []byte("www.koushare.com\tFALSE\t/\tFALSE\t2000000000\tSESSION\ts1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	jarOnce = sync.Once{}
+	defer func() { proxy.Client.Jar = nil }()
+
+	// 登录前读取cookie文件，发送验证码和登录的请求会携带导入的cookie
+	u := User{PhoneNumber: "15012345678"}
+	if err := u.Login(); err != nil {
+		t.Fatal(err)
+	}
+	www, _ := url.Parse("https://www.koushare.com/")
+	if proxy.Client.Jar == nil || len(proxy.Client.Jar.Cookies(www)) != 1 {
+		t.Error("the cookie file was not loaded before logging in")
+	}
+}
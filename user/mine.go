@@ -0,0 +1,85 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+// minePageSize 为每次请求获取的条目数
+const minePageSize = 50
+
+// maxMinePages 限制请求的页数，避免服务器返回异常时无限请求
+const maxMinePages = 100
+
+// Item 为当前账户已购买或收藏的视频
+type Item struct {
+	Vid     string
+	Title   string
+	Expires time.Time //观看权限的过期时间，永久有效或未知时为零值
+}
+
+// Expired 判断观看权限是否已过期
+func (i Item) Expired() bool {
+	return !i.Expires.IsZero() && i.Expires.Before(time.Now())
+}
+
+// Purchased 返回当前账户已购买的视频
+func Purchased() ([]Item, error) {
+	return fetchItems(config.APIBaseURL() + "/api/api-user/getMyBuyVideo")
+}
+
+// Favorites 返回当前账户收藏的视频
+func Favorites() ([]Item, error) {
+	return fetchItems(config.APIBaseURL() + "/api/api-user/getMyCollectVideo")
+}
+
+// fetchItems 分页请求URL，直至获取全部条目
+func fetchItems(URL string) ([]Item, error) {
+	if GetLoginState() != 1 {
+		return nil, errors.New("需要先登录（ks login）")
+	}
+	var items []Item
+	for page := 1; page <= maxMinePages; page++ {
+		data, err := MyGetRequest(fmt.Sprintf("%s?page=%d&size=%d", URL, page, minePageSize))
+		if err != nil {
+			return nil, err
+		}
+		if GetLoginState() != 1 {
+			return nil, errors.New("登录凭证已失效，需要重新登录（ks login）")
+		}
+		if code := gjson.Get(data, "code").String(); code != "200" {
+			if msg := gjson.Get(data, "msg").String(); msg != "" {
+				return nil, errors.New(msg)
+			}
+			return nil, fmt.Errorf("服务器返回 %s", code)
+		}
+		list := gjson.Get(data, "data.list").Array()
+		for _, e := range list {
+			if item, ok := parseItem(e); ok {
+				items = append(items, item)
+			}
+		}
+		total := gjson.Get(data, "data.total").Int()
+		if len(list) < minePageSize || (total > 0 && int64(page*minePageSize) >= total) {
+			break
+		}
+	}
+	return items, nil
+}
+
+// parseItem 解析data.list中的一个条目，vid为空时返回false
+func parseItem(e gjson.Result) (Item, bool) {
+	item := Item{Vid: e.Get("vid").String(), Title: e.Get("vtitle").String()}
+	if item.Vid == "" {
+		return item, false
+	}
+	if s := strings.TrimSpace(e.Get("expireTime").String()); s != "" { //永久有效时为空
+		item.Expires, _ = time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+	}
+	return item, true
+}
@@ -0,0 +1,59 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+// purchasedPage 为已购买视频接口一页响应的示例，依次填入total、page和data.list中的条目
+const purchasedPage = `{"code":200,"msg":"操作成功","data":{"total":%d,"page":%s,"size":50,"list":[%s]}}`
+
+func TestPurchased(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/api-user/getMyBuyVideo" {
+			http.NotFound(w, r)
+			return
+		}
+		var list []string
+		page := r.URL.Query().Get("page")
+		if page == "1" {
+			for i := 0; i < minePageSize; i++ {
+				list = append(list, fmt.Sprintf(`{"vid":%d,"vtitle":"视频%d","price":"9.90","expireTime":"2030-01-02 03:04:05"}`, i, i))
+			}
+		} else {
+			list = append(list,
+				`{"vid":100,"vtitle":"视频100","price":"9.90","expireTime":"2023-11-14 22:13:20"}`,
+				`{"vid":101,"vtitle":"视频101","price":"0.00","expireTime":""}`,
+				`{"vtitle":"没有vid"}`)
+		}
+		_, _ = fmt.Fprintf(w, purchasedPage, minePageSize+3, page, strings.Join(list, ","))
+	}))
+	defer srv.Close()
+	config.SetAPIBaseURL(srv.URL)
+
+	loadOnce.Do(func() {})
+	u.Token, u.LoginState = "good", 1
+	items, err := Purchased()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != minePageSize+2 {
+		t.Fatalf("got %d items, want %d", len(items), minePageSize+2)
+	}
+	if item := items[0]; item.Vid != "0" || item.Title != "视频0" || item.Expired() ||
+		!item.Expires.Equal(time.Date(2030, 1, 2, 3, 4, 5, 0, time.Local)) {
+		t.Errorf("items[0] = %+v", item)
+	}
+	if item := items[minePageSize]; item.Vid != "100" || !item.Expired() {
+		t.Errorf("expired item = %+v", item)
+	}
+	if item := items[minePageSize+1]; item.Vid != "101" || !item.Expires.IsZero() || item.Expired() {
+		t.Errorf("item without expiry = %+v", item)
+	}
+}
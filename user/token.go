@@ -0,0 +1,245 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/prompt"
+	"github.com/yliu7949/KouShare-dl/internal/secret"
+)
+
+// loadOnce 保证token文件仅在第一次需要登录状态时读取，此时命令行参数（如 --config-dir）已经生效
+var loadOnce sync.Once
+
+// ensureToken 读取token文件和cookie文件，已读取过时不做任何事
+func ensureToken() {
+	loadOnce.Do(func() {
+		u.LoadToken()
+		ensureCookieJar()
+	})
+}
+
+// tokenOverride 为通过 --token 参数指定的token
+var tokenOverride string
+
+// SetToken 指定token，优先于环境变量 KOUSHARE_TOKEN 和token文件，value为空时不做修改。value可以带有“Token=”前缀。
+func SetToken(value string) {
+	if v := strings.TrimPrefix(strings.TrimSpace(value), "Token="); v != "" {
+		tokenOverride = v
+	}
+}
+
+// externalToken 返回通过 --token 参数或环境变量 KOUSHARE_TOKEN 指定的token，均未指定时返回空字符串
+func externalToken() string {
+	if tokenOverride != "" {
+		return tokenOverride
+	}
+	return strings.TrimPrefix(strings.TrimSpace(os.Getenv("KOUSHARE_TOKEN")), "Token=")
+}
+
+// tokenFileName 返回当前账户配置的token文件的路径
+func tokenFileName() string {
+	return profileTokenFileName(config.Profile())
+}
+
+// profileTokenFileName 返回账户配置profile的token文件的路径
+func profileTokenFileName(profile string) string {
+	return filepath.Join(config.ProfileDir(profile), "token")
+}
+
+// readToken 读取token文件，返回token、保存时记录的过期时间和登录状态（含义与LoginState相同）。
+// 过期时间仅供参考，token是否有效以服务器的验证结果为准。token文件已加密时使用口令或密钥文件解密。
+func readToken(fileName string) (token string, expires time.Time, state int, err error) {
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", time.Time{}, 0, nil
+	} else if err != nil {
+		return "", time.Time{}, 0, err
+	}
+	if secret.IsSealed(data) {
+		if data, err = secret.Open(data, tokenKeys()); err != nil {
+			return "", time.Time{}, 0, fmt.Errorf("无法解密token文件：%w", err)
+		}
+	}
+	return parseToken(data)
+}
+
+// parseToken 解析token文件的内容，格式为“token 过期时间”
+func parseToken(data []byte) (token string, expires time.Time, state int, err error) {
+	text := strings.Split(strings.TrimSpace(string(data)), " ")
+	if len(text) != 2 || text[0] == "" {
+		return "", time.Time{}, -1, errors.New("token文件已损坏，需要重新登录")
+	}
+	if t, _ := strconv.ParseInt(text[1], 10, 64); t > 0 {
+		expires = time.Unix(t, 0)
+	}
+	return text[0], expires, 1, nil
+}
+
+// keyFileOverride 为通过 --key-file 参数指定的密钥文件
+var keyFileOverride string
+
+// SetKeyFile 指定加密token文件的密钥文件，优先于环境变量 KOUSHARE_KEY_FILE，value为空时不做修改
+func SetKeyFile(value string) {
+	if v := strings.TrimSpace(value); v != "" {
+		keyFileOverride = v
+	}
+}
+
+// tokenKeyFile 返回通过 --key-file 参数或环境变量 KOUSHARE_KEY_FILE 指定的密钥文件，均未指定时返回空字符串
+func tokenKeyFile() string {
+	if keyFileOverride != "" {
+		return keyFileOverride
+	}
+	return strings.TrimSpace(os.Getenv("KOUSHARE_KEY_FILE"))
+}
+
+// tokenKeys 返回解密token文件时使用的密钥文件和口令。口令优先从环境变量 KOUSHARE_PASSPHRASE 读取，否则提示用户输入。
+func tokenKeys() secret.Keys {
+	return secret.Keys{
+		KeyFile: tokenKeyFile(),
+		Passphrase: func() (string, error) {
+			if v, ok := os.LookupEnv("KOUSHARE_PASSPHRASE"); ok {
+				return v, nil
+			}
+			passphrase, err := prompt.Password("请输入登录凭证的口令：")
+			if errors.Is(err, prompt.ErrNotTerminal) {
+				return "", errors.New("token文件已加密，请设置环境变量 KOUSHARE_PASSPHRASE 或在终端中运行")
+			}
+			return passphrase, err
+		},
+	}
+}
+
+// newTokenPassphrase 返回加密token文件时使用的口令，优先从环境变量 KOUSHARE_PASSPHRASE 读取，否则提示用户输入两次
+func newTokenPassphrase() (string, error) {
+	if v := os.Getenv("KOUSHARE_PASSPHRASE"); v != "" {
+		return v, nil
+	}
+	passphrase, err := prompt.NewPassword("请设置登录凭证的口令：")
+	if errors.Is(err, prompt.ErrNotTerminal) {
+		return "", errors.New("加密token文件需要口令，请设置环境变量 KOUSHARE_PASSPHRASE 或在终端中运行")
+	}
+	return passphrase, err
+}
+
+// isTokenSealed 判断当前的token文件是否已加密
+func isTokenSealed() bool {
+	data, err := os.ReadFile(tokenFileName())
+	return err == nil && secret.IsSealed(data)
+}
+
+// legacyTokenFileNames 返回旧版本在可执行文件所在路径下保存的token文件
+func legacyTokenFileNames() []string {
+	binaryFilePath, err := os.Executable()
+	if err != nil {
+		return nil
+	}
+	dir := filepath.Dir(binaryFilePath)
+	if runtime.GOOS == "windows" {
+		return []string{filepath.Join(dir, "ks.token")}
+	}
+	return []string{filepath.Join(dir, ".ks.token"), filepath.Join(dir, "ks.token")}
+}
+
+// migrateToken 将旧版本的token文件移动到配置文件夹中，作为默认账户配置的token文件。已有token文件时不做处理。
+func migrateToken() {
+	if config.Profile() != config.DefaultProfile {
+		return
+	}
+	if _, err := os.Stat(tokenFileName()); err == nil {
+		return
+	}
+	for _, legacy := range legacyTokenFileNames() {
+		data, err := os.ReadFile(legacy)
+		if err != nil {
+			continue
+		}
+		if err = writeTokenFile(data); err != nil {
+			fmt.Println("警告！迁移token文件时遇到了问题：", err)
+			return
+		}
+		_ = os.Remove(legacy) //可执行文件所在路径只读时无法删除，不影响使用
+		fmt.Println("已将登录凭证迁移至：", tokenFileName())
+		return
+	}
+}
+
+// writeTokenFile 写入token文件。配置文件夹的权限为0700，token文件的权限为0600，仅当前用户可以读取。
+func writeTokenFile(data []byte) error {
+	fileName := tokenFileName()
+	if err := os.MkdirAll(filepath.Dir(fileName), 0700); err != nil {
+		return err
+	}
+	tmpName := fileName + ".tmp"
+	if err := os.WriteFile(tmpName, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpName, 0600); err != nil { //文件已存在时WriteFile不会修改其权限
+		return err
+	}
+	return os.Rename(tmpName, fileName)
+}
+
+// saveToken 保存token及其过期时间。指定了密钥文件时使用密钥文件加密；encrypt为true或原token文件已加密时使用口令加密。
+func saveToken(cookie http.Cookie, encrypt bool) error {
+	data := []byte(fmt.Sprintf("%s %d", cookie.Value, cookie.Expires.Unix()))
+	var err error
+	if keyFile := tokenKeyFile(); keyFile != "" {
+		data, err = secret.SealWithKeyFile(data, keyFile)
+	} else if encrypt || isTokenSealed() {
+		var passphrase string
+		if passphrase, err = newTokenPassphrase(); err == nil {
+			data, err = secret.SealWithPassphrase(data, passphrase)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return writeTokenFile(data)
+}
+
+// removeToken 删除token文件，文件不存在时不报错
+func removeToken() error {
+	if err := os.Remove(tokenFileName()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Profile 为一个账户配置及其登录状态
+type Profile struct {
+	Name       string
+	LoginState int       //含义与User.LoginState相同
+	Expires    time.Time //token文件中记录的过期时间，未知或token文件已加密时为零值
+	Encrypted  bool      //token文件是否已加密
+	Current    bool
+}
+
+// Profiles 返回所有账户配置，默认账户配置排在最前
+func Profiles() []Profile {
+	migrateToken()
+	names := append([]string{config.DefaultProfile}, config.ProfileNames()...)
+	profiles := make([]Profile, len(names))
+	for i, name := range names {
+		p := Profile{Name: name, Current: name == config.Profile()}
+		if data, err := os.ReadFile(profileTokenFileName(name)); err == nil {
+			if secret.IsSealed(data) { //不解密，以免需要输入多个账户配置的口令
+				p.LoginState, p.Encrypted = 1, true
+			} else {
+				_, p.Expires, p.LoginState, _ = parseToken(data)
+			}
+		}
+		profiles[i] = p
+	}
+	return profiles
+}
@@ -0,0 +1,99 @@
+package user
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+)
+
+func TestMigrateToken(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "koushare-dl")
+	config.SetConfigDir(dir)
+	legacy := legacyTokenFileNames()[0] //测试程序所在的临时文件夹
+	if err := os.WriteFile(legacy, []byte("abc 1700000000"), 0644); err != nil {
+		t.Skip("cannot write next to the test binary:", err)
+	}
+	defer os.Remove(legacy)
+
+	migrateToken()
+	data, err := os.ReadFile(tokenFileName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc 1700000000" {
+		t.Errorf("migrated token = %q", data)
+	}
+	if _, err = os.Stat(legacy); err == nil {
+		t.Error("the legacy token file was not removed")
+	}
+	if runtime.GOOS != "windows" {
+		if info, _ := os.Stat(dir); info.Mode().Perm() != 0700 {
+			t.Errorf("config dir mode = %v, want 0700", info.Mode().Perm())
+		}
+		if info, _ := os.Stat(tokenFileName()); info.Mode().Perm() != 0600 {
+			t.Errorf("token file mode = %v, want 0600", info.Mode().Perm())
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	dir := t.TempDir()
+	config.SetConfigDir(dir)
+	defer func() { _ = config.SetProfile(config.DefaultProfile) }()
+
+	if err := config.SetProfile("../alice"); err == nil {
+		t.Error("an invalid profile name was accepted")
+	}
+	if err := config.SetProfile("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeTokenFile([]byte(fmt.Sprintf("abc %d", time.Now().Unix()))); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "profiles", "alice", "token"); tokenFileName() != want {
+		t.Errorf("token file = %s, want %s", tokenFileName(), want)
+	}
+
+	profiles := Profiles()
+	if len(profiles) != 2 {
+		t.Fatalf("got %d profiles, want 2", len(profiles))
+	}
+	if p := profiles[0]; p.Name != config.DefaultProfile || p.LoginState != 0 || p.Current {
+		t.Errorf("default profile = %+v", p)
+	}
+	if p := profiles[1]; p.Name != "alice" || p.LoginState != 1 || !p.Current {
+		t.Errorf("alice profile = %+v", p)
+	}
+}
+
+func TestEncryptedToken(t *testing.T) {
+	config.SetConfigDir(t.TempDir())
+	t.Setenv("KOUSHARE_PASSPHRASE", "secret")
+	expires := time.Unix(2000000000, 0)
+	if err := saveToken(http.Cookie{Value: "abc", Expires: expires}, true); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(tokenFileName())
+	if strings.Contains(string(data), "abc") {
+		t.Error("the token file contains the plain token")
+	}
+	token, got, state, err := readToken(tokenFileName())
+	if err != nil || token != "abc" || state != 1 || !got.Equal(expires) {
+		t.Errorf("readToken = %q, %v, %d, %v", token, got, state, err)
+	}
+
+	t.Setenv("KOUSHARE_PASSPHRASE", "wrong")
+	if _, _, _, err = readToken(tokenFileName()); err == nil {
+		t.Error("readToken with a wrong passphrase succeeded")
+	}
+	if p := Profiles()[0]; !p.Encrypted || p.LoginState != 1 {
+		t.Errorf("profile = %+v", p)
+	}
+}
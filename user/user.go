@@ -7,9 +7,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -23,52 +20,36 @@ import (
 // User 用户，包含手机号码、依据token文件判断的登录状态和token的值
 type User struct {
 	PhoneNumber string
-	LoginState  int //无token文件则为0；token过期则为-1；token有效则为1
+	LoginState  int //无token文件则为0；token文件损坏或token被服务器拒绝则为-1；否则为1
 	Token       string
+	Expires     time.Time //token的过期时间，未知时为零值
+	CodeFile    string    //从该文件读取短信验证码，用于无人值守登录
+	CodeCmd     string    //运行该命令并从其输出中读取短信验证码
+	Encrypt     bool      //是否使用口令加密保存token文件
 }
 
-var tokenFileName string
 var u User
 
-func init() {
-	binaryFilePath, _ := os.Executable()
-	ksFilePath := filepath.Dir(binaryFilePath) + string(os.PathSeparator)
-	if runtime.GOOS == "windows" {
-		tokenFileName = ksFilePath + "ks.token"
-	} else {
-		tokenFileName = ksFilePath + ".ks.token"
-	}
-	u.LoadToken()
-}
-
-// LoadToken 检查token文件并更新LoginState和Token
+// LoadToken 读取当前账户配置的token文件并更新LoginState、Token和Expires；通过 --token 参数或环境变量 KOUSHARE_TOKEN 指定token时不读取token文件。
+// 此时不向服务器验证token，请求被服务器以401拒绝时才会重新验证。旧版本保存在可执行文件所在路径下的token文件会被迁移至配置文件夹中。
 func (u *User) LoadToken() {
-	// 判断token文件是否存在
-	if _, err := os.Stat(tokenFileName); err == nil {
-		f, err := os.ReadFile(tokenFileName)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		text := strings.Split(string(f), " ")
-
-		// 若token过期，则需要重新登录获取token
-		if t, _ := strconv.Atoi(text[1]); time.Now().Unix()-int64(t) > 604800 {
-			u.LoginState = -1
-			fmt.Printf("凭证过期，需要重新登录。\n\n")
-		} else {
-			u.LoginState = 1
-			u.Token = text[0]
-			fmt.Printf("登录凭证有效。\n\n")
-		}
-	} else {
-		u.LoginState = 0
+	if token := externalToken(); token != "" {
+		u.Token, u.LoginState, u.Expires = token, 1, time.Time{} //无法得知过期时间
+		return
+	}
+	migrateToken()
+	token, expires, state, err := readToken(tokenFileName())
+	u.Token, u.LoginState, u.Expires = token, state, expires
+	if err != nil {
+		fmt.Printf("读取token文件失败：%v\n\n", err)
 	}
 }
 
-// Login 使用短信验证码的方式登录“蔻享学术”平台，登录成功后获得token，并将token保存在可执行文件所在路径下的token文件中
+// Login 使用短信验证码的方式登录“蔻享学术”平台，登录成功后获得token，并将token保存在配置文件夹中的token文件中
 func (u *User) Login() error {
+	ensureCookieJar() //发送验证码和登录的请求同样携带已导入的cookie
 	URL := config.LoginBaseURL() + "/api/api-user/"
+	sent := time.Now()
 	res1, err := proxy.Client.PostForm(URL+"sendSms", url.Values{"phone": {u.PhoneNumber}, "scope": {"LOGIN"}})
 	if err != nil {
 		return err
@@ -79,9 +60,7 @@ func (u *User) Login() error {
 		return err
 	}
 	if res1.StatusCode == 200 && gjson.Get(string(body), "code").String() == "200" {
-		fmt.Printf("短信验证码发送成功，请输入6位验证码：")
-		var verifyCode string
-		_, err = fmt.Scan(&verifyCode)
+		verifyCode, err := u.readVerifyCode(sent)
 		if err != nil {
 			return err
 		}
@@ -101,10 +80,10 @@ func (u *User) Login() error {
 				cookie := *(res2.Cookies()[0])
 				u.Token = cookie.Value
 				u.LoginState = 1
-				if err = saveToken(cookie); err != nil {
+				if err = saveToken(cookie, u.Encrypt); err != nil {
 					fmt.Println("警告！保存token文件时遇到了问题：", err)
 				} else {
-					fmt.Println("token文件保存成功。")
+					fmt.Println("token文件保存成功：", tokenFileName())
 				}
 			}
 		}
@@ -114,47 +93,29 @@ func (u *User) Login() error {
 	return nil
 }
 
-// Logout 删除token文件，并更新LoginState为0
+// Logout 删除token文件和cookie文件，并更新LoginState为0
 func (u *User) Logout() {
-	if _, err := os.Stat(tokenFileName); err == nil {
-		_ = os.Remove(tokenFileName)
+	migrateToken() //同时删除旧版本的token文件
+	if err := removeToken(); err != nil {
+		fmt.Println("删除登录凭证失败：", err)
+		return
+	}
+	if err := removeCookies(); err != nil {
+		fmt.Println("删除cookie文件失败：", err)
 	}
 	u.LoginState = 0
 	fmt.Println("已删除登录凭证")
+	if externalToken() != "" {
+		fmt.Println("注意：通过 --token 参数或环境变量 KOUSHARE_TOKEN 指定的登录凭证未保存在本地，仍然有效")
+	}
 }
 
-// GetLoginState 返回LoginState的值；有效登录则为1，否则为0或-1
+// GetLoginState 返回LoginState的值；有token且未被服务器拒绝则为1，否则为0或-1
 func GetLoginState() int {
+	ensureToken()
 	return u.LoginState
 }
 
-func saveToken(cookie http.Cookie) error {
-	// 若token文件存在，则删除该文件
-	if _, err := os.Stat(tokenFileName); err == nil {
-		err = os.Remove(tokenFileName)
-		if err != nil {
-			return err
-		}
-	}
-
-	f, err := os.OpenFile(tokenFileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
-	}
-	if _, err = f.WriteString(fmt.Sprintf("%s %d", cookie.Value, cookie.Expires.Unix())); err != nil {
-		_ = f.Close()
-		return err
-	}
-	if err = f.Close(); err != nil {
-		return err
-	}
-	// 设置“ks.token”文件为隐藏文件
-	if err = hideFile(tokenFileName); err != nil {
-		return err
-	}
-	return nil
-}
-
 // MyGetRequest 这是一个自定义的Get请求，约定：可变参数headers仅允许传入一个设置header的map。
 func MyGetRequest(url string, headers ...map[string]string) (string, error) {
 	return MyRequest(http.MethodGet, url, nil, headers...)
@@ -164,7 +125,25 @@ func MyGetRequest(url string, headers ...map[string]string) (string, error) {
 // signed API (api-core.koushare.com) by adding Ks-Sign / Ks-Timestamp headers.
 //
 // Note: body should be the raw request body bytes (e.g. JSON "{}"), not URL-encoded params.
+//
+// 请求携带的token被服务器以401拒绝时，会向服务器重新验证token；token确实无效时更新LoginState为-1，并以未登录状态重新请求。
 func MyRequest(method string, urlStr string, body []byte, headers ...map[string]string) (string, error) {
+	var token string
+	if GetLoginState() == 1 { //如果token有效，则添加cookie请求头
+		token = u.Token
+	}
+	statusCode, data, err := doRequest(method, urlStr, body, token, headers...)
+	if err != nil {
+		return "", err
+	}
+	if token != "" && isUnauthorized(statusCode, data) && revalidateToken() {
+		_, data, err = doRequest(method, urlStr, body, "", headers...)
+	}
+	return data, err
+}
+
+// doRequest 发送请求并返回状态码和响应内容，token不为空时添加cookie请求头
+func doRequest(method string, urlStr string, body []byte, token string, headers ...map[string]string) (int, string, error) {
 	var bodyReader io.Reader
 	if len(body) != 0 {
 		bodyReader = bytes.NewReader(body)
@@ -172,7 +151,7 @@ func MyRequest(method string, urlStr string, body []byte, headers ...map[string]
 
 	req, err := http.NewRequest(method, urlStr, bodyReader)
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
 
 	req.Header.Set("Accept", "application/json, text/plain, */*")
@@ -182,8 +161,8 @@ func MyRequest(method string, urlStr string, body []byte, headers ...map[string]
 	req.Header.Set("Origin", config.WebBaseURL())
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
 
-	if u.LoginState == 1 { //如果token有效，则添加cookie请求头
-		req.Header.Set("Cookie", "Token="+u.Token)
+	if token != "" {
+		req.Header.Set("Cookie", "Token="+token)
 	}
 	if len(headers) != 0 {
 		for key, value := range headers[0] {
@@ -209,7 +188,7 @@ func MyRequest(method string, urlStr string, body []byte, headers ...map[string]
 
 	resp, err := proxy.Client.Do(req)
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
@@ -217,9 +196,9 @@ func MyRequest(method string, urlStr string, body []byte, headers ...map[string]
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return 0, "", err
 	}
-	return string(data), nil
+	return resp.StatusCode, string(data), nil
 }
 
 func parseJSONBodyParams(body []byte) map[string]string {
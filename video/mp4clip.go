@@ -0,0 +1,753 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+	"github.com/yliu7949/KouShare-dl/internal/proxy"
+	"github.com/yliu7949/KouShare-dl/internal/timecode"
+)
+
+// mp4MergeGap 两段需要下载的数据间隔小于该值时合并为一次请求，间隔中的数据一并写入新文件
+const mp4MergeGap = 64 << 10
+
+// rangeSource 提供按字节范围读取视频文件的能力
+type rangeSource interface {
+	readRange(off, n int64) (io.ReadCloser, error)
+}
+
+// httpSource 通过Range请求读取远程视频文件
+type httpSource struct {
+	url     string
+	referer string
+}
+
+func (s httpSource) readRange(off, n int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "*/*")
+	req.Header.Set("Accept-Language", "zh-CN")
+	req.Header.Set("Connection", "Keep-Alive")
+	req.Header.Set("Range", "bytes="+strconv.FormatInt(off, 10)+"-"+strconv.FormatInt(off+n-1, 10))
+	req.Header.Set("Referer", s.referer)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
+	resp, err := proxy.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("服务器不支持分段下载（%s）", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// bytesSource 从内存中读取视频文件
+type bytesSource []byte
+
+func (s bytesSource) readRange(off, n int64) (io.ReadCloser, error) {
+	if off < 0 || n < 0 || off+n > int64(len(s)) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return io.NopCloser(bytes.NewReader(s[off : off+n])), nil
+}
+
+func readFullRange(src rangeSource, off, n int64) ([]byte, error) {
+	r, err := src.readRange(off, n)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// mp4Box 表示MP4文件中的一个box。容器box的内容解析到children中，其余box保存原始内容。
+type mp4Box struct {
+	typ      string
+	data     []byte
+	children []*mp4Box
+}
+
+var mp4Containers = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true}
+
+func parseMP4Boxes(b []byte) ([]*mp4Box, error) {
+	var boxes []*mp4Box
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, errors.New("box 不完整")
+		}
+		size, hdr := uint64(binary.BigEndian.Uint32(b)), uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(b))
+		case 1:
+			if len(b) < 16 {
+				return nil, errors.New("box 不完整")
+			}
+			size, hdr = binary.BigEndian.Uint64(b[8:]), 16
+		}
+		if size < hdr || size > uint64(len(b)) {
+			return nil, fmt.Errorf("%q box 的长度无效", b[4:8])
+		}
+		box := &mp4Box{typ: string(b[4:8])}
+		if mp4Containers[box.typ] {
+			children, err := parseMP4Boxes(b[hdr:size])
+			if err != nil {
+				return nil, err
+			}
+			box.children = children
+		} else {
+			box.data = b[hdr:size]
+		}
+		boxes = append(boxes, box)
+		b = b[size:]
+	}
+	return boxes, nil
+}
+
+func (b *mp4Box) child(typ string) *mp4Box {
+	for _, c := range b.children {
+		if c.typ == typ {
+			return c
+		}
+	}
+	return nil
+}
+
+func (b *mp4Box) bytes() []byte {
+	payload := b.data
+	if b.children != nil {
+		var buf bytes.Buffer
+		for _, c := range b.children {
+			buf.Write(c.bytes())
+		}
+		payload = buf.Bytes()
+	}
+	out := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(out, uint32(8+len(payload)))
+	copy(out[4:], b.typ)
+	return append(out, payload...)
+}
+
+// mp4Reader 按大端序读取box的内容，数据不足时记录错误并返回0
+type mp4Reader struct {
+	b       []byte
+	version byte // full box的版本号
+	err     error
+}
+
+func (r *mp4Reader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *mp4Reader) u32() uint32 { return binary.BigEndian.Uint32(r.next(4)) }
+func (r *mp4Reader) u64() uint64 { return binary.BigEndian.Uint64(r.next(8)) }
+
+// mp4Sample 表示轨道中的一个采样（一帧视频或一段音频）
+type mp4Sample struct {
+	offset int64
+	size   uint32
+	time   uint64 // 解码时间，单位为轨道的timescale
+	delta  uint32 // 采样时长
+	cts    uint32 // 合成时间偏移（ctts）
+	desc   uint32 // 采样描述序号（stsc）
+	chunk  int    // 所在的chunk序号
+	sync   bool   // 是否为关键帧
+}
+
+type mp4Track struct {
+	trak      *mp4Box
+	timescale uint32
+	samples   []mp4Sample
+	hasStss   bool
+	hasCtts   bool
+	cttsVer   byte
+}
+
+func (t *mp4Track) at(ts uint64) time.Duration {
+	return time.Duration(float64(ts) / float64(t.timescale) * float64(time.Second))
+}
+
+func parseMP4Track(trak *mp4Box) (*mp4Track, error) {
+	mdia := trak.child("mdia")
+	if mdia == nil || mdia.child("mdhd") == nil || mdia.child("minf") == nil || mdia.child("minf").child("stbl") == nil {
+		return nil, errors.New("轨道信息不完整")
+	}
+	t := &mp4Track{trak: trak}
+	mdhd := &mp4Reader{b: mdia.child("mdhd").data}
+	if version := mdhd.next(4)[0]; version == 1 {
+		mdhd.next(16)
+	} else {
+		mdhd.next(8)
+	}
+	if t.timescale = mdhd.u32(); mdhd.err != nil || t.timescale == 0 {
+		return nil, errors.New("mdhd box 无效")
+	}
+
+	stbl := mdia.child("minf").child("stbl")
+	var readers []*mp4Reader
+	box := func(typ string) *mp4Reader {
+		if b := stbl.child(typ); b != nil {
+			r := &mp4Reader{b: b.data}
+			r.version = r.next(4)[0]
+			readers = append(readers, r)
+			return r
+		}
+		return nil
+	}
+
+	stsz := box("stsz")
+	if stsz == nil {
+		return nil, errors.New("缺少 stsz box")
+	}
+	sampleSize, count := stsz.u32(), stsz.u32()
+	if (sampleSize == 0 && uint64(count)*4 > uint64(len(stsz.b))) || count > 1<<26 {
+		return nil, errors.New("stsz box 无效")
+	}
+	t.samples = make([]mp4Sample, count)
+	for i := range t.samples {
+		t.samples[i].size = sampleSize
+		if sampleSize == 0 {
+			t.samples[i].size = stsz.u32()
+		}
+		t.samples[i].sync = true
+	}
+
+	stts := box("stts")
+	if stts == nil {
+		return nil, errors.New("缺少 stts box")
+	}
+	var i int
+	var ts uint64
+	for n := stts.u32(); n > 0 && stts.err == nil; n-- {
+		runs, delta := stts.u32(), stts.u32()
+		for ; runs > 0 && i < len(t.samples); runs-- {
+			t.samples[i].time, t.samples[i].delta = ts, delta
+			ts += uint64(delta)
+			i++
+		}
+	}
+
+	if ctts := box("ctts"); ctts != nil {
+		t.hasCtts, t.cttsVer = true, ctts.version
+		i = 0
+		for n := ctts.u32(); n > 0 && ctts.err == nil; n-- {
+			runs, off := ctts.u32(), ctts.u32()
+			for ; runs > 0 && i < len(t.samples); runs-- {
+				t.samples[i].cts = off
+				i++
+			}
+		}
+	}
+
+	if stss := box("stss"); stss != nil {
+		t.hasStss = true
+		for i := range t.samples {
+			t.samples[i].sync = false
+		}
+		for n := stss.u32(); n > 0 && stss.err == nil; n-- {
+			if k := int(stss.u32()); k >= 1 && k <= len(t.samples) {
+				t.samples[k-1].sync = true
+			}
+		}
+	}
+
+	var offsets []int64
+	if stco := box("stco"); stco != nil {
+		for n := stco.u32(); n > 0 && stco.err == nil; n-- {
+			offsets = append(offsets, int64(stco.u32()))
+		}
+	} else if co64 := box("co64"); co64 != nil {
+		for n := co64.u32(); n > 0 && co64.err == nil; n-- {
+			offsets = append(offsets, int64(co64.u64()))
+		}
+	} else {
+		return nil, errors.New("缺少 stco box")
+	}
+
+	stsc := box("stsc")
+	if stsc == nil {
+		return nil, errors.New("缺少 stsc box")
+	}
+	type stscEntry struct{ first, perChunk, desc uint32 }
+	var entries []stscEntry
+	for n := stsc.u32(); n > 0 && stsc.err == nil; n-- {
+		entries = append(entries, stscEntry{stsc.u32(), stsc.u32(), stsc.u32()})
+	}
+	i = 0
+	for e, entry := range entries {
+		last := uint32(len(offsets))
+		if e+1 < len(entries) {
+			last = entries[e+1].first - 1
+		}
+		for chunk := entry.first; chunk >= 1 && chunk <= last && int(chunk) <= len(offsets); chunk++ {
+			off := offsets[chunk-1]
+			for k := uint32(0); k < entry.perChunk && i < len(t.samples); k++ {
+				t.samples[i].offset, t.samples[i].desc, t.samples[i].chunk = off, entry.desc, int(chunk)
+				off += int64(t.samples[i].size)
+				i++
+			}
+		}
+	}
+
+	for _, r := range readers {
+		if r.err != nil {
+			return nil, errors.New("采样表不完整")
+		}
+	}
+	if i != len(t.samples) {
+		return nil, errors.New("采样表与chunk表不一致")
+	}
+	return t, nil
+}
+
+// mp4Clip 描述截取后的MP4文件
+type mp4Clip struct {
+	ftyp      []byte
+	moov      []byte
+	intervals [][2]int64 // 需要从原文件复制到新mdat中的字节范围
+	dataSize  int64
+}
+
+// size 返回截取后文件的大小
+func (c *mp4Clip) size() int64 {
+	return int64(len(c.ftyp)+len(c.moov)) + mdatHeaderSize(c.dataSize) + c.dataSize
+}
+
+func mdatHeaderSize(dataSize int64) int64 {
+	if dataSize+8 > math.MaxUint32 {
+		return 16
+	}
+	return 8
+}
+
+// readMP4Header 读取文件顶层的ftyp和moov box。moov可能位于文件末尾，因此逐个读取顶层box的头部。
+func readMP4Header(src rangeSource, size int64) (ftyp []byte, moov *mp4Box, err error) {
+	for off := int64(0); off+8 <= size; {
+		n := int64(16)
+		if off+n > size {
+			n = size - off
+		}
+		hdr, err := readFullRange(src, off, n)
+		if err != nil {
+			return nil, nil, err
+		}
+		boxSize, typ := int64(binary.BigEndian.Uint32(hdr)), string(hdr[4:8])
+		switch {
+		case boxSize == 0:
+			boxSize = size - off
+		case boxSize == 1 && len(hdr) == 16:
+			boxSize = int64(binary.BigEndian.Uint64(hdr[8:]))
+		}
+		if boxSize < 8 || off+boxSize > size {
+			return nil, nil, fmt.Errorf("%q box 的长度无效", typ)
+		}
+		switch typ {
+		case "ftyp", "moov":
+			if boxSize > 256<<20 {
+				return nil, nil, fmt.Errorf("%s box 过大", typ)
+			}
+			b, err := readFullRange(src, off, boxSize)
+			if err != nil {
+				return nil, nil, err
+			}
+			if typ == "ftyp" {
+				ftyp = b
+				break
+			}
+			boxes, err := parseMP4Boxes(b)
+			if err != nil {
+				return nil, nil, err
+			}
+			moov = boxes[0]
+		case "moof":
+			return nil, nil, errors.New("不支持截取分片MP4文件")
+		}
+		off += boxSize
+	}
+	if moov == nil {
+		return nil, nil, errors.New("未找到 moov box")
+	}
+	return ftyp, moov, nil
+}
+
+// planMP4Clip 根据moov中的采样表计算截取[from, to)所需的数据，并生成新文件的moov。
+// 视频从不晚于from的最近一个关键帧开始截取，以保证截取结果可以正常播放；to为0表示截取至结尾。
+func planMP4Clip(ftyp []byte, moov *mp4Box, from, to time.Duration) (*mp4Clip, time.Duration, error) {
+	var tracks []*mp4Track
+	for _, c := range moov.children {
+		if c.typ != "trak" {
+			continue
+		}
+		t, err := parseMP4Track(c)
+		if err != nil {
+			return nil, 0, err
+		}
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 {
+		return nil, 0, errors.New("视频中没有轨道")
+	}
+	if moov.child("mvex") != nil {
+		return nil, 0, errors.New("不支持截取分片MP4文件")
+	}
+
+	var duration time.Duration
+	for _, t := range tracks {
+		if n := len(t.samples); n != 0 && t.at(t.samples[n-1].time+uint64(t.samples[n-1].delta)) > duration {
+			duration = t.at(t.samples[n-1].time + uint64(t.samples[n-1].delta))
+		}
+	}
+	if from >= duration {
+		return nil, 0, fmt.Errorf("指定的开始时间（%s）超出了视频时长（%s）", timecode.Format(from), timecode.Format(duration))
+	}
+
+	start := from
+	for _, t := range tracks {
+		if !t.hasStss {
+			continue
+		}
+		for _, s := range t.samples {
+			if t.at(s.time) > from {
+				break
+			}
+			if s.sync {
+				start = t.at(s.time)
+			}
+		}
+		break
+	}
+
+	type selection struct {
+		track   *mp4Track
+		samples []mp4Sample
+	}
+	var selected []selection
+	var all []mp4Sample
+	for _, t := range tracks {
+		var samples []mp4Sample
+		for _, s := range t.samples {
+			if t.at(s.time+uint64(s.delta)) > start && (to <= 0 || t.at(s.time) < to) {
+				samples = append(samples, s)
+			}
+		}
+		if len(samples) != 0 {
+			selected = append(selected, selection{t, samples})
+			all = append(all, samples...)
+		}
+	}
+	if len(all) == 0 {
+		return nil, 0, errors.New("截取范围内没有视频数据")
+	}
+
+	clip := &mp4Clip{ftyp: ftyp}
+	sort.Slice(all, func(i, j int) bool { return all[i].offset < all[j].offset })
+	for _, s := range all {
+		end := s.offset + int64(s.size)
+		if n := len(clip.intervals); n != 0 && s.offset <= clip.intervals[n-1][1]+mp4MergeGap {
+			if end > clip.intervals[n-1][1] {
+				clip.intervals[n-1][1] = end
+			}
+			continue
+		}
+		clip.intervals = append(clip.intervals, [2]int64{s.offset, end})
+	}
+	positions := make([]int64, len(clip.intervals)) // 每段数据在新mdat中的位置
+	for i, iv := range clip.intervals {
+		positions[i] = clip.dataSize
+		clip.dataSize += iv[1] - iv[0]
+	}
+	newOffset := func(base, off int64) int64 {
+		i := sort.Search(len(clip.intervals), func(i int) bool { return clip.intervals[i][1] > off })
+		return base + positions[i] + off - clip.intervals[i][0]
+	}
+
+	mvhd := moov.child("mvhd")
+	if mvhd == nil {
+		return nil, 0, errors.New("缺少 mvhd box")
+	}
+	r := &mp4Reader{b: mvhd.data}
+	if version := r.next(4)[0]; version == 1 {
+		r.next(16)
+	} else {
+		r.next(8)
+	}
+	movieScale := uint64(r.u32())
+	if r.err != nil || movieScale == 0 {
+		return nil, 0, errors.New("mvhd box 无效")
+	}
+
+	build := func(base int64, co64 bool) []byte {
+		rebuilt := make(map[*mp4Box]*mp4Box, len(selected))
+		var movieDuration uint64
+		for _, sel := range selected {
+			var duration uint64
+			for _, s := range sel.samples {
+				duration += uint64(s.delta)
+			}
+			d := duration * movieScale / uint64(sel.track.timescale)
+			if d > movieDuration {
+				movieDuration = d
+			}
+			rebuilt[sel.track.trak] = rebuildTrak(sel.track, sel.samples, duration, d, func(off int64) int64 { return newOffset(base, off) }, co64)
+		}
+
+		out := &mp4Box{typ: "moov"}
+		for _, c := range moov.children {
+			switch c.typ {
+			case "mvhd":
+				c = withDuration(c, movieDuration, 16)
+			case "trak":
+				if c = rebuilt[c]; c == nil { //截取范围内没有采样的轨道
+					continue
+				}
+			}
+			out.children = append(out.children, c)
+		}
+		return out.bytes()
+	}
+
+	clip.moov = build(0, false)
+	co64 := clip.size() > math.MaxUint32
+	if co64 {
+		clip.moov = build(0, true)
+	}
+	base := int64(len(clip.ftyp)+len(clip.moov)) + mdatHeaderSize(clip.dataSize)
+	clip.moov = build(base, co64)
+	return clip, start, nil
+}
+
+// withDuration 返回修改了时长字段的mvhd、tkhd或mdhd box的副本，offset为version 0时时长字段的位置。
+// version 1的box中创建时间和修改时间均为64位，时长字段后移8字节。
+func withDuration(b *mp4Box, duration uint64, offset int) *mp4Box {
+	data := append([]byte(nil), b.data...)
+	if len(data) < offset+16 {
+		return b
+	}
+	if data[0] == 1 {
+		binary.BigEndian.PutUint64(data[offset+8:], duration)
+	} else {
+		if duration > math.MaxUint32 {
+			duration = math.MaxUint32
+		}
+		binary.BigEndian.PutUint32(data[offset:], uint32(duration))
+	}
+	return &mp4Box{typ: b.typ, data: data}
+}
+
+// rebuildTrak 用选中的采样重建轨道的采样表。采样保持在原chunk中的分组，chunk的位置由newOffset换算到新文件中。
+func rebuildTrak(t *mp4Track, samples []mp4Sample, mediaDuration, movieDuration uint64, newOffset func(int64) int64, co64 bool) *mp4Box {
+	full := func(typ string, version byte, body []byte) *mp4Box {
+		return &mp4Box{typ: typ, data: append([]byte{version, 0, 0, 0}, body...)}
+	}
+	u32 := func(b []byte, vs ...uint32) []byte {
+		for _, v := range vs {
+			b = binary.BigEndian.AppendUint32(b, v)
+		}
+		return b
+	}
+
+	var stts, ctts []byte
+	var sttsN, cttsN uint32
+	var sttsRun, cttsRun uint32
+	var stsz, stss, stsc, stco []byte
+	var stssN, stscN, chunkN uint32
+	var perChunk, lastPerChunk, lastDesc uint32
+	sameSize := true
+	for i, s := range samples {
+		if i > 0 && s.delta == samples[i-1].delta {
+			sttsRun++
+			binary.BigEndian.PutUint32(stts[len(stts)-8:], sttsRun)
+		} else {
+			sttsRun = 1
+			stts = u32(stts, 1, s.delta)
+			sttsN++
+		}
+		if i > 0 && s.cts == samples[i-1].cts {
+			cttsRun++
+			binary.BigEndian.PutUint32(ctts[len(ctts)-8:], cttsRun)
+		} else {
+			cttsRun = 1
+			ctts = u32(ctts, 1, s.cts)
+			cttsN++
+		}
+		stsz = u32(stsz, s.size)
+		sameSize = sameSize && s.size == samples[0].size
+		if s.sync {
+			stss = u32(stss, uint32(i+1))
+			stssN++
+		}
+
+		perChunk++
+		if i+1 < len(samples) && samples[i+1].chunk == s.chunk {
+			continue
+		}
+		chunkN++
+		first := samples[i+1-int(perChunk)]
+		if co64 {
+			stco = binary.BigEndian.AppendUint64(stco, uint64(newOffset(first.offset)))
+		} else {
+			stco = u32(stco, uint32(newOffset(first.offset)))
+		}
+		if perChunk != lastPerChunk || first.desc != lastDesc {
+			stsc = u32(stsc, chunkN, perChunk, first.desc)
+			stscN++
+			lastPerChunk, lastDesc = perChunk, first.desc
+		}
+		perChunk = 0
+	}
+
+	oldStbl := t.trak.child("mdia").child("minf").child("stbl")
+	stbl := &mp4Box{typ: "stbl"}
+	if stsd := oldStbl.child("stsd"); stsd != nil {
+		stbl.children = append(stbl.children, stsd)
+	}
+	stbl.children = append(stbl.children, full("stts", 0, append(u32(nil, sttsN), stts...)))
+	if t.hasCtts {
+		stbl.children = append(stbl.children, full("ctts", t.cttsVer, append(u32(nil, cttsN), ctts...)))
+	}
+	if t.hasStss {
+		stbl.children = append(stbl.children, full("stss", 0, append(u32(nil, stssN), stss...)))
+	}
+	stbl.children = append(stbl.children, full("stsc", 0, append(u32(nil, stscN), stsc...)))
+	if sameSize {
+		stbl.children = append(stbl.children, full("stsz", 0, u32(nil, samples[0].size, uint32(len(samples)))))
+	} else {
+		stbl.children = append(stbl.children, full("stsz", 0, append(u32(nil, 0, uint32(len(samples))), stsz...)))
+	}
+	if co64 {
+		stbl.children = append(stbl.children, full("co64", 0, append(u32(nil, chunkN), stco...)))
+	} else {
+		stbl.children = append(stbl.children, full("stco", 0, append(u32(nil, chunkN), stco...)))
+	}
+
+	minf := &mp4Box{typ: "minf"}
+	for _, c := range t.trak.child("mdia").child("minf").children {
+		if c.typ == "stbl" {
+			c = stbl
+		}
+		minf.children = append(minf.children, c)
+	}
+	mdia := &mp4Box{typ: "mdia"}
+	for _, c := range t.trak.child("mdia").children {
+		switch c.typ {
+		case "mdhd":
+			c = withDuration(c, mediaDuration, 16)
+		case "minf":
+			c = minf
+		}
+		mdia.children = append(mdia.children, c)
+	}
+	trak := &mp4Box{typ: "trak"}
+	for _, c := range t.trak.children {
+		switch c.typ {
+		case "edts": // 编辑列表针对的是原视频的时间轴，截取后不再适用
+			continue
+		case "tkhd":
+			c = withDuration(c, movieDuration, 20)
+		case "mdia":
+			c = mdia
+		}
+		trak.children = append(trak.children, c)
+	}
+	return trak
+}
+
+// writeMP4Clip 将截取结果写入w，数据部分按范围从src中读取
+func writeMP4Clip(w io.Writer, src rangeSource, clip *mp4Clip) error {
+	if _, err := w.Write(clip.ftyp); err != nil {
+		return err
+	}
+	if _, err := w.Write(clip.moov); err != nil {
+		return err
+	}
+	hdr := make([]byte, 0, 16)
+	if mdatHeaderSize(clip.dataSize) == 16 {
+		hdr = binary.BigEndian.AppendUint32(hdr, 1)
+		hdr = append(hdr, "mdat"...)
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(clip.dataSize+16))
+	} else {
+		hdr = binary.BigEndian.AppendUint32(hdr, uint32(clip.dataSize+8))
+		hdr = append(hdr, "mdat"...)
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	for _, iv := range clip.intervals {
+		r, err := src.readRange(iv[0], iv[1]-iv[0])
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(w, r, iv[1]-iv[0])
+		_ = r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// downloadClip 仅下载视频中[v.From, v.To)范围内的数据，生成可独立播放的MP4文件
+func (v *Video) downloadClip(URL string) {
+	src := httpSource{url: URL, referer: v.url}
+	ftyp, moov, err := readMP4Header(src, v.size)
+	if err != nil {
+		fmt.Println("解析视频文件失败：", err)
+		return
+	}
+	clip, start, err := planMP4Clip(ftyp, moov, v.From, v.To)
+	if err != nil {
+		fmt.Println("截取视频失败：", err)
+		return
+	}
+	if start < v.From {
+		fmt.Printf("为保证截取结果可以正常播放，将从 %s 处的关键帧开始截取。\n", timecode.Format(start))
+	}
+
+	if _, err := os.Stat(v.SaveDir); os.IsNotExist(err) {
+		if err := os.Mkdir(v.SaveDir, os.ModePerm); err != nil {
+			fmt.Println("创建下载文件夹失败：", err)
+			return
+		}
+	}
+	dstFile, err := os.OpenFile(v.SaveDir+v.filename+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	//启动进度条监听器，截取时进度以新文件的大小计算
+	v.size = clip.size()
+	v.startBar()
+
+	if err = writeMP4Clip(dstFile, src, clip); err != nil {
+		_ = dstFile.Close()
+		v.stopBar()
+		fmt.Println("\n" + color.Error("截取视频失败：") + err.Error())
+		return
+	}
+	_ = dstFile.Close()
+	v.wg.Wait()
+}
@@ -0,0 +1,209 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFullBox(typ string, vs ...uint32) *mp4Box {
+	data := []byte{0, 0, 0, 0}
+	for _, v := range vs {
+		data = binary.BigEndian.AppendUint32(data, v)
+	}
+	return &mp4Box{typ: typ, data: data}
+}
+
+// testTrack 描述合成测试文件中的一个轨道：每个采样的时长、大小相同，每chunk包含perChunk个采样
+type testTrack struct {
+	count, delta, size, perChunk int
+	sync                         []uint32
+}
+
+// buildTestMP4 生成一个moov位于文件末尾、两个轨道的chunk交错存放的MP4文件。每个采样的内容为轨道号和采样序号，便于校验。
+func buildTestMP4(tracks []testTrack) []byte {
+	ftyp := (&mp4Box{typ: "ftyp", data: []byte("isom\x00\x00\x02\x00isom")}).bytes()
+	var mdat []byte
+	offsets := make([][]uint32, len(tracks))
+	base := len(ftyp) + 8
+	for chunk := 0; ; chunk++ {
+		wrote := false
+		for ti, t := range tracks {
+			first := chunk * t.perChunk
+			if first >= t.count {
+				continue
+			}
+			wrote = true
+			offsets[ti] = append(offsets[ti], uint32(base+len(mdat)))
+			for i := first; i < first+t.perChunk && i < t.count; i++ {
+				sample := bytes.Repeat([]byte{byte(ti)}, t.size)
+				binary.BigEndian.PutUint16(sample, uint16(i))
+				mdat = append(mdat, sample...)
+			}
+		}
+		if !wrote {
+			break
+		}
+	}
+
+	moov := &mp4Box{typ: "moov", children: []*mp4Box{testFullBox("mvhd", 0, 0, 1000, 0)}}
+	for ti, t := range tracks {
+		stbl := &mp4Box{typ: "stbl", children: []*mp4Box{
+			testFullBox("stsd", 0),
+			testFullBox("stts", 1, uint32(t.count), uint32(t.delta)),
+			testFullBox("stsc", 1, 1, uint32(t.perChunk), 1),
+			testFullBox("stsz", uint32(t.size), uint32(t.count)),
+			testFullBox("stco", append([]uint32{uint32(len(offsets[ti]))}, offsets[ti]...)...),
+		}}
+		if t.sync != nil {
+			stbl.children = append(stbl.children, testFullBox("stss", append([]uint32{uint32(len(t.sync))}, t.sync...)...))
+		}
+		moov.children = append(moov.children, &mp4Box{typ: "trak", children: []*mp4Box{
+			testFullBox("tkhd", 0, 0, uint32(ti+1), 0, 0, 0, 0),
+			{typ: "mdia", children: []*mp4Box{
+				testFullBox("mdhd", 0, 0, 1000, 0, 0),
+				{typ: "minf", children: []*mp4Box{stbl}},
+			}},
+		}})
+	}
+
+	file := append(ftyp, (&mp4Box{typ: "mdat", data: mdat}).bytes()...)
+	return append(file, moov.bytes()...)
+}
+
+func TestPlanMP4Clip(t *testing.T) {
+	src := buildTestMP4([]testTrack{
+		{count: 10, delta: 1000, size: 100, perChunk: 2, sync: []uint32{1, 4, 7, 10}}, // 视频，关键帧位于0s、3s、6s、9s
+		{count: 20, delta: 500, size: 10, perChunk: 4},                                // 音频
+	})
+	ftyp, moov, err := readMP4Header(bytesSource(src), int64(len(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip, start, err := planMP4Clip(ftyp, moov, 4500*time.Millisecond, 7*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 3*time.Second {
+		t.Errorf("start = %v, want the keyframe at 3s", start)
+	}
+
+	var out bytes.Buffer
+	if err = writeMP4Clip(&out, bytesSource(src), clip); err != nil {
+		t.Fatal(err)
+	}
+	if int64(out.Len()) != clip.size() {
+		t.Errorf("wrote %d bytes, clip.size() = %d", out.Len(), clip.size())
+	}
+
+	_, newMoov, err := readMP4Header(bytesSource(out.Bytes()), int64(out.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFirst := []int{3, 6} // 视频从3s的关键帧开始；音频从3s开始
+	wantCount := []int{4, 8} // 视频3s~7s共4帧；音频3s~7s共8个采样
+	wantSync := []int{0, 3}  // 关键帧位于截取后的第1、4帧
+	var trackIndex int
+	for _, c := range newMoov.children {
+		if c.typ != "trak" {
+			continue
+		}
+		track, err := parseMP4Track(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(track.samples) != wantCount[trackIndex] {
+			t.Fatalf("track %d has %d samples, want %d", trackIndex, len(track.samples), wantCount[trackIndex])
+		}
+		for i, s := range track.samples {
+			data := out.Bytes()[s.offset : s.offset+int64(s.size)]
+			if got := int(binary.BigEndian.Uint16(data)); got != wantFirst[trackIndex]+i || data[len(data)-1] != byte(trackIndex) {
+				t.Errorf("track %d sample %d holds sample %d of track %d", trackIndex, i, got, data[len(data)-1])
+			}
+			if s.time != uint64(i)*uint64(s.delta) {
+				t.Errorf("track %d sample %d starts at %d", trackIndex, i, s.time)
+			}
+		}
+		if trackIndex == 0 {
+			var sync []int
+			for i, s := range track.samples {
+				if s.sync {
+					sync = append(sync, i)
+				}
+			}
+			if len(sync) != len(wantSync) || sync[0] != wantSync[0] || sync[1] != wantSync[1] {
+				t.Errorf("sync samples = %v, want %v", sync, wantSync)
+			}
+		}
+		trackIndex++
+	}
+	if trackIndex != 2 {
+		t.Errorf("clip has %d tracks, want 2", trackIndex)
+	}
+
+	if _, _, err = planMP4Clip(ftyp, moov, time.Minute, 0); err == nil {
+		t.Error("clipping beyond the end should fail")
+	}
+}
+
+// TestMP4ClipPlayable 使用ffmpeg生成真实的视频文件，截取后用ffprobe检查结果能否正常解析。未安装ffmpeg时跳过。
+func TestMP4ClipPlayable(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not found in PATH")
+	}
+	if _, err := exec.LookPath("ffprobe"); err != nil {
+		t.Skip("ffprobe not found in PATH")
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.mp4")
+	cmd := exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-y",
+		"-f", "lavfi", "-i", "testsrc=size=160x120:rate=25",
+		"-f", "lavfi", "-i", "sine=frequency=440",
+		"-t", "20", "-g", "50", "-c:v", "mpeg4", "-c:a", "aac", input)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("ffmpeg could not generate the test file: %v: %s", err, out)
+	}
+	src, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ftyp, moov, err := readMP4Header(bytesSource(src), int64(len(src)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	clip, start, err := planMP4Clip(ftyp, moov, 5*time.Second, 12*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err = writeMP4Clip(&out, bytesSource(src), clip); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "out.mp4")
+	if err = os.WriteFile(output, out.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	probe, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration", "-of", "default=nw=1:nk=1", output).Output()
+	if err != nil {
+		t.Fatalf("ffprobe failed: %v", err)
+	}
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(probe)), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (12*time.Second - start).Seconds(); duration < want-0.5 || duration > want+0.5 {
+		t.Errorf("clip duration = %.2fs, want about %.2fs", duration, want)
+	}
+	if err = exec.Command("ffmpeg", "-v", "error", "-i", output, "-f", "null", "-").Run(); err != nil {
+		t.Errorf("ffmpeg failed to decode the clip: %v", err)
+	}
+}
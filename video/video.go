@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -16,36 +17,47 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/yliu7949/KouShare-dl/internal/color"
 	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/prompt"
 	"github.com/yliu7949/KouShare-dl/internal/proxy"
+	"github.com/yliu7949/KouShare-dl/internal/timecode"
+	"github.com/yliu7949/KouShare-dl/slide"
 	"github.com/yliu7949/KouShare-dl/user"
 )
 
 // Video 包含视频号、标题、作者、日期等基本信息
 type Video struct {
-	Vid          string
-	svid         string // 专题id
-	svpid        string // 子专题id
-	svpName      string // 子专题名字
-	title        string
-	author       string
-	affiliation  string
-	abstract     string
-	date         string
-	seriesName   string // 专题名字
-	seriesVids   []string
-	videoTime    string // 视频时长
-	size         int64  // 视频体积
-	easyURL      string // 标清播放链接
-	standardURL  string // 高清播放链接
-	url          string // 超清播放链接
-	vFiveURL     string // 加密播放链接，试看播放链接
-	statusCode   string // 获取视频信息时返回的状态码，401即需要登录；301即需要付费；601即需要密码；200即请求成功（免费视频或已购买视频）；500即视频不存在
-	vrName       string // 视频类别，分为“付费视频”、“免费视频”和“加密视频”三类，若为空则视为“免费视频”
-	SaveDir      string
-	filename     string // 保存视频文件时使用的文件名，不包含.mp4等扩展名
-	VidPrefix    bool   // 视频文件名是否使用具体的vid作为前缀，例如vid_filename.mp4
-	videoQuality string // 实际下载视频时的清晰度，分为“标清”、“高清”和“超清”三类
-	wg           sync.WaitGroup
+	Vid           string
+	svid          string // 专题id
+	svpid         string // 子专题id
+	svpName       string // 子专题名字
+	title         string
+	author        string
+	affiliation   string
+	abstract      string
+	date          string
+	seriesName    string // 专题名字
+	seriesVids    []string
+	videoTime     string // 视频时长
+	size          int64  // 视频体积
+	easyURL       string // 标清播放链接
+	standardURL   string // 高清播放链接
+	url           string // 超清播放链接
+	vFiveURL      string // 加密播放链接，试看播放链接
+	statusCode    string // 获取视频信息时返回的状态码，401即需要登录；301即需要付费；601即需要密码；200即请求成功（免费视频或已购买视频）；500即视频不存在
+	vrName        string // 视频类别，分为“付费视频”、“免费视频”和“加密视频”三类，若为空则视为“免费视频”
+	coursewareURL string // 课件下载链接，视频没有课件时为空
+	SaveDir       string
+	filename      string        // 保存视频文件时使用的文件名，不包含.mp4等扩展名
+	FileName      string        // 指定保存视频文件时使用的文件名前缀，为空时根据视频标题生成
+	Password      string        // 观看视频需要输入的密码，获取视频信息时返回状态码601即需要密码
+	VidPrefix     bool          // 视频文件名是否使用具体的vid作为前缀，例如vid_filename.mp4
+	NameTemplate  string        // 保存视频文件时使用的文件名模板，如"{vid}_{title}_{quality}"，为空时根据VidPrefix生成文件名
+	WithSlides    bool          // 是否同时下载视频对应的课件，课件与视频保存在同一文件夹中且文件名相同
+	From          time.Duration // 截取视频的开始时间，From和To均为0时下载完整视频
+	To            time.Duration // 截取视频的结束时间，为0表示截取至视频结尾
+	videoQuality  string        // 实际下载视频时的清晰度，分为“标清”、“高清”和“超清”三类
+	wg            sync.WaitGroup
+	barStop       chan struct{} // 下载失败时关闭，通知进度条监听器退出
 }
 
 var title string
@@ -65,6 +77,10 @@ func (v *Video) DownloadSingleVideo(quality string) {
 		fmt.Printf("%s\tvid=%s\n", v.title, v.Vid)
 		fmt.Print(" [>>>>>>>>>>> " + color.Error("该视频需付费，自动取消下载") + " >>>>>>>>>>>]\n\n")
 		return
+	} else if v.statusCode == "601" {
+		fmt.Printf("%s\tvid=%s\n", v.title, v.Vid)
+		fmt.Print(" [>>>>>>>>>>> " + color.Error("需要密码/密码不正确，请使用 --password 指定密码") + " >>>>>>>>>>>]\n\n")
+		return
 	}
 
 	var URL string
@@ -95,7 +111,11 @@ func (v *Video) DownloadSingleVideo(quality string) {
 			v.videoQuality = "标清"
 		}
 	}
-	v.getVideoSize(URL)
+	if err := v.getVideoSize(URL); err != nil {
+		fmt.Printf("%s\tvid=%s\n", v.title, v.Vid)
+		fmt.Println(color.Error("获取视频大小失败："), err)
+		return
+	}
 	if v.size == 0 {
 		fmt.Printf("%s\tvid=%s\n", v.title, v.Vid)
 		fmt.Print(" [>>>>>>>>>>> " + color.Highlight("该视频不存在，自动取消下载") + " >>>>>>>>>>>]\n\n")
@@ -106,12 +126,23 @@ func (v *Video) DownloadSingleVideo(quality string) {
 	reg, _ := regexp.Compile(`[\\/:*?"<>|]`)
 	title = reg.ReplaceAllString(v.title, "")
 
-	if v.VidPrefix {
+	if v.FileName != "" {
+		v.filename = v.FileName + "_" + v.videoQuality
+	} else if v.NameTemplate != "" {
+		v.filename = v.expandNameTemplate(reg)
+	} else if v.VidPrefix {
 		v.filename = v.Vid + "_" + title + "_" + v.videoQuality
 	} else {
 		v.filename = title + "_" + v.videoQuality
 	}
 
+	if v.From > 0 || v.To > 0 {
+		v.filename += timecode.FileSuffix(v.From, v.To)
+	}
+	if v.WithSlides {
+		defer v.saveSlides() //视频下载完成或跳过后再下载课件
+	}
+
 	//若mp4文件已存在，说明该视频已下载完成。自动跳过该视频的下载。
 	if _, err := os.Stat(v.SaveDir + v.filename + ".mp4"); err == nil {
 		fmt.Printf("%s\tvid=%s\t%s\n", v.title, v.Vid, v.videoQuality)
@@ -119,6 +150,11 @@ func (v *Video) DownloadSingleVideo(quality string) {
 		return
 	}
 
+	if v.From > 0 || v.To > 0 {
+		v.downloadClip(URL)
+		return
+	}
+
 	//若tmp文件已存在，说明该视频处于下载中断状态。为视频文件追加未下载的内容。
 	var firstByte = 0
 	if tmpFileSize := v.checkTmpFileSize(); tmpFileSize != 0 {
@@ -148,7 +184,11 @@ func (v *Video) DownloadSingleVideo(quality string) {
 	req.Header.Set("Range", "bytes="+strconv.Itoa(firstByte)+"-")
 	req.Header.Set("Referer", v.url)
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
-	resp, _ := proxy.Client.Do(req)
+	resp, err := proxy.Client.Do(req)
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
 	defer func() {
 		err = resp.Body.Close()
 		if err != nil {
@@ -170,10 +210,11 @@ func (v *Video) DownloadSingleVideo(quality string) {
 	}
 
 	//启动进度条监听器
-	v.wg.Add(1)
-	go v.showBar()
+	v.startBar()
 
 	if _, err = io.Copy(dstFile, resp.Body); err != nil {
+		_ = dstFile.Close()
+		v.stopBar()
 		fmt.Println(err.Error())
 		return
 	}
@@ -187,6 +228,11 @@ func (v *Video) DownloadSeriesVideos(quality string) {
 		fmt.Println("获取视频信息失败。")
 		return
 	}
+	if v.statusCode == "601" {
+		fmt.Printf("%s\tvid=%s\n", v.title, v.Vid)
+		fmt.Print(" [>>>>>>>>>>> " + color.Error("需要密码/密码不正确，请使用 --password 指定密码") + " >>>>>>>>>>>]\n\n")
+		return
+	}
 	if v.svid == "0" || v.svid == "" { //判断是否是专题视频，若不是专题视频则仅下载该视频
 		v.DownloadSingleVideo(quality)
 		return
@@ -217,17 +263,76 @@ func (v *Video) DownloadSeriesVideos(quality string) {
 	}
 }
 
-// GetVideoInfo 获取视频的基本信息
-func (v *Video) GetVideoInfo() bool {
-	URL := config.APIBaseURL() + "/api/api-video/getVideoById?vid=" + v.Vid + "&related=3&allData=1&password="
-	str, err := user.MyGetRequest(URL)
-	if err != nil {
-		fmt.Println("Get请求出错：", err)
-		return false
+// nameTemplateFields 为文件名模板中可以使用的字段
+var nameTemplateFields = []string{"vid", "title", "quality", "speaker", "date", "series"}
+
+// CheckNameTemplate 检查文件名模板：只能使用nameTemplateFields中的字段，且不能包含路径分隔符
+func CheckNameTemplate(template string) error {
+	if strings.ContainsAny(template, `/\`) {
+		return fmt.Errorf("文件名模板中不能包含路径分隔符")
+	}
+	rest := template
+	for _, field := range nameTemplateFields {
+		rest = strings.ReplaceAll(rest, "{"+field+"}", "")
 	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("文件名模板中只能使用 {%s} 字段", strings.Join(nameTemplateFields, "}、{"))
+	}
+	if strings.TrimSpace(template) == "" || rest == template {
+		return fmt.Errorf("文件名模板中至少需要使用一个字段，如 {title}")
+	}
+	return nil
+}
 
-	if v.statusCode = gjson.Get(str, "code").String(); v.statusCode == "500" { //状态为500时，get请求返回的的data为null
-		fmt.Printf("%s ", gjson.Get(str, "msg").String())
+// expandNameTemplate 根据NameTemplate生成文件名，reg用于过滤各字段中的不合法字符
+func (v *Video) expandNameTemplate(reg *regexp.Regexp) string {
+	date := v.date
+	if i := strings.IndexByte(date, ' '); i > 0 {
+		date = date[:i] //仅保留日期部分
+	}
+	r := strings.NewReplacer(
+		"{vid}", v.Vid,
+		"{title}", reg.ReplaceAllString(v.title, ""),
+		"{quality}", v.videoQuality,
+		"{speaker}", reg.ReplaceAllString(v.author, ""),
+		"{date}", reg.ReplaceAllString(date, ""),
+		"{series}", reg.ReplaceAllString(v.seriesName, ""),
+	)
+	return r.Replace(v.NameTemplate)
+}
+
+// saveSlides 下载视频对应的课件，课件的文件名与视频文件相同（扩展名除外）
+func (v *Video) saveSlides() {
+	if v.coursewareURL == "" {
+		return
+	}
+	fmt.Print("正在下载课件\t")
+	s := slide.Slide{SaveDir: v.SaveDir}
+	s.SaveCourseware(v.coursewareURL, v.filename, slide.Talk{Vid: v.Vid, Title: v.title, Speaker: v.author})
+	fmt.Println()
+}
+
+// maxPasswordAttempts 为视频密码不正确时重新输入的最多次数
+const maxPasswordAttempts = 3
+
+// GetVideoInfo 获取视频的基本信息。视频需要密码（状态码601）时使用Password，密码为空或不正确时在终端中提示输入密码。
+func (v *Video) GetVideoInfo() bool {
+	str, ok := v.requestVideoInfo()
+	for i := 0; ok && v.statusCode == "601"; i++ {
+		if v.Password != "" {
+			fmt.Println(color.Error("视频 vid=" + v.Vid + " 的密码不正确。"))
+		}
+		if i == maxPasswordAttempts || !prompt.IsTerminal() {
+			break //由调用者根据状态码601输出提示
+		}
+		password, err := prompt.Password("视频 vid=" + v.Vid + " 需要密码，请输入密码：")
+		if err != nil || password == "" {
+			break
+		}
+		v.Password = password
+		str, ok = v.requestVideoInfo()
+	}
+	if !ok {
 		return false
 	}
 
@@ -244,11 +349,28 @@ func (v *Video) GetVideoInfo() bool {
 	v.url = gjson.Get(str, "data.url").String()
 	v.vFiveURL = gjson.Get(str, "data.vfiveurl").String()
 	v.vrName = gjson.Get(str, "data.vrname").String()
+	v.coursewareURL = gjson.Get(str, "data.vcoursewareurl").String()
 	v.seriesName = gjson.Get(str, "data.svname").String()
 	v.videoTime = gjson.Get(str, "data.vtime").String()
 	return true
 }
 
+// requestVideoInfo 请求视频信息并更新statusCode，返回请求得到的内容
+func (v *Video) requestVideoInfo() (string, bool) {
+	URL := config.APIBaseURL() + "/api/api-video/getVideoById?vid=" + v.Vid + "&related=3&allData=1&password=" + url.QueryEscape(v.Password)
+	str, err := user.MyGetRequest(URL)
+	if err != nil {
+		fmt.Println("Get请求出错：", err)
+		return "", false
+	}
+
+	if v.statusCode = gjson.Get(str, "code").String(); v.statusCode == "500" { //状态为500时，get请求返回的的data为null
+		fmt.Printf("%s ", gjson.Get(str, "msg").String())
+		return "", false
+	}
+	return str, true
+}
+
 func (v *Video) checkTmpFileSize() (size int64) {
 	fileName := v.SaveDir + v.filename + ".tmp"
 	if _, err := os.Stat(fileName); os.IsNotExist(err) {
@@ -261,12 +383,12 @@ func (v *Video) checkTmpFileSize() (size int64) {
 	return size
 }
 
-func (v *Video) getVideoSize(URL string) {
+// getVideoSize 获取视频文件的大小并保存在v.size中，请求失败时返回错误
+func (v *Video) getVideoSize(URL string) error {
 	// URL参数为视频的真实下载地址
 	req, err := http.NewRequest(http.MethodGet, URL, nil)
 	if err != nil {
-		fmt.Println(err.Error())
-		return
+		return err
 	}
 	req.Header.Set("Accept", `text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.9`)
 	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
@@ -278,15 +400,30 @@ func (v *Video) getVideoSize(URL string) {
 	req.Header.Set("Upgrade-Insecure-Requests", "1")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/114.0.0.0 Safari/537.36")
 	resp, err := proxy.Client.Do(req)
-	if err != nil || resp == nil {
-		return
+	if err != nil {
+		return err
 	}
+	_ = resp.Body.Close()
 	str := resp.Header.Get("Content-Range")
 	array := strings.Split(str, "/")
 	if len(array) >= 2 {
 		i, _ := strconv.Atoi(array[1])
 		v.size = int64(i)
 	}
+	return nil
+}
+
+// startBar 启动进度条监听器，下载完成后由监听器将tmp文件重命名为mp4文件
+func (v *Video) startBar() {
+	v.barStop = make(chan struct{})
+	v.wg.Add(1)
+	go v.showBar()
+}
+
+// stopBar 在下载失败时通知进度条监听器退出，并等待其退出
+func (v *Video) stopBar() {
+	close(v.barStop)
+	v.wg.Wait()
 }
 
 func (v *Video) showBar() {
@@ -295,6 +432,12 @@ func (v *Video) showBar() {
 	var startTime = time.Now()
 	var startSize = v.checkTmpFileSize()
 	for {
+		select {
+		case <-v.barStop: //下载失败，保留tmp文件以便继续下载
+			v.wg.Done()
+			return
+		default:
+		}
 		if v.checkTmpFileSize() < v.size && v.size != 0 { //若相等则意味着该视频已下载完毕
 			saveRateGraph = ""
 			rate := v.checkTmpFileSize() * 100 / v.size
@@ -326,24 +469,21 @@ func (v *Video) ShowVideoInfo() {
 		return
 	}
 	if v.statusCode == "200" {
+		URL := v.easyURL
+		v.videoQuality = " [标清]"
 		if user.GetLoginState() == 1 {
 			if v.url != "" {
-				v.getVideoSize(v.url)
-				v.videoQuality = " [超清]"
+				URL, v.videoQuality = v.url, " [超清]"
 			} else if v.standardURL != "" {
-				v.getVideoSize(v.standardURL)
-				v.videoQuality = " [高清]"
-			} else {
-				v.getVideoSize(v.easyURL)
-				v.videoQuality = " [标清]"
+				URL, v.videoQuality = v.standardURL, " [高清]"
 			}
-		} else {
-			v.getVideoSize(v.easyURL)
-			v.videoQuality = " [标清]"
+		}
+		if err := v.getVideoSize(URL); err != nil {
+			fmt.Println(color.Error("获取视频大小失败："), err)
 		}
 	} else if v.statusCode == "601" {
-		v.getVideoSize(v.vFiveURL)
-		v.videoQuality = " [高清]"
+		fmt.Printf("%s (vid=%s):\n\n\t%s\n\n", v.title, v.Vid, color.Error("需要密码/密码不正确，请使用 --password 指定密码"))
+		return
 	} else {
 		v.videoQuality = " [未知]"
 	}
@@ -4,16 +4,21 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
 )
 
 // Batch 包含多个 Video 的信息
 type Batch struct {
-	Vids      string
-	VideoList []Video
-	SaveDir   string
-	Quality   string
-	IsSeries  bool
-	VidPrefix bool
+	Vids         string
+	VideoList    []*Video
+	SaveDir      string
+	Quality      string
+	IsSeries     bool
+	VidPrefix    bool
+	NameTemplate string
+	WithSlides   bool
+	Password     string // 视频需要密码时使用的密码，输入过的密码会用于之后的视频
 }
 
 // DownloadMultiVideos 下载多个视频
@@ -22,6 +27,8 @@ func (b *Batch) DownloadMultiVideos() {
 	for _, video := range b.VideoList {
 		video.SaveDir = b.SaveDir
 		video.VidPrefix = b.VidPrefix
+		video.NameTemplate = b.NameTemplate
+		video.WithSlides = b.WithSlides
 		if b.IsSeries {
 			video.DownloadSeriesVideos(b.Quality)
 		} else {
@@ -39,12 +46,19 @@ func (b *Batch) inspectVids() {
 	}
 	for _, vid := range strings.Split(b.Vids[1:len(b.Vids)-1], ",") {
 		if vid != "" {
-			var v Video
-			v.Vid = vid
+			v := &Video{Vid: vid, Password: b.Password}
 			if ok := v.GetVideoInfo(); !ok {
 				fmt.Printf("\n获取 vid=%s 的视频信息失败。\n", vid)
 				continue
 			}
+			if v.statusCode == "601" {
+				fmt.Printf("%s\tvid=%s\n", v.title, v.Vid)
+				fmt.Print(" [>>>>>>>>>>> " + color.Error("需要密码/密码不正确，请使用 --password 指定密码") + " >>>>>>>>>>>]\n\n")
+				continue
+			}
+			if v.Password != "" {
+				b.Password = v.Password
+			}
 			b.VideoList = append(b.VideoList, v)
 		}
 	}
@@ -0,0 +1,65 @@
+package video
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/yliu7949/KouShare-dl/internal/color"
+	"github.com/yliu7949/KouShare-dl/user"
+)
+
+// expiringSoon 为提示观看权限即将过期的时间
+const expiringSoon = 7 * 24 * time.Hour
+
+// Mine 当前账户已购买或收藏的视频
+type Mine struct {
+	Items        []user.Item
+	SaveDir      string
+	Quality      string
+	VidPrefix    bool
+	NameTemplate string
+	WithSlides   bool
+}
+
+// ShowItems 输出视频的标题、vid和观看权限的过期时间
+func (m *Mine) ShowItems() {
+	if len(m.Items) == 0 {
+		fmt.Println("没有找到视频。")
+		return
+	}
+	for _, item := range m.Items {
+		fmt.Printf("%s\tvid=%s", color.Emphasize(item.Title), item.Vid)
+		switch {
+		case item.Expires.IsZero():
+		case item.Expired():
+			fmt.Print("\t" + color.Error("已于 "+item.Expires.Format("2006-01-02")+" 过期"))
+		case time.Until(item.Expires) < expiringSoon:
+			fmt.Print("\t" + color.Error("有效期至 "+item.Expires.Format("2006-01-02 15:04")))
+		default:
+			fmt.Print("\t有效期至 " + item.Expires.Format("2006-01-02"))
+		}
+		fmt.Println()
+	}
+	fmt.Printf("共 %d 个视频。\n", len(m.Items))
+}
+
+// DownloadItems 依次下载全部视频，观看权限先过期的视频先下载，已过期的视频会被跳过
+func (m *Mine) DownloadItems() {
+	items := make([]user.Item, 0, len(m.Items))
+	for _, item := range m.Items {
+		if item.Expired() {
+			fmt.Printf("%s\tvid=%s\t已过期，跳过。\n", item.Title, item.Vid)
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, b := items[i].Expires, items[j].Expires
+		return !a.IsZero() && (b.IsZero() || a.Before(b))
+	})
+	for _, item := range items {
+		v := &Video{Vid: item.Vid, SaveDir: m.SaveDir, VidPrefix: m.VidPrefix, NameTemplate: m.NameTemplate, WithSlides: m.WithSlides}
+		v.DownloadSingleVideo(m.Quality)
+	}
+}
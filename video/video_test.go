@@ -0,0 +1,128 @@
+package video
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/yliu7949/KouShare-dl/internal/config"
+	"github.com/yliu7949/KouShare-dl/internal/proxy"
+)
+
+func TestGetVideoInfoPassword(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("password") != "p&w" {
+			_, _ = w.Write([]byte(`{"code":601,"data":{"vtitle":"内部报告"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"code":200,"data":{"vtitle":"内部报告","url":"https://example.com/v.mp4"}}`))
+	}))
+	defer srv.Close()
+	config.SetConfigDir(t.TempDir()) //不读取本机的登录凭证
+	config.SetAPIBaseURL(srv.URL)
+
+	v := Video{Vid: "1", Password: "p&w"}
+	if !v.GetVideoInfo() || v.statusCode != "200" || v.url == "" {
+		t.Errorf("with the right password: status %s, url %q", v.statusCode, v.url)
+	}
+	// 测试时标准输入不是终端，不会提示输入密码
+	v = Video{Vid: "1", Password: "wrong"}
+	if !v.GetVideoInfo() || v.statusCode != "601" || v.title != "内部报告" {
+		t.Errorf("with a wrong password: status %s, title %q", v.statusCode, v.title)
+	}
+}
+
+func TestPasswordRequired(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":601,"data":{"vtitle":"内部报告","svid":"7"}}`))
+	}))
+	defer srv.Close()
+	config.SetConfigDir(t.TempDir())
+	config.SetAPIBaseURL(srv.URL)
+	dir := t.TempDir() + "/"
+
+	tests := map[string]func(){
+		"single": func() { (&Video{Vid: "1", SaveDir: dir}).DownloadSingleVideo("high") },
+		"series": func() { (&Video{Vid: "1", SaveDir: dir}).DownloadSeriesVideos("high") },
+		"batch":  func() { (&Batch{Vids: "[1,2]", SaveDir: dir, Password: "wrong"}).DownloadMultiVideos() },
+		"info":   func() { (&Video{Vid: "1"}).ShowVideoInfo() },
+	}
+	for name, run := range tests {
+		out := captureStdout(t, run)
+		if !strings.Contains(out, "需要密码/密码不正确，请使用 --password") {
+			t.Errorf("%s: no password hint in %q", name, out)
+		}
+		if strings.Contains(out, "该视频不存在") || strings.Contains(out, "体积") {
+			t.Errorf("%s: continued after 601: %q", name, out)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files were created: %v", entries)
+	}
+}
+
+func TestDownloadCertError(t *testing.T) {
+	// 视频服务器的证书不受信任时，应当输出错误和--ca-cert提示而不是panic
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Range", "bytes 0-0/100")
+		w.WriteHeader(http.StatusPartialContent)
+	}))
+	defer tlsSrv.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"code":200,"data":{"vtitle":"报告","easyurl":"` + tlsSrv.URL + `/v.mp4"}}`))
+	}))
+	defer srv.Close()
+	config.SetConfigDir(t.TempDir())
+	config.SetAPIBaseURL(srv.URL)
+	proxy.EnableProxy("") //与ks命令一样使用验证证书的Client
+	dir := t.TempDir() + "/"
+
+	out := captureStdout(t, func() { (&Video{Vid: "1", SaveDir: dir}).DownloadSingleVideo("high") })
+	if !strings.Contains(out, "--ca-cert") || strings.Contains(out, "该视频不存在") {
+		t.Errorf("output = %q", out)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files were created: %v", entries)
+	}
+}
+
+// captureStdout 返回运行f时输出到标准输出的内容
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- string(data)
+	}()
+	f()
+	os.Stdout = stdout
+	_ = w.Close()
+	return <-done
+}
+
+func TestStopBar(t *testing.T) {
+	dir := t.TempDir() + "/"
+	v := &Video{Vid: "1", SaveDir: dir, filename: "clip", size: 100}
+	if err := os.WriteFile(dir+"clip.tmp", []byte("partial"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// 下载失败时进度条监听器应当退出，且不把未下载完的tmp文件重命名为mp4文件
+	captureStdout(t, func() {
+		v.startBar()
+		v.stopBar()
+	})
+	if _, err := os.Stat(dir + "clip.tmp"); err != nil {
+		t.Errorf("the tmp file was not kept: %v", err)
+	}
+	if _, err := os.Stat(dir + "clip.mp4"); err == nil {
+		t.Error("an incomplete download was renamed to mp4")
+	}
+}